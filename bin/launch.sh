@@ -3,8 +3,6 @@
 # See https://www.gnu.org/software/bash/manual/html_node/The-Set-Builtin.html for more information
 set -Cu
 
-# Run the database migrations
-/opt/bin/run-migrations.sh
-
-# Launch the app in the foreground
+# Launch the app in the foreground. It applies any pending database migrations
+# when it starts.
 gourlshortener
\ No newline at end of file
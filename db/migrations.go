@@ -0,0 +1,15 @@
+// Package db embeds the database migrations, so that the binary can apply
+// them itself.
+package db
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// Migrations holds the dbmate-format migrations in the migrations directory,
+// at its root
+var Migrations, _ = fs.Sub(embedded, "migrations")
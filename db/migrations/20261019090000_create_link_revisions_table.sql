@@ -0,0 +1,26 @@
+-- migrate:up
+-- Create the link_revisions table which records every change to a shortened
+-- link's destination and settings, along with who made the change and when.
+CREATE TABLE IF NOT EXISTS "link_revisions" (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    -- the shortened URL that the revision belongs to
+    shortened_url TEXT NOT NULL,
+    -- the revision number, starting at 1 for each shortened URL
+    revision INTEGER NOT NULL,
+    -- the destination URL as of this revision
+    original_url TEXT NOT NULL,
+    -- the link's settings, as a JSON object, as of this revision
+    settings TEXT NOT NULL DEFAULT '{}',
+    -- the user or API key that made the change
+    actor TEXT NOT NULL,
+    -- marks when the change was made
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uniq_link_revision UNIQUE (shortened_url, revision)
+);
+-- Record the current state of every existing link as its first revision.
+INSERT INTO link_revisions (shortened_url, revision, original_url, actor, created)
+SELECT shortened_url, 1, original_url, 'system', created
+FROM urls;
+
+-- migrate:down
+DROP TABLE IF EXISTS "link_revisions";
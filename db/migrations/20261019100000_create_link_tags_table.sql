@@ -0,0 +1,29 @@
+-- migrate:up
+-- Add the folder column to the urls table, which optionally groups a link
+-- with others. An empty string means that the link isn't in a folder.
+ALTER TABLE urls ADD COLUMN folder TEXT NOT NULL DEFAULT '';
+CREATE index idx_urls_folder ON urls (folder);
+-- Create the link_tags table which stores the tags of each shortened link.
+CREATE TABLE IF NOT EXISTS "link_tags" (
+    -- the shortened URL that is tagged
+    shortened_url TEXT NOT NULL,
+    -- the tag, in lower case
+    tag TEXT NOT NULL,
+    CONSTRAINT uniq_link_tag PRIMARY KEY (shortened_url, tag)
+);
+-- Add an index on the tag column, as links are filtered, and clicks are
+-- totalled, by tag.
+CREATE index idx_link_tags_tag ON link_tags (tag);
+-- Create a trigger to remove a link's tags when the link is deleted
+CREATE TRIGGER IF NOT EXISTS trig_urls_delete_tags
+AFTER
+DELETE ON urls BEGIN
+DELETE FROM link_tags
+WHERE shortened_url = old.shortened_url;
+END;
+
+-- migrate:down
+DROP TRIGGER IF EXISTS trig_urls_delete_tags;
+DROP TABLE IF EXISTS "link_tags";
+DROP INDEX IF EXISTS idx_urls_folder;
+ALTER TABLE urls DROP COLUMN folder;
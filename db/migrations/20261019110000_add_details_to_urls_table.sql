@@ -0,0 +1,12 @@
+-- migrate:up
+-- Add the title, description, and notes columns to the urls table, which
+-- describe a link. The title and description can be fetched from the link's
+-- destination, and the notes are free text for the link's owner.
+ALTER TABLE urls ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+
+-- migrate:down
+ALTER TABLE urls DROP COLUMN notes;
+ALTER TABLE urls DROP COLUMN description;
+ALTER TABLE urls DROP COLUMN title;
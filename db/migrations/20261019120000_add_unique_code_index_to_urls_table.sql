@@ -0,0 +1,52 @@
+-- migrate:up
+-- Links created before codes had to be unique can share a code under
+-- different schemes, e.g., http://4C2P1PC8 and https://4C2P1PC8. Every such
+-- link but the oldest is renamed, by adding its row ID to its code, so that
+-- the unique index below can be created. Their revisions and tags are renamed
+-- along with them, unless a link which is kept has the same shortened URL.
+CREATE TEMPORARY TABLE renamed_links AS
+SELECT rowid AS id, shortened_url AS old_url, shortened_url || '-' || rowid AS new_url
+FROM urls AS link
+WHERE EXISTS (
+    SELECT 1 FROM urls AS older
+    WHERE older.rowid < link.rowid
+    AND CASE
+        WHEN instr(older.shortened_url, '://') > 0 THEN substr(older.shortened_url, instr(older.shortened_url, '://') + 3)
+        ELSE older.shortened_url
+    END = CASE
+        WHEN instr(link.shortened_url, '://') > 0 THEN substr(link.shortened_url, instr(link.shortened_url, '://') + 3)
+        ELSE link.shortened_url
+    END
+);
+UPDATE link_revisions
+SET shortened_url = (SELECT new_url FROM renamed_links WHERE old_url = link_revisions.shortened_url)
+WHERE shortened_url IN (SELECT old_url FROM renamed_links)
+AND shortened_url NOT IN (SELECT shortened_url FROM urls WHERE rowid NOT IN (SELECT id FROM renamed_links));
+UPDATE link_tags
+SET shortened_url = (SELECT new_url FROM renamed_links WHERE old_url = link_tags.shortened_url)
+WHERE shortened_url IN (SELECT old_url FROM renamed_links)
+AND shortened_url NOT IN (SELECT shortened_url FROM urls WHERE rowid NOT IN (SELECT id FROM renamed_links));
+UPDATE urls
+SET shortened_url = (SELECT new_url FROM renamed_links WHERE id = urls.rowid)
+WHERE rowid IN (SELECT id FROM renamed_links);
+DROP TABLE renamed_links;
+-- Add a unique index on the shortened URL's code (the shortened URL without
+-- its scheme), so that no two links can have the same code, whatever their
+-- schemes. Collisions between newly generated codes are caught by this index,
+-- and retried.
+CREATE UNIQUE INDEX uniq_urls_code ON urls (
+    CASE
+        WHEN instr(shortened_url, '://') > 0 THEN substr(shortened_url, instr(shortened_url, '://') + 3)
+        ELSE shortened_url
+    END
+);
+-- Create the code_sequence table, whose IDs are obfuscated into codes by the
+-- sequential code generator. Only the latest ID needs to be kept, as
+-- AUTOINCREMENT never reuses IDs.
+CREATE TABLE IF NOT EXISTS "code_sequence" (
+    id INTEGER PRIMARY KEY AUTOINCREMENT
+);
+
+-- migrate:down
+DROP TABLE IF EXISTS "code_sequence";
+DROP INDEX IF EXISTS uniq_urls_code;
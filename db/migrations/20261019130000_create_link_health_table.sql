@@ -0,0 +1,40 @@
+-- migrate:up
+-- Create the link_health table, which stores the outcome of the latest check
+-- of each link's destination, and how many checks in a row have failed.
+CREATE TABLE IF NOT EXISTS "link_health" (
+    -- the shortened URL whose destination was checked
+    shortened_url TEXT PRIMARY KEY,
+    -- the status code of the final response, or 0 if there wasn't one
+    status_code INTEGER NOT NULL DEFAULT 0,
+    -- the URL which the destination finally redirected to
+    final_url TEXT NOT NULL DEFAULT '',
+    -- how long the check took, in milliseconds
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    -- why the request failed, if it didn't get a response
+    error TEXT NOT NULL DEFAULT '',
+    checked_at DATETIME NOT NULL,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    -- whether the link has failed enough checks in a row to be broken
+    broken BOOLEAN NOT NULL DEFAULT FALSE
+);
+-- Create a trigger to remove a link's health when the link is deleted
+CREATE TRIGGER IF NOT EXISTS trig_urls_delete_health
+AFTER
+DELETE ON urls BEGIN
+DELETE FROM link_health
+WHERE shortened_url = old.shortened_url;
+END;
+-- Create a trigger to forget a link's health when its destination changes,
+-- as it was the health of the previous destination
+CREATE TRIGGER IF NOT EXISTS trig_urls_update_health
+AFTER
+UPDATE OF original_url ON urls
+WHEN old.original_url != new.original_url BEGIN
+DELETE FROM link_health
+WHERE shortened_url = old.shortened_url;
+END;
+
+-- migrate:down
+DROP TRIGGER IF EXISTS trig_urls_update_health;
+DROP TRIGGER IF EXISTS trig_urls_delete_health;
+DROP TABLE IF EXISTS "link_health";
@@ -0,0 +1,23 @@
+-- migrate:up
+-- Create the users table, which stores the people who can change links
+CREATE TABLE IF NOT EXISTS "users" (
+    name TEXT PRIMARY KEY,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- Create the api_keys table, which stores the keys that users authenticate
+-- with. Only a SHA-256 hash of each key is stored, so that the keys can't be
+-- read back from the database.
+CREATE TABLE IF NOT EXISTS "api_keys" (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_name TEXT NOT NULL REFERENCES users (name) ON DELETE CASCADE,
+    -- a name which reminds the user what the key is for
+    name TEXT NOT NULL DEFAULT '',
+    key_hash TEXT NOT NULL UNIQUE,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_name ON api_keys (user_name);
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_api_keys_user_name;
+DROP TABLE IF EXISTS "api_keys";
+DROP TABLE IF EXISTS "users";
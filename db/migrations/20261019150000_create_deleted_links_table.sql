@@ -0,0 +1,24 @@
+-- migrate:up
+-- Create the deleted_links table, which remembers the codes of deleted links,
+-- so that they're reported as gone rather than not found. A link's revisions
+-- are deleted along with it, so that a link which reuses its code doesn't
+-- inherit its history.
+CREATE TABLE IF NOT EXISTS "deleted_links" (
+    -- the deleted link's code (its shortened URL without the scheme)
+    code TEXT PRIMARY KEY,
+    deleted DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- Remember the links which were deleted while their revisions were kept, then
+-- delete those revisions.
+INSERT OR IGNORE INTO deleted_links (code)
+SELECT DISTINCT CASE
+        WHEN instr(shortened_url, '://') > 0 THEN substr(shortened_url, instr(shortened_url, '://') + 3)
+        ELSE shortened_url
+    END
+FROM link_revisions
+WHERE shortened_url NOT IN (SELECT shortened_url FROM urls);
+DELETE FROM link_revisions
+WHERE shortened_url NOT IN (SELECT shortened_url FROM urls);
+
+-- migrate:down
+DROP TABLE IF EXISTS "deleted_links";
@@ -0,0 +1,79 @@
+package application
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"gourlshortener/internals/backup"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithAdminToken sets the bearer token which authenticates requests to the
+// admin API. The admin API isn't served without one.
+func WithAdminToken(token string) Option {
+	return func(a *App) {
+		a.adminToken = token
+	}
+}
+
+// WithBackups sets the manager which the admin API takes the database's
+// backups with
+func WithBackups(backups *backup.Manager) Option {
+	return func(a *App) {
+		a.backups = backups
+	}
+}
+
+// BackupResponse is the JSON representation of a backup. Its path isn't
+// included, as it's only meaningful on the server.
+type BackupResponse struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Created    time.Time `json:"created"`
+	Compressed bool      `json:"compressed"`
+}
+
+func newBackupResponse(b backup.Backup) BackupResponse {
+	return BackupResponse{Name: b.Name, Size: b.Size, Created: b.Created, Compressed: b.Compressed}
+}
+
+// requireAdmin rejects requests which don't have the admin token as their
+// bearer token
+func (a *App) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apiError(w, http.StatusUnauthorized, "a valid admin token is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiCreateBackup backs up the database while it's in use
+func (a *App) apiCreateBackup(w http.ResponseWriter, r *http.Request) {
+	created, err := a.backups.Create(r.Context())
+	if err != nil {
+		fmt.Println(err.Error())
+		apiError(w, http.StatusInternalServerError, "the database couldn't be backed up")
+		return
+	}
+	writeJSON(w, http.StatusCreated, newBackupResponse(*created))
+}
+
+// apiListBackups lists the database's backups, newest first
+func (a *App) apiListBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := a.backups.List()
+	if err != nil {
+		fmt.Println(err.Error())
+		apiError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	response := make([]BackupResponse, 0, len(backups))
+	for _, b := range backups {
+		response = append(response, newBackupResponse(b))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,381 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/models"
+	"gourlshortener/internals/validation"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// LinkResponse is the API representation of a shortened URL
+type LinkResponse struct {
+	OriginalURL  string   `json:"original_url"`
+	ShortenedURL string   `json:"shortened_url"`
+	Clicks       int      `json:"clicks"`
+	Folder       string   `json:"folder"`
+	Tags         []string `json:"tags"`
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	Notes        string   `json:"notes"`
+	// Health is the health of the link's destination, if it's been checked
+	Health *HealthResponse `json:"health,omitempty"`
+}
+
+// RevisionResponse is the API representation of a revision of a shortened URL
+type RevisionResponse struct {
+	Revision     int               `json:"revision"`
+	ShortenedURL string            `json:"shortened_url"`
+	OriginalURL  string            `json:"original_url"`
+	Settings     map[string]string `json:"settings"`
+	Actor        string            `json:"actor"`
+	Created      time.Time         `json:"created"`
+}
+
+// ErrorResponse is the API representation of an error
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// linkRequest is the body of a request to create a link, or to change a
+// link's destination, settings, folder, tags, or details
+type linkRequest struct {
+	OriginalURL   string    `json:"original_url"`
+	AlwaysPreview *bool     `json:"always_preview,omitempty"`
+	Folder        *string   `json:"folder,omitempty"`
+	Tags          *[]string `json:"tags,omitempty"`
+	Title         *string   `json:"title,omitempty"`
+	Description   *string   `json:"description,omitempty"`
+	Notes         *string   `json:"notes,omitempty"`
+	OGTitle       *string   `json:"og_title,omitempty"`
+	OGDescription *string   `json:"og_description,omitempty"`
+	OGImage       *string   `json:"og_image,omitempty"`
+}
+
+// settings returns the changes to the link's settings in the request, which
+// are empty if there aren't any, or a message explaining why they're invalid
+func (body linkRequest) settings() (map[string]string, string) {
+	changes := map[string]string{}
+	if body.AlwaysPreview != nil {
+		changes[models.SettingAlwaysPreview] = ""
+		if *body.AlwaysPreview {
+			changes[models.SettingAlwaysPreview] = "true"
+		}
+	}
+
+	social := map[string]string{}
+	for name, value := range map[string]*string{
+		models.SettingOGTitle:       body.OGTitle,
+		models.SettingOGDescription: body.OGDescription,
+		models.SettingOGImage:       body.OGImage,
+	} {
+		if value != nil {
+			social[name] = *value
+		}
+	}
+	if len(social) > 0 {
+		validated, message := socialChanges(nil, social[models.SettingOGTitle], social[models.SettingOGDescription], social[models.SettingOGImage])
+		if message != "" {
+			return nil, message
+		}
+		for name := range social {
+			changes[name] = validated[name]
+		}
+	}
+
+	return changes, ""
+}
+
+// hasDetails reports whether the request changes the link's title,
+// description, or notes
+func (body linkRequest) hasDetails() bool {
+	return body.Title != nil || body.Description != nil || body.Notes != nil
+}
+
+// details returns the link's details with the changes in the request applied
+func (body linkRequest) details(current models.LinkDetails) models.LinkDetails {
+	if body.Title != nil {
+		current.Title = *body.Title
+	}
+	if body.Description != nil {
+		current.Description = *body.Description
+	}
+	if body.Notes != nil {
+		current.Notes = *body.Notes
+	}
+	return current
+}
+
+// validate checks the folder, tags, and details in the request, if any, so
+// that invalid ones are rejected before the link is changed
+func (body linkRequest) validate() error {
+	if _, err := body.details(models.LinkDetails{}).Normalise(); err != nil {
+		return err
+	}
+	if body.Tags != nil {
+		if _, err := models.NormaliseTags(*body.Tags); err != nil {
+			return err
+		}
+	}
+	if body.Folder != nil {
+		if _, err := models.NormaliseFolder(*body.Folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// organiseError writes an error from changing a link's folder, tags, or
+// details to the response as JSON
+func organiseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidTag) || errors.Is(err, models.ErrInvalidFolder):
+		apiError(w, http.StatusBadRequest, organiseMessage(nil, err))
+	case errors.Is(err, models.ErrInvalidDetails):
+		apiError(w, http.StatusBadRequest, detailsMessage(nil, err))
+	default:
+		apiModelError(w, err)
+	}
+}
+
+func newLinkResponse(data *models.ShortenerData) LinkResponse {
+	return LinkResponse{
+		OriginalURL:  data.OriginalURL,
+		ShortenedURL: data.ShortenedURL,
+		Clicks:       data.Clicks,
+		Folder:       data.Folder,
+		Tags:         data.Tags,
+		Title:        data.Title,
+		Description:  data.Description,
+		Notes:        data.Notes,
+	}
+}
+
+// writeJSON writes the supplied data to the response as JSON with the
+// supplied status code
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// apiError writes an error message to the response as JSON
+func apiError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{Error: message})
+}
+
+// apiModelError writes a model error to the response as JSON, distinguishing
+// missing records from all other errors
+func apiModelError(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrNoRecord) {
+		apiError(w, http.StatusNotFound, "no matching link found")
+		return
+	}
+	fmt.Println(err.Error())
+	apiError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+// apiGetLink returns the shortened URL identified by the url query parameter,
+// or lists the shortened URLs if there isn't one
+func (a *App) apiGetLink(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("url") {
+		a.apiListLinks(w, r)
+		return
+	}
+
+	urlData, err := a.urls.Get(r.URL.Query().Get("url"))
+	if err != nil {
+		apiModelError(w, err)
+		return
+	}
+
+	response := newLinkResponse(urlData)
+	linkHealth, err := a.urls.Health(urlData.ShortenedURL)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		apiModelError(w, err)
+		return
+	}
+	response.Health = newHealthResponse(linkHealth)
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// apiCreateLink shortens the original URL in the request body, optionally
+// putting it in a folder, tagging it, and setting its details, and returns
+// the new link
+func (a *App) apiCreateLink(w http.ResponseWriter, r *http.Request) {
+	var body linkRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apiError(w, http.StatusBadRequest, "request body must be a JSON object")
+		return
+	}
+
+	if err := body.validate(); err != nil {
+		organiseError(w, err)
+		return
+	}
+
+	// The folder, tags, and details are set in the same transaction as the
+	// link is inserted in, so that it's never left half organised
+	var change *models.LinkChange
+	if body.Folder != nil || body.Tags != nil || body.hasDetails() {
+		change = &models.LinkChange{
+			Folder:      body.Folder,
+			Tags:        body.Tags,
+			Title:       body.Title,
+			Description: body.Description,
+			Notes:       body.Notes,
+		}
+	}
+
+	urlData, err := a.createLink(r.Context(), body.OriginalURL, change, a.actor(r))
+	if err != nil {
+		var validationErr *validation.Error
+		if errors.As(err, &validationErr) {
+			apiError(w, http.StatusBadRequest, validationErr.Message)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidTag) || errors.Is(err, models.ErrInvalidFolder) || errors.Is(err, models.ErrInvalidDetails) {
+			organiseError(w, err)
+			return
+		}
+		fmt.Println(err.Error())
+		apiError(w, http.StatusInternalServerError, "we weren't able to shorten the URL")
+		return
+	}
+
+	if change != nil {
+		if urlData, err = a.urls.Get(urlData.ShortenedURL); err != nil {
+			apiModelError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusCreated, newLinkResponse(urlData))
+}
+
+// apiUpdateLink changes the destination, settings, folder, tags, and/or
+// details of the shortened URL identified by the url query parameter, all at
+// once, and returns the updated link
+func (a *App) apiUpdateLink(w http.ResponseWriter, r *http.Request) {
+	shortenedURL := r.URL.Query().Get("url")
+
+	var body linkRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apiError(w, http.StatusBadRequest, "request body must be a JSON object")
+		return
+	}
+	settings, message := body.settings()
+	if message != "" {
+		apiError(w, http.StatusBadRequest, message)
+		return
+	}
+	if body.OriginalURL == "" && len(settings) == 0 && body.Folder == nil && body.Tags == nil && !body.hasDetails() {
+		apiError(w, http.StatusBadRequest, "request body must set original_url, always_preview, og_title, og_description, og_image, folder, tags, title, description, or notes")
+		return
+	}
+	if err := body.validate(); err != nil {
+		organiseError(w, err)
+		return
+	}
+
+	change := models.LinkChange{
+		Settings:    settings,
+		Folder:      body.Folder,
+		Tags:        body.Tags,
+		Title:       body.Title,
+		Description: body.Description,
+		Notes:       body.Notes,
+	}
+	if body.OriginalURL != "" {
+		destination, err := a.ValidateURL(r.Context(), body.OriginalURL)
+		if err != nil {
+			var validationErr *validation.Error
+			if errors.As(err, &validationErr) {
+				apiError(w, http.StatusBadRequest, validationErr.Message)
+				return
+			}
+			fmt.Println(err.Error())
+			apiError(w, http.StatusInternalServerError, "we weren't able to validate the URL")
+			return
+		}
+		change.OriginalURL = destination
+	}
+
+	if err := a.urls.Change(shortenedURL, change, a.actor(r)); err != nil {
+		organiseError(w, err)
+		return
+	}
+
+	urlData, err := a.urls.Get(shortenedURL)
+	if err != nil {
+		apiModelError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newLinkResponse(urlData))
+}
+
+// apiGetRevisions returns every revision of the shortened URL identified by
+// the url query parameter, newest first
+func (a *App) apiGetRevisions(w http.ResponseWriter, r *http.Request) {
+	revisions, err := a.urls.Revisions(r.URL.Query().Get("url"))
+	if err != nil {
+		apiModelError(w, err)
+		return
+	}
+
+	response := make([]RevisionResponse, 0, len(revisions))
+	for _, revision := range revisions {
+		response = append(response, RevisionResponse{
+			Revision:     revision.Revision,
+			ShortenedURL: revision.ShortenedURL,
+			OriginalURL:  revision.OriginalURL,
+			Settings:     revision.Settings,
+			Actor:        revision.Actor,
+			Created:      revision.Created,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// apiRevertLink reverts the shortened URL identified by the url query
+// parameter to the revision identified by the revision query parameter, and
+// returns the updated link
+func (a *App) apiRevertLink(w http.ResponseWriter, r *http.Request) {
+	shortenedURL := r.URL.Query().Get("url")
+	revision, err := strconv.Atoi(r.URL.Query().Get("revision"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "revision must be a number")
+		return
+	}
+
+	if err = a.validateRevision(r.Context(), shortenedURL, revision); err != nil {
+		var validationErr *validation.Error
+		if errors.As(err, &validationErr) {
+			apiError(w, http.StatusBadRequest, validationErr.Message)
+			return
+		}
+		apiModelError(w, err)
+		return
+	}
+
+	if err = a.urls.Revert(shortenedURL, revision, a.actor(r)); err != nil {
+		apiModelError(w, err)
+		return
+	}
+
+	urlData, err := a.urls.Get(shortenedURL)
+	if err != nil {
+		apiModelError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newLinkResponse(urlData))
+}
@@ -0,0 +1,616 @@
+package application
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"gourlshortener/internals/backup"
+	"gourlshortener/internals/blocklist"
+	"gourlshortener/internals/importer"
+	"gourlshortener/internals/models"
+	"gourlshortener/internals/models/mocks"
+	"gourlshortener/internals/ratelimit"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestApiCanRetrieveRevisions(t *testing.T) {
+	app := &App{
+		urls:  &mocks.ShortenerDataModel{},
+		users: &mocks.UserModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL + "/api/links/revisions?url=" + url.QueryEscape("http://shorten3d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without an API key, got %d; want %d", rs.StatusCode, http.StatusUnauthorized)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/links/revisions?url="+url.QueryEscape("http://shorten3d"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", mocks.MockAPIKey)
+	rs, err = ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Errorf("got %d; want %d", rs.StatusCode, http.StatusOK)
+	}
+
+	var revisions []RevisionResponse
+	if err = json.NewDecoder(rs.Body).Decode(&revisions); err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Revision != 1 || revisions[0].OriginalURL != "https://osnews.com" {
+		t.Errorf("Incorrect revisions returned. Got: %+v", revisions)
+	}
+}
+
+func TestApiReturns404ForMissingLink(t *testing.T) {
+	app := &App{
+		urls:  &mocks.ShortenerDataModel{},
+		users: &mocks.UserModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	for _, path := range []string{"/api/links?url=http://missing", "/api/links/revisions?url=http://missing"} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", mocks.MockAPIKey)
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+
+		if rs.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: got %d; want %d", path, rs.StatusCode, http.StatusNotFound)
+		}
+	}
+}
+
+func TestApiCanUpdateAndRevertLink(t *testing.T) {
+	app := &App{
+		urls:  &mocks.ShortenerDataModel{},
+		users: &mocks.UserModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/links?url=http://shorten3d", strings.NewReader(`{"original_url": "https://www.osnews.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", mocks.MockAPIKey)
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		t.Errorf("got %d; want %d", rs.StatusCode, http.StatusOK)
+	}
+
+	req, err = http.NewRequest(http.MethodPatch, ts.URL+"/api/links?url=http://shorten3d", strings.NewReader(`{"original_url": "ftp://osnews.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", mocks.MockAPIKey)
+	rs, err = ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %d; want %d", rs.StatusCode, http.StatusBadRequest)
+	}
+
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/links/revisions/revert?url=http://shorten3d&revision=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", mocks.MockAPIKey)
+	rs, err = ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		t.Errorf("got %d; want %d", rs.StatusCode, http.StatusOK)
+	}
+}
+
+func TestApiCanCreateLink(t *testing.T) {
+	app := &App{
+		urls: &mocks.ShortenerDataModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	rs, err := ts.Client().Post(ts.URL+"/api/links", "application/json", strings.NewReader(`{"original_url": "https://osnews.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusCreated {
+		t.Errorf("got %d; want %d", rs.StatusCode, http.StatusCreated)
+	}
+
+	var link LinkResponse
+	if err = json.NewDecoder(rs.Body).Decode(&link); err != nil {
+		t.Fatal(err)
+	}
+	if link.OriginalURL != "https://osnews.com" || !strings.HasPrefix(link.ShortenedURL, "https://") {
+		t.Errorf("Incorrect link returned. Got: %+v", link)
+	}
+}
+
+func TestApiCreateLinkReturnsValidationError(t *testing.T) {
+	app := &App{
+		urls: &mocks.ShortenerDataModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	rs, err := ts.Client().Post(ts.URL+"/api/links", "application/json", strings.NewReader(`{"original_url": "http://localhost/admin"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %d; want %d", rs.StatusCode, http.StatusBadRequest)
+	}
+
+	var body ErrorResponse
+	if err = json.NewDecoder(rs.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body.Error, "private or local address") {
+		t.Errorf("Incorrect error returned. Got: %s", body.Error)
+	}
+}
+
+func TestApiRateLimitsLinkCreation(t *testing.T) {
+	limiter := ratelimit.NewLimiter("create", ratelimit.Limit{Rate: 0.01, Burst: 1}, ratelimit.NewMemoryStore(), ratelimit.ClientKey(nil))
+	app := &App{
+		urls:          &mocks.ShortenerDataModel{},
+		users:         &mocks.UserModel{},
+		createLimiter: limiter,
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	for i, expected := range []int{http.StatusCreated, http.StatusTooManyRequests} {
+		rs, err := ts.Client().Post(ts.URL+"/api/links", "application/json", strings.NewReader(`{"original_url": "https://osnews.com"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+
+		if rs.StatusCode != expected {
+			t.Errorf("request %d: got %d; want %d", i+1, rs.StatusCode, expected)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/links", strings.NewReader(`{"original_url": "https://osnews.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", mocks.MockAPIKey)
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusCreated {
+		t.Errorf("Requests with a verified API key should have their own budget. Got %d; want %d", rs.StatusCode, http.StatusCreated)
+	}
+
+	rs, err = ts.Client().Get(ts.URL + "/api/links?url=http://shorten3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		t.Errorf("Reads should not be rate limited. Got %d; want %d", rs.StatusCode, http.StatusOK)
+	}
+}
+
+func TestApiCanImportLinks(t *testing.T) {
+	app := &App{
+		urls:  &mocks.ShortenerDataModel{},
+		users: &mocks.UserModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	body := "destination,alias\nhttps://go.dev,go\nhttps://osnews.com,\nftp://go.dev,\n"
+	rs, err := ts.Client().Post(ts.URL+"/api/links/import?dry_run=true", "text/csv", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Imports without an API key should be refused. Got %d; want %d", rs.StatusCode, http.StatusUnauthorized)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/links/import?dry_run=true", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("X-API-Key", mocks.MockAPIKey)
+	rs, err = ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("got %d; want %d", rs.StatusCode, http.StatusOK)
+	}
+
+	var report importer.Report
+	if err = json.NewDecoder(rs.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Created != 1 || report.Duplicates != 1 || report.Invalid != 1 {
+		t.Errorf("Incorrect report returned. Got: %+v", report)
+	}
+	if report.Results[0].ShortenedURL != "https://go" || report.Results[0].Status != importer.StatusCreated {
+		t.Errorf("Incorrect result returned. Got: %+v", report.Results[0])
+	}
+}
+
+func TestApiImportRequiresAKnownFormat(t *testing.T) {
+	app := &App{
+		urls:  &mocks.ShortenerDataModel{},
+		users: &mocks.UserModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/links/import", strings.NewReader("<links/>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("X-API-Key", mocks.MockAPIKey)
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("got %d; want %d", rs.StatusCode, http.StatusUnsupportedMediaType)
+	}
+}
+
+func TestApiCanExportLinks(t *testing.T) {
+	app := &App{
+		urls: &mocks.ShortenerDataModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL + "/api/links/export?format=csv&format_clicks=true&min_clicks=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		t.Fatalf("got %d; want %d", rs.StatusCode, http.StatusOK)
+	}
+	if contentType := rs.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("got content type %q; want text/csv", contentType)
+	}
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `http://shorten3d,https://osnews.com,"2,120"`) {
+		t.Errorf("Incorrect export returned. Got: %s", body)
+	}
+
+	for _, query := range []string{"format=xml", "created_from=yesterday", "format_clicks=maybe"} {
+		rs, err := ts.Client().Get(ts.URL + "/api/links/export?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got %d; want %d", query, rs.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestApiCanListLinksByTag(t *testing.T) {
+	app := &App{
+		urls: &mocks.ShortenerDataModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	tests := map[string]int{"/api/links": 1, "/api/links?tag=news": 1, "/api/links?tag=sport": 0, "/api/links?folder=reading": 1}
+	for path, want := range tests {
+		rs, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var links []LinkResponse
+		err = json.NewDecoder(rs.Body).Decode(&links)
+		rs.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) != want {
+			t.Errorf("%s: got %d links; want %d", path, len(links), want)
+		}
+		if len(links) > 0 && (links[0].Folder != "reading" || len(links[0].Tags) != 2) {
+			t.Errorf("%s: the link's folder and tags were not returned. Got: %+v", path, links[0])
+		}
+	}
+}
+
+func TestApiCanRetrieveTags(t *testing.T) {
+	app := &App{
+		urls: &mocks.ShortenerDataModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL + "/api/tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	var tags []TagResponse
+	if err = json.NewDecoder(rs.Body).Decode(&tags); err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Tag != "news" || tags[0].Links != 1 || tags[0].Clicks != 2120 {
+		t.Errorf("Incorrect tags returned. Got: %+v", tags)
+	}
+}
+
+func TestApiCanUpdateLinkTags(t *testing.T) {
+	app := &App{
+		urls:  &mocks.ShortenerDataModel{},
+		users: &mocks.UserModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	tests := map[string]int{
+		`{"tags": ["news", "tech"], "folder": "reading"}`: http.StatusOK,
+		`{"tags": ["not a tag"]}`:                         http.StatusBadRequest,
+		`{}`:                                              http.StatusBadRequest,
+	}
+	for body, want := range tests {
+		req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/links?url=http://shorten3d", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", mocks.MockAPIKey)
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+
+		if rs.StatusCode != want {
+			t.Errorf("%s: got %d; want %d", body, rs.StatusCode, want)
+		}
+	}
+}
+
+func TestApiCanUpdateLinkSocialCard(t *testing.T) {
+	app := &App{
+		urls:  &mocks.ShortenerDataModel{},
+		users: &mocks.UserModel{},
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	tests := map[string]int{
+		`{"og_title": "OSnews", "og_image": "https://osnews.com/card.png"}`: http.StatusOK,
+		`{"og_image": "javascript:alert(1)"}`:                               http.StatusBadRequest,
+	}
+	for body, want := range tests {
+		req, err := http.NewRequest(http.MethodPatch, ts.URL+"/api/links?url=http://shorten3d", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", mocks.MockAPIKey)
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+
+		if rs.StatusCode != want {
+			t.Errorf("%s: got %d; want %d", body, rs.StatusCode, want)
+		}
+	}
+}
+
+func TestApiAdminBackupsRequireTheToken(t *testing.T) {
+	dir := t.TempDir()
+	database := filepath.Join(dir, "test.sqlite")
+	conn, err := sql.Open("sqlite", database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.Exec(`CREATE TABLE things (name TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{
+		urls:       &mocks.ShortenerDataModel{},
+		adminToken: "an-admin-token-for-tests",
+		backups:    &backup.Manager{Database: database, Dir: filepath.Join(dir, "backups")},
+	}
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name, method, token string
+		status              int
+	}{
+		{"no token", http.MethodPost, "", http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "not-the-admin-token", http.StatusUnauthorized},
+		{"create", http.MethodPost, "an-admin-token-for-tests", http.StatusCreated},
+		{"list", http.MethodGet, "an-admin-token-for-tests", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+"/api/admin/backups", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			if rs.StatusCode != tt.status {
+				t.Errorf("got %d; want %d", rs.StatusCode, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && rs.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Error("Expected the response to ask for a bearer token")
+			}
+		})
+	}
+
+	backups, err := app.backups.List()
+	if err != nil || len(backups) != 1 {
+		t.Errorf("Expected one backup to be taken. Got %d (%v)", len(backups), err)
+	}
+
+	// Without a token, the admin API isn't served
+	ts = httptest.NewTLSServer((&App{urls: &mocks.ShortenerDataModel{}, backups: app.backups}).Routes())
+	defer ts.Close()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/admin/backups", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode == http.StatusCreated || rs.StatusCode == http.StatusUnauthorized {
+		t.Errorf("Expected the admin API to be disabled. Got %d", rs.StatusCode)
+	}
+}
+
+func TestApiCannotRevertToABlockedDestination(t *testing.T) {
+	blocked, err := blocklist.Load("./testdata/blocklist.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{
+		urls:      &mocks.ShortenerDataModel{},
+		users:     &mocks.UserModel{},
+		blocklist: blocked,
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/links/revisions/revert?url=http://shorten3d&revision=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", mocks.MockAPIKey)
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %d; want %d", rs.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// createdLinks is a model which records the changes made to the links that
+// it creates, and refuses to change links any other way
+type createdLinks struct {
+	*mocks.ShortenerDataModel
+	created []models.LinkChange
+}
+
+func (c *createdLinks) Create(original, shortened string, change models.LinkChange, actor string) error {
+	c.created = append(c.created, change)
+	return nil
+}
+
+func (c *createdLinks) SetTags(shortened string, tags []string) error {
+	return errors.New("tags should be set when the link is created")
+}
+
+func (c *createdLinks) SetDetails(shortened string, details models.LinkDetails) error {
+	return errors.New("details should be set when the link is created")
+}
+
+func TestApiCreatesLinksWithTheirTagsAndDetailsAtOnce(t *testing.T) {
+	urls := &createdLinks{ShortenerDataModel: &mocks.ShortenerDataModel{}}
+	app := &App{
+		urls: urls,
+	}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	rs, err := ts.Client().Post(ts.URL+"/api/links", "application/json", strings.NewReader(`{"original_url": "https://go.dev", "tags": ["go"], "title": "Go"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if len(urls.created) != 1 || urls.created[0].Tags == nil || (*urls.created[0].Tags)[0] != "go" || *urls.created[0].Title != "Go" {
+		t.Errorf("Expected the tags and title to be set as the link was created. Got: %+v", urls.created)
+	}
+}
@@ -1,54 +1,261 @@
 package application
 
 import (
+	"context"
 	"database/sql"
+	"encoding/gob"
+	"errors"
 	"fmt"
+	"gourlshortener/internals/backup"
+	"gourlshortener/internals/blocklist"
+	"gourlshortener/internals/health"
+	"gourlshortener/internals/i18n"
+	"gourlshortener/internals/metadata"
 	"gourlshortener/internals/models"
-	"gourlshortener/internals/utils"
+	"gourlshortener/internals/ratelimit"
+	"gourlshortener/internals/shortcode"
+	"gourlshortener/internals/validation"
+	"gourlshortener/static"
+	"gourlshortener/templates"
+	"html/template"
+	"io/fs"
+	"net"
 	"net/http"
 	"net/url"
-	"text/template"
 	"time"
 
-	urlverifier "github.com/davidmytton/url-verifier"
 	"github.com/gorilla/sessions"
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 )
 
 // PageData stores the template data for the default route
-//
-// This is the original URL that was submitted in the form, if any,
-// the shortened URL version of the original URL, if the form was
-// processed, and a list of already shortened URLs along with the
-// number of times the shortened URL was clicked.
 type PageData struct {
+	// The URL submitted in the form, and the link it was shortened to
 	Error, OriginalURL, ShortenedURL string
-	URLData                          []*models.ShortenerData
+	PublicURL                        string
+
+	// The links shown, filtered by Tag and Folder, and searched for Query
+	URLData            []*models.ShortenerData
+	Tag, Folder, Query string
+
+	// The tags and folders which the links can be filtered by
+	Tags    []*models.TagStats
+	Folders []string
+
+	// The health of the links which have been checked, by shortened URL
+	Health map[string]*models.LinkHealth
+}
+
+// ShortenFlash is flashed to the default route after the shortener form is
+// processed. It carries the link which was created or, if the URL couldn't be
+// shortened, the URL which was submitted, so that it can be corrected.
+type ShortenFlash struct {
+	OriginalURL, ShortenedURL string
 }
 
-func serverError(w http.ResponseWriter, err error) {
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+func init() {
+	// Flashes are gob encoded into the session cookie
+	gob.Register(ShortenFlash{})
 }
 
-// App models the core aspects of the application
-//
-// It has a connection to the database models, a connection to the session, and
-// the location of the template and static directories.
+// App models the core aspects of the application. Everything but its models
+// and session store is optional, and set with an Option.
 type App struct {
-	urls                       models.ShortenerDataInterface
-	store                      *sessions.CookieStore
-	templateBaseDir, staticDir string
+	urls  models.ShortenerDataInterface
+	users models.UserDataInterface
+	store *sessions.CookieStore
+
+	// How pages look, and which language they're in
+	templates, static, theme fs.FS
+	site                     *Site
+	localizer                *i18n.Localizer
+
+	// How links are checked before they're created or followed
+	validator *validation.Pipeline
+	blocklist *blocklist.Blocklist
+
+	// How requests are limited and secured
+	createLimiter, redirectLimiter *ratelimit.Limiter
+	securityHeaders                *SecurityHeaders
+	trustedProxies                 []*net.IPNet
+
+	// How new links are made
+	baseURL string
+	fetcher *metadata.Fetcher
+	codes   *shortcode.Allocator
+
+	// How the application is run
+	adminToken  string
+	backups     *backup.Manager
+	maintenance *Maintenance
+	checker     *health.Checker
+	brokenAfter int
+}
+
+// Option configures an optional aspect of an App
+type Option func(*App)
+
+// WithURLs sets the model which links are stored in, instead of one which
+// reads and writes through the database passed to NewApp, e.g., to read from
+// a separate pool of connections
+func WithURLs(urls models.ShortenerDataInterface) Option {
+	return func(a *App) {
+		a.urls = urls
+	}
+}
+
+// WithValidator sets the pipeline used to validate URLs before they're
+// shortened, or before a shortened URL's destination is changed
+func WithValidator(validator *validation.Pipeline) Option {
+	return func(a *App) {
+		a.validator = validator
+	}
+}
+
+// WithBlocklist sets the blocklist which URLs are checked against, both when
+// they're shortened and when they're redirected to
+func WithBlocklist(blocklist *blocklist.Blocklist) Option {
+	return func(a *App) {
+		a.blocklist = blocklist
+	}
+}
+
+// WithRateLimiters sets the rate limiters applied to requests which create or
+// change links, and to requests which follow shortened URLs. Either can be
+// nil, to not limit those requests.
+func WithRateLimiters(create, redirect *ratelimit.Limiter) Option {
+	return func(a *App) {
+		a.createLimiter = create
+		a.redirectLimiter = redirect
+	}
+}
+
+// WithMetadataFetcher sets the fetcher used to fill in the title and
+// description of new links, in the background, from their destinations. If
+// it's not set, they're not fetched.
+func WithMetadataFetcher(fetcher *metadata.Fetcher) Option {
+	return func(a *App) {
+		a.fetcher = fetcher
+	}
+}
+
+// WithCodeAllocator sets the allocator which generates the codes of new links
+func WithCodeAllocator(codes *shortcode.Allocator) Option {
+	return func(a *App) {
+		a.codes = codes
+	}
+}
+
+// WithTemplates sets the file system which the templates are read from,
+// instead of those embedded in the binary, e.g., to theme the application
+func WithTemplates(files fs.FS) Option {
+	return func(a *App) {
+		a.templates = files
+	}
+}
+
+// WithStaticFiles sets the file system which the static assets are served
+// from, instead of those embedded in the binary
+func WithStaticFiles(files fs.FS) Option {
+	return func(a *App) {
+		a.static = files
+	}
 }
 
 // NewApp initialises a fully-functional App instance
-func NewApp(db *sql.DB, authKey, templateBaseDir, staticDir string) App {
-	return App{
-		urls:            &models.ShortenerDataModel{DB: db},
-		store:           sessions.NewCookieStore([]byte(authKey)),
-		templateBaseDir: templateBaseDir,
-		staticDir:       staticDir,
+func NewApp(db *sql.DB, authKey string, options ...Option) App {
+	app := App{
+		urls:  &models.ShortenerDataModel{DB: db},
+		users: &models.UserModel{DB: db},
+		store: sessions.NewCookieStore([]byte(authKey)),
+	}
+	for _, option := range options {
+		option(&app)
 	}
+
+	return app
+}
+
+// defaultValidator validates URLs for Apps which weren't configured with a
+// validation pipeline. It doesn't require network access.
+var defaultValidator = validation.New(validation.DefaultConfig())
+
+// urlValidator returns the App's URL validation pipeline, falling back to the
+// default pipeline if one wasn't configured
+func (a *App) urlValidator() *validation.Pipeline {
+	if a.validator == nil {
+		return defaultValidator
+	}
+	return a.validator
+}
+
+// templateFiles returns the file system which the App's templates are read
+// from, falling back to the embedded templates if one wasn't configured, with
+// the theme's templates in front of it
+func (a *App) templateFiles() fs.FS {
+	if a.templates == nil {
+		return a.themed(templates.FS, "templates")
+	}
+	return a.themed(a.templates, "templates")
+}
+
+// staticFiles returns the file system which the App's static assets are
+// served from, falling back to the embedded assets if one wasn't configured,
+// with the theme's static assets in front of it
+func (a *App) staticFiles() fs.FS {
+	if a.static == nil {
+		return a.themed(static.FS, "static")
+	}
+	return a.themed(a.static, "static")
+}
+
+// defaultCodes generates the codes of new links for Apps which weren't
+// configured with a code allocator
+var defaultCodes = shortcode.NewAllocator(shortcode.NewRandom(shortcode.Base62), shortcode.DefaultLength)
+
+// codeAllocator returns the App's code allocator, falling back to the default
+// allocator if one wasn't configured
+func (a *App) codeAllocator() *shortcode.Allocator {
+	if a.codes == nil {
+		return defaultCodes
+	}
+	return a.codes
+}
+
+// ValidateURL runs the supplied URL through the App's validation pipeline and
+// blocklist, returning the normalised URL if it passed both
+func (a *App) ValidateURL(ctx context.Context, rawURL string) (string, error) {
+	normalisedURL, err := a.urlValidator().Validate(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if a.blocklist != nil {
+		u, err := url.Parse(normalisedURL)
+		if err != nil {
+			return "", err
+		}
+		if err = a.blocklist.Validate(ctx, u); err != nil {
+			return "", err
+		}
+	}
+
+	return normalisedURL, nil
+}
+
+// validationMessage returns a message explaining why a URL failed validation,
+// suitable for showing to the user, or fallback if err isn't a validation
+// error. It's translated into the locale's language, unless locale is nil.
+func validationMessage(locale *i18n.Locale, err error, fallback string) string {
+	var validationErr *validation.Error
+	if !errors.As(err, &validationErr) {
+		return translate(locale, fallback)
+	}
+	if locale == nil || validationErr.Format == "" {
+		return validationErr.Message
+	}
+	return locale.T(validationErr.Format, validationErr.Args...)
 }
 
 func (a *App) setErrorInFlash(error string, w http.ResponseWriter, r *http.Request) {
@@ -60,36 +267,82 @@ func (a *App) setErrorInFlash(error string, w http.ResponseWriter, r *http.Reque
 	session.Save(r, w)
 }
 
+// setShortenInFlash flashes the outcome of the shortener form, along with an
+// error message, if there is one
+func (a *App) setShortenInFlash(flash ShortenFlash, error string, w http.ResponseWriter, r *http.Request) {
+	session, err := a.store.Get(r, "flash-session")
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	session.AddFlash(flash, "shorten")
+	if error != "" {
+		session.AddFlash(error, "error")
+	}
+	session.Save(r, w)
+}
+
 // getDefaultRoute retrieves a list of the stored shortened URLS and
 // renders them in a table on the default route, along with a form for
 // shortening a URL.
 func (a *App) getDefaultRoute(w http.ResponseWriter, r *http.Request) {
-	tmplFile := fmt.Sprintf("%s/default.html", a.templateBaseDir)
-	tmpl, err := template.New("default.html").
-		Funcs(template.FuncMap{
-			"formatClicks": utils.FormatClicks,
-		}).
-		ParseFiles(tmplFile)
+	tmpl, err := a.parseTemplate(r, "default.html", template.FuncMap{
+		"qrPath":      qrPath,
+		"previewPath": previewPath,
+	})
 	if err != nil {
 		fmt.Println(err.Error())
-		serverError(w, err)
+		a.serverError(w, r, err)
 		return
 	}
 
-	urls, err := a.urls.Latest()
+	filter := models.LinkFilter{
+		Tag:    r.URL.Query().Get("tag"),
+		Folder: r.URL.Query().Get("folder"),
+		Query:  r.URL.Query().Get("q"),
+	}
+	urls, err := a.urls.List(filter)
 	if err != nil {
 		fmt.Printf("Could not retrieve all URLs, because %s.\n", err)
+		a.serverError(w, r, err)
+		return
+	}
+
+	tags, err := a.urls.Tags()
+	if err != nil {
+		fmt.Printf("Could not retrieve the tags, because %s.\n", err)
+		a.serverError(w, r, err)
+		return
+	}
+
+	folders, err := a.urls.Folders()
+	if err != nil {
+		fmt.Printf("Could not retrieve the folders, because %s.\n", err)
+		a.serverError(w, r, err)
+		return
+	}
+
+	linkHealth, err := a.urls.AllHealth()
+	if err != nil {
+		fmt.Printf("Could not retrieve the links' health, because %s.\n", err)
+		a.serverError(w, r, err)
 		return
 	}
 
 	session, err := a.store.Get(r, "flash-session")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
 		return
 	}
 
 	pageData := PageData{
 		URLData: urls,
+		Tag:     filter.Tag,
+		Folder:  filter.Folder,
+		Query:   filter.Query,
+		Tags:    tags,
+		Folders: folders,
+		Health:  linkHealth,
 	}
 
 	fm := session.Flashes("error")
@@ -100,84 +353,158 @@ func (a *App) getDefaultRoute(w http.ResponseWriter, r *http.Request) {
 			fmt.Printf("Session flash did not contain an error message. Contained %s.\n", fm[0])
 		}
 	}
+	fm = session.Flashes("shorten")
+	if fm != nil {
+		if flash, ok := fm[0].(ShortenFlash); ok {
+			pageData.OriginalURL = flash.OriginalURL
+			pageData.ShortenedURL = flash.ShortenedURL
+			if flash.ShortenedURL != "" {
+				pageData.PublicURL = a.PublicURL(r, flash.ShortenedURL)
+			}
+		} else {
+			fmt.Printf("Session flash did not contain the shortened link. Contained %v.\n", fm[0])
+		}
+	}
 	session.Save(r, w)
 
 	err = tmpl.Execute(w, pageData)
 	if err != nil {
 		fmt.Println(err.Error())
-		serverError(w, err)
+		a.serverError(w, r, err)
 	}
 }
 
 // shortenURL processes the URL shortener form. It generates a shortened
 // URL for the original URL and stores them both in the database. After
-// the details have been saved, the user is redirected to the default route.
+// the details have been saved, the user is redirected to the default route,
+// which confirms the new link. If the URL couldn't be shortened, it's
+// redirected back to the form instead, so that it can be corrected.
 func (a *App) shortenURL(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
 		fmt.Println(err.Error())
-		serverError(w, err)
+		a.serverError(w, r, err)
 		return
 	}
 
 	originalURL := r.PostForm.Get("url")
-	if originalURL == "" {
-		a.setErrorInFlash("Please provide a URL to shorten.", w, r)
+	urlData, err := a.CreateLink(r.Context(), originalURL)
+	if err != nil {
+		fmt.Println(err.Error())
+		flash := ShortenFlash{OriginalURL: originalURL}
+		a.setShortenInFlash(flash, validationMessage(a.locale(r), err, "We weren't able to shorten the URL."), w, r)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	// Verify if the URL supplied is a genuine and workable URL
-	verifier := urlverifier.NewVerifier()
-	verifier.EnableHTTPCheck()
-	result, err := verifier.Verify(originalURL)
+	flash := ShortenFlash{OriginalURL: urlData.OriginalURL, ShortenedURL: urlData.ShortenedURL}
+	a.setShortenInFlash(flash, "", w, r)
 
-	if err != nil || !result.HTTP.IsSuccess {
-		fmt.Println(err.Error())
-		a.setErrorInFlash("The URL was not reachable.", w, r)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+	// Redirect to the default route
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// CreateLink validates the original URL, generates a shortened URL for it,
+// and stores them both, generating another if the code is already in use. If
+// the original URL fails validation, or is on the blocklist, the returned
+// error is a *validation.Error. If the App has a metadata fetcher, the link's
+// title and description are then fetched in the background.
+func (a *App) CreateLink(ctx context.Context, originalURL string) (*models.ShortenerData, error) {
+	return a.createLink(ctx, originalURL, nil, models.SystemActor)
+}
+
+// createLink creates a link as CreateLink does. If change isn't nil, it's
+// made in the same transaction as the link is inserted in, attributed to
+// actor.
+func (a *App) createLink(ctx context.Context, originalURL string, change *models.LinkChange, actor string) (*models.ShortenerData, error) {
+	originalURL, err := a.ValidateURL(ctx, originalURL)
+	if err != nil {
+		return nil, err
 	}
 
 	parsedURL, err := url.Parse(originalURL)
 	if err != nil {
-		fmt.Println(err.Error())
-		serverError(w, err)
-		return
+		return nil, err
 	}
-	shortenedURL := parsedURL.Scheme + "://" + utils.GenerateShortenedURL()
-
-	_, err = a.urls.Insert(originalURL, shortenedURL, 0)
+	var shortenedURL string
+	_, err = a.codeAllocator().Allocate(func(code string) error {
+		shortenedURL = parsedURL.Scheme + "://" + code
+		var err error
+		if change == nil {
+			_, err = a.urls.Insert(originalURL, shortenedURL, 0)
+		} else {
+			err = a.urls.Create(originalURL, shortenedURL, *change, actor)
+		}
+		if errors.Is(err, models.ErrDuplicateCode) {
+			return shortcode.ErrCollision
+		}
+		return err
+	})
 	if err != nil {
-		fmt.Println(err.Error())
-		a.setErrorInFlash("We weren't able to shorten the URL.", w, r)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil, err
 	}
 
-	//fmt.Printf("Redirecting to the default route, after shortening %s to %s and persisting it.", originalURL, shortenedURL)
+	if a.fetcher != nil {
+		go a.fetchDetails(shortenedURL, originalURL)
+	}
 
-	// Redirect to the default route
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	return &models.ShortenerData{OriginalURL: originalURL, ShortenedURL: shortenedURL}, nil
 }
 
 // openShortenedRoute retrieves the original URL from the shortened URL provided
 // and, if retrieved from the database, redirects the user to the shortened URL.
+// If the original URL has since been added to the blocklist, the user is shown
+// a warning instead. Links which don't exist show the 404 or 410 page.
 func (a *App) openShortenedRoute(w http.ResponseWriter, r *http.Request) {
 	shortenedURL := r.URL.Query().Get("url")
 	fmt.Printf("Attempting to retrieve %s.\n", shortenedURL)
 
 	urlData, err := a.urls.Get(shortenedURL)
+	if errors.Is(err, models.ErrNoRecord) {
+		if a.wasDeleted(models.Code(shortenedURL)) {
+			a.gone(w, r)
+			return
+		}
+		a.notFound(w, r)
+		return
+	}
 	if err != nil {
 		fmt.Println(err.Error())
-		serverError(w, err)
+		a.serverError(w, r, err)
+		return
+	}
+
+	a.redirect(w, r, urlData)
+}
+
+// redirect redirects the user to a link's destination, counting the click.
+// If the user asked for the link's preview page, or the link is set to always
+// show it, and the user didn't follow it from there, the preview page is
+// shown instead. If the destination has since been added to the blocklist,
+// the user is shown a warning instead.
+func (a *App) redirect(w http.ResponseWriter, r *http.Request, urlData *models.ShortenerData) {
+	if isCrawler(r.UserAgent()) {
+		a.socialCard(w, r, urlData)
 		return
 	}
 
-	err = a.urls.IncrementClicks(shortenedURL)
+	if wantsPreview(r) || !confirmed(r) && a.alwaysPreview(urlData) {
+		a.preview(w, r, urlData)
+		return
+	}
+
+	if a.blocklist != nil {
+		if rule, blocked := a.blocklist.Match(urlData.OriginalURL); blocked {
+			fmt.Printf("Not redirecting to %s, as it matches blocklist rule %s (%s:%d).\n", urlData.OriginalURL, rule.Pattern, rule.File, rule.Line)
+			a.blocked(w, r, urlData)
+			return
+		}
+	}
+
+	err := a.recordClick(urlData.ShortenedURL)
 	if err != nil {
 		fmt.Println(err.Error())
-		serverError(w, err)
+		a.serverError(w, r, err)
 		return
 	}
 
@@ -188,18 +515,23 @@ func (a *App) openShortenedRoute(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *App) notFound(w http.ResponseWriter, r *http.Request) {
-	tmplFile := fmt.Sprintf("%s/404.html", a.templateBaseDir)
-	tmpl, err := template.New("404.html").ParseFiles(tmplFile)
+	a.renderError(w, r, http.StatusNotFound)
+}
+
+// blocked renders a warning, instead of redirecting, when a shortened URL's
+// destination is on the blocklist
+func (a *App) blocked(w http.ResponseWriter, r *http.Request, urlData *models.ShortenerData) {
+	tmpl, err := a.parseTemplate(r, "blocked.html", nil)
 	if err != nil {
 		fmt.Println(err.Error())
-		serverError(w, err)
+		a.serverError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusNotFound)
-	err = tmpl.Execute(w, nil)
+	w.WriteHeader(http.StatusForbidden)
+	err = tmpl.Execute(w, urlData)
 	if err != nil {
 		fmt.Println(err.Error())
-		serverError(w, err)
+		a.serverError(w, r, err)
 	}
 }
 
@@ -208,20 +540,64 @@ func (a *App) ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(fmt.Sprintf("%d", t.Unix())))
 }
 
+// limit returns middleware which applies the supplied rate limiter, rendering
+// the 429 Too Many Requests page to clients which are limited, or which does
+// nothing if the limiter is nil
+func (a *App) limit(limiter *ratelimit.Limiter) alice.Constructor {
+	if limiter == nil {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+	return limiter.RejectWith(a.tooManyRequests)
+}
+
 // Routes creates the application's routing table
 func (a *App) Routes() http.Handler {
 	router := httprouter.New()
-	fileServer := http.FileServer(http.Dir(a.staticDir))
+	fileServer := http.FileServer(http.FS(a.staticFiles()))
 	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
 
+	writes := alice.New(a.limit(a.createLimiter), a.refuseInMaintenance)
+	edits := writes.Append(a.requireUser)
+	redirects := alice.New(a.limit(a.redirectLimiter))
+
 	router.HandlerFunc(http.MethodGet, "/", a.getDefaultRoute)
-	router.HandlerFunc(http.MethodGet, "/open", a.openShortenedRoute)
-	router.HandlerFunc(http.MethodPost, "/", a.shortenURL)
+	router.Handler(http.MethodGet, "/open", redirects.ThenFunc(a.openShortenedRoute))
+	router.Handler(http.MethodPost, "/", writes.ThenFunc(a.shortenURL))
+	router.HandlerFunc(http.MethodGet, "/links/history", a.getHistoryRoute)
+	router.HandlerFunc(http.MethodGet, "/links/import", a.getImportRoute)
+	router.Handler(http.MethodPost, "/links/import", edits.ThenFunc(a.importLinks))
+	router.Handler(http.MethodPost, "/links/update", edits.ThenFunc(a.updateURL))
+	router.Handler(http.MethodPost, "/links/revert", edits.ThenFunc(a.revertURL))
+	router.Handler(http.MethodPost, "/links/settings", edits.ThenFunc(a.updateSettings))
+	router.Handler(http.MethodPost, "/links/organise", edits.ThenFunc(a.organiseURL))
+	router.Handler(http.MethodPost, "/links/details", edits.ThenFunc(a.updateDetails))
+	router.Handler(http.MethodPost, "/links/social", edits.ThenFunc(a.updateSocialCard))
+	router.HandlerFunc(http.MethodGet, "/login", a.getSignInRoute)
+	router.Handler(http.MethodPost, "/login", alice.New(a.limit(a.createLimiter)).ThenFunc(a.signIn))
+	router.HandlerFunc(http.MethodPost, "/logout", a.signOut)
+	router.HandlerFunc(http.MethodPost, "/language", a.setLanguage)
 	router.HandlerFunc(http.MethodGet, "/api/ping", a.ping)
-	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		a.notFound(w, r)
-	})
-	standard := alice.New()
+	router.HandlerFunc(http.MethodGet, "/api/links", a.apiGetLink)
+	router.Handler(http.MethodPost, "/api/links", writes.ThenFunc(a.apiCreateLink))
+	router.Handler(http.MethodPatch, "/api/links", edits.ThenFunc(a.apiUpdateLink))
+	router.HandlerFunc(http.MethodGet, "/api/links/export", a.apiExportLinks)
+	router.Handler(http.MethodPost, "/api/links/import", edits.ThenFunc(a.apiImportLinks))
+	router.Handler(http.MethodGet, "/api/links/revisions", alice.New(a.requireUser).ThenFunc(a.apiGetRevisions))
+	router.HandlerFunc(http.MethodGet, "/api/tags", a.apiGetTags)
+	router.Handler(http.MethodPost, "/api/links/revisions/revert", edits.ThenFunc(a.apiRevertLink))
+	if a.adminToken != "" {
+		admin := alice.New(a.requireAdmin)
+		router.Handler(http.MethodGet, "/api/admin/maintenance", admin.ThenFunc(a.apiGetMaintenance))
+		router.Handler(http.MethodPut, "/api/admin/maintenance", admin.ThenFunc(a.apiSetMaintenance))
+		if a.backups != nil {
+			router.Handler(http.MethodGet, "/api/admin/backups", admin.ThenFunc(a.apiListBackups))
+			router.Handler(http.MethodPost, "/api/admin/backups", admin.ThenFunc(a.apiCreateBackup))
+		}
+	}
+	router.NotFound = a.codeRoutes(redirects, http.HandlerFunc(a.notFound))
+	standard := alice.New(a.secureHeaders, a.authenticate)
 
 	return standard.Then(router)
 }
@@ -0,0 +1,242 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/models"
+	"gourlshortener/internals/ratelimit"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// WithUsers sets the model which users and their API keys are stored in,
+// instead of one which reads through the database passed to NewApp
+func WithUsers(users models.UserDataInterface) Option {
+	return func(a *App) {
+		a.users = users
+	}
+}
+
+// authSession is the name of the session which remembers the API key that
+// the user signed in with
+const authSession = "auth-session"
+
+// signInLifetime is how long a user stays signed in
+const signInLifetime = 12 * time.Hour
+
+// contextKey is the type of the keys of the values which the App stores in a
+// request's context
+type contextKey string
+
+// identityKey is the context key of the API key which authenticated a request
+const identityKey contextKey = "identity"
+
+// identity returns the API key which authenticated a request, either with
+// its X-API-Key header, or by signing in, or nil if it wasn't authenticated
+func identity(r *http.Request) *models.APIKey {
+	key, _ := r.Context().Value(identityKey).(*models.APIKey)
+	return key
+}
+
+// signedIn returns the name of the user who authenticated a request, or an
+// empty string if it wasn't authenticated
+func signedIn(r *http.Request) string {
+	if key := identity(r); key != nil {
+		return key.User
+	}
+	return ""
+}
+
+// actor identifies who made a request, so that changes can be attributed in
+// a link's revision history. Authenticated requests are attributed to the
+// user and the ID of their API key, and all others to the client's address.
+func (a *App) actor(r *http.Request) string {
+	if key := identity(r); key != nil {
+		return key.Actor()
+	}
+	return "anonymous@" + ratelimit.ClientIP(r, a.trustedProxies)
+}
+
+// authenticate is middleware which identifies the API key that authenticated
+// a request, from its X-API-Key header, or from the session of a user who
+// signed in, so that the key also has its own rate limit budget. Requests
+// with an invalid X-API-Key header are rejected.
+func (a *App) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.users == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var (
+			key *models.APIKey
+			err error
+		)
+		if header := r.Header.Get("X-API-Key"); header != "" {
+			key, err = a.users.Authenticate(header)
+			if err != nil {
+				if !errors.Is(err, models.ErrNoRecord) {
+					fmt.Println(err.Error())
+				}
+				apiError(w, http.StatusUnauthorized, "the API key isn't valid")
+				return
+			}
+		} else if a.store != nil {
+			session, _ := a.store.Get(r, authSession)
+			if id, ok := session.Values["key"].(int); ok {
+				key, err = a.users.Key(id)
+				if err != nil && !errors.Is(err, models.ErrNoRecord) {
+					fmt.Println(err.Error())
+				}
+			}
+		}
+
+		if key != nil {
+			r = r.WithContext(context.WithValue(r.Context(), identityKey, key))
+			r = ratelimit.WithAPIKey(r, key.ID)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireUser is middleware which only lets authenticated requests through.
+// Others are refused with JSON for API requests, and are sent to the sign in
+// page otherwise.
+func (a *App) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity(r) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Set("WWW-Authenticate", `ApiKey header="X-API-Key"`)
+			apiError(w, http.StatusUnauthorized, "an API key is required")
+			return
+		}
+
+		returnTo := "/"
+		if err := r.ParseForm(); err == nil && r.PostForm.Get("url") != "" {
+			returnTo = historyRoute(r.PostForm.Get("url"))
+		}
+		a.setErrorInFlash(a.locale(r).T("Please sign in to change links."), w, r)
+		http.Redirect(w, r, signInRoute(returnTo), http.StatusSeeOther)
+	})
+}
+
+// signInRoute returns the path of the sign in page, which returns the user to
+// next once they've signed in
+func signInRoute(next string) string {
+	return "/login?next=" + url.QueryEscape(next)
+}
+
+// localPath returns next if it's a path on this site, or the default route,
+// so that the sign in page can't redirect users elsewhere
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// SignInPageData stores the template data for the sign in page
+type SignInPageData struct {
+	Error, Next string
+}
+
+// getSignInRoute renders the form for signing in with an API key
+func (a *App) getSignInRoute(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := a.parseTemplate(r, "login.html", nil)
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	session, err := a.store.Get(r, "flash-session")
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+	pageData := SignInPageData{Next: localPath(r.URL.Query().Get("next"))}
+	if fm := session.Flashes("error"); fm != nil {
+		if error, ok := fm[0].(string); ok {
+			pageData.Error = error
+		}
+	}
+	session.Save(r, w)
+
+	err = tmpl.Execute(w, pageData)
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+	}
+}
+
+// signIn processes the sign in form, remembering the API key in the user's
+// session, then redirects the user to the page which they were going to
+func (a *App) signIn(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+	next := localPath(r.PostForm.Get("next"))
+
+	if a.users == nil {
+		a.notFound(w, r)
+		return
+	}
+	key, err := a.users.Authenticate(r.PostForm.Get("key"))
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			fmt.Println(err.Error())
+		}
+		a.setErrorInFlash(a.locale(r).T("That API key isn't valid."), w, r)
+		http.Redirect(w, r, signInRoute(next), http.StatusSeeOther)
+		return
+	}
+
+	session, _ := a.store.Get(r, authSession)
+	session.Options = a.authSessionOptions(r, int(signInLifetime.Seconds()))
+	session.Values["key"] = key.ID
+	if err = session.Save(r, w); err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// signOut forgets the API key in the user's session, then redirects the user
+// to the default route
+func (a *App) signOut(w http.ResponseWriter, r *http.Request) {
+	session, _ := a.store.Get(r, authSession)
+	session.Options = a.authSessionOptions(r, -1)
+	session.Values = map[interface{}]interface{}{}
+	if err := session.Save(r, w); err != nil {
+		fmt.Println(err.Error())
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// authSessionOptions returns the options of the session cookie which
+// remembers the signed in user, which expires after maxAge seconds
+func (a *App) authSessionOptions(r *http.Request, maxAge int) *sessions.Options {
+	return &sessions.Options{
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   a.isHTTPS(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,186 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"gourlshortener/internals/models"
+	"gourlshortener/internals/qr"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/justinas/alice"
+)
+
+// WithBaseURL sets the public URL that the application is served from, e.g.,
+// https://go.example. Public short URLs, such as those in QR codes, are the
+// base URL followed by a link's code. If it isn't set, it's taken from each
+// request.
+func WithBaseURL(baseURL string) Option {
+	return func(a *App) {
+		a.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// PublicURL returns the public short URL of a shortened URL, which redirects
+// to its destination
+func (a *App) PublicURL(r *http.Request, shortened string) string {
+	baseURL := a.baseURL
+	if baseURL == "" {
+		scheme := "http"
+		if a.isHTTPS(r) {
+			scheme = "https"
+		}
+		baseURL = scheme + "://" + r.Host
+	}
+	return baseURL + "/" + url.PathEscape(models.Code(shortened))
+}
+
+// codeRoutes returns a handler for the routes which start with a link's code,
+// which httprouter can't route alongside the application's other routes. It
+// serves GET /{code}, which redirects to the link's destination, through the
+// redirects middleware, GET /{code}+, which renders the link's preview page,
+// and GET /{code}/qr, which renders the link's QR code. Every other request
+// is passed to notFound.
+func (a *App) codeRoutes(redirects alice.Chain, notFound http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+
+		// Codes can contain escaped slashes, so the escaped path is split
+		segments := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+		code, err := url.PathUnescape(segments[0])
+		if err != nil || code == "" || len(segments) > 2 {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+
+		switch {
+		case len(segments) == 1:
+			redirects.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+				a.openCode(w, r, code)
+			}).ServeHTTP(w, r)
+		case segments[1] == "qr":
+			a.qrCode(w, r, code)
+		default:
+			notFound.ServeHTTP(w, r)
+		}
+	})
+}
+
+// qrPath returns the path of a shortened URL's QR code
+func qrPath(shortened string) string {
+	return "/" + url.PathEscape(models.Code(shortened)) + "/qr"
+}
+
+// previewPath returns the path of a shortened URL's preview page
+func previewPath(shortened string) string {
+	return "/" + url.PathEscape(models.Code(shortened)) + "+"
+}
+
+// getByCode retrieves the link with the supplied code, rendering the not
+// found page, the gone page if the link was deleted, or an error, if it can't
+// be retrieved
+func (a *App) getByCode(w http.ResponseWriter, r *http.Request, code string) (*models.ShortenerData, bool) {
+	urlData, err := a.urls.GetByCode(code)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			if a.wasDeleted(code) {
+				a.gone(w, r)
+				return nil, false
+			}
+			a.notFound(w, r)
+			return nil, false
+		}
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return nil, false
+	}
+	return urlData, true
+}
+
+// openCode redirects to the destination of the link with the supplied code.
+// As codes can end with a "+", a code ending with one is only treated as a
+// request for the preview page of the code without it if no link has the
+// code itself.
+func (a *App) openCode(w http.ResponseWriter, r *http.Request, code string) {
+	if strings.HasSuffix(code, "+") {
+		if _, err := a.urls.GetByCode(code); errors.Is(err, models.ErrNoRecord) {
+			if urlData, ok := a.getByCode(w, r, strings.TrimSuffix(code, "+")); ok {
+				a.preview(w, r, urlData)
+			}
+			return
+		}
+	}
+
+	if urlData, ok := a.getByCode(w, r, code); ok {
+		a.redirect(w, r, urlData)
+	}
+}
+
+// qrCode renders a QR code of a link's public short URL, as a PNG or SVG
+// image. The format, size, level, and margin query parameters configure the
+// image, and setting download to true makes browsers download it.
+func (a *App) qrCode(w http.ResponseWriter, r *http.Request, code string) {
+	query := r.URL.Query()
+	options := qr.DefaultOptions()
+	if format := query.Get("format"); format != "" {
+		options.Format = strings.ToLower(format)
+	}
+	if level := query.Get("level"); level != "" {
+		options.Level = level
+	}
+	for name, value := range map[string]*int{"size": &options.Size, "margin": &options.Margin} {
+		if raw := query.Get(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				http.Error(w, name+" must be a whole number", http.StatusBadRequest)
+				return
+			}
+			*value = n
+		}
+	}
+	if err := options.Validate(); err != nil {
+		http.Error(w, strings.TrimPrefix(err.Error(), "qr: "), http.StatusBadRequest)
+		return
+	}
+
+	urlData, ok := a.getByCode(w, r, code)
+	if !ok {
+		return
+	}
+
+	image, err := qr.Encode(a.PublicURL(r, urlData.ShortenedURL), options)
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", qr.ContentType(options.Format))
+	if a.baseURL == "" {
+		// The code's URL comes from the request's host, so caches mustn't
+		// share it with requests for other hosts
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		w.Header().Add("Vary", "Host")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+	if download, _ := strconv.ParseBool(query.Get("download")); download {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, qrFilename(code), options.Format))
+	}
+	w.Write(image)
+}
+
+// qrFilename returns a safe file name for a link's QR code
+func qrFilename(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, code) + "-qr"
+}
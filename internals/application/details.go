@@ -0,0 +1,82 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/i18n"
+	"gourlshortener/internals/metadata"
+	"gourlshortener/internals/models"
+	"net/http"
+)
+
+// fetchDetails fetches the title and description of a link's destination,
+// and fills in the link's title and description with them, if they're empty.
+// They aren't filled in if maintenance mode was turned on during the fetch.
+func (a *App) fetchDetails(shortened, original string) {
+	timeout := a.fetcher.Client.Timeout
+	if timeout <= 0 {
+		timeout = metadata.DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	page, err := a.fetcher.Fetch(ctx, original)
+	if err != nil {
+		fmt.Printf("Could not fetch the title of %s, because %s.\n", original, err)
+		return
+	}
+	if page.Title == "" && page.Description == "" {
+		return
+	}
+	if a.InMaintenance() {
+		fmt.Printf("Not filling in the title of %s, as the application is in maintenance mode.\n", original)
+		return
+	}
+
+	err = a.urls.FillDetails(shortened, page.Title, page.Description)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// detailsMessage returns a message explaining why a link's details couldn't
+// be changed, suitable for showing to the user, in the locale's language
+func detailsMessage(locale *i18n.Locale, err error) string {
+	if errors.Is(err, models.ErrInvalidDetails) {
+		return translate(locale, "Titles can be up to %d characters long, descriptions up to %d, and notes up to %d.",
+			models.MaxTitleLength, models.MaxDescriptionLength, models.MaxNotesLength)
+	}
+	return translate(locale, "We weren't able to change the URL's details.")
+}
+
+// updateDetails processes the form for changing a shortened URL's title,
+// description, and notes, then redirects the user back to the shortened
+// URL's history page.
+func (a *App) updateDetails(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	shortenedURL := r.PostForm.Get("url")
+	err = a.urls.SetDetails(shortenedURL, models.LinkDetails{
+		Title:       r.PostForm.Get("title"),
+		Description: r.PostForm.Get("description"),
+		Notes:       r.PostForm.Get("notes"),
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w, r)
+			return
+		}
+		if !errors.Is(err, models.ErrInvalidDetails) {
+			fmt.Println(err.Error())
+		}
+		a.setErrorInFlash(detailsMessage(a.locale(r), err), w, r)
+	}
+
+	http.Redirect(w, r, historyRoute(shortenedURL), http.StatusSeeOther)
+}
@@ -0,0 +1,53 @@
+package application
+
+import (
+	"fmt"
+	"gourlshortener/internals/exporter"
+	"net/http"
+	"strconv"
+)
+
+// apiExportLinks streams the links, along with their statistics, as CSV,
+// JSON, or NDJSON, set by the format query parameter (JSON by default). The
+// links can be filtered by the created_from and created_to dates, and the
+// min_clicks and max_clicks counts. Setting format_clicks to true writes
+// click counts with thousands separators.
+func (a *App) apiExportLinks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = exporter.FormatJSON
+	}
+
+	filter, err := exporter.ParseFilter(query.Get("created_from"), query.Get("created_to"), query.Get("min_clicks"), query.Get("max_clicks"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	formatClicks := false
+	if value := query.Get("format_clicks"); value != "" {
+		if formatClicks, err = strconv.ParseBool(value); err != nil {
+			apiError(w, http.StatusBadRequest, "format_clicks must be true or false")
+			return
+		}
+	}
+
+	writer, err := exporter.NewWriter(w, format, formatClicks)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", exporter.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="links.%s"`, format))
+
+	// Once the first link has been written, the status can't be changed, so
+	// errors can only be logged
+	if err = a.urls.Export(filter, writer.Write); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = writer.Close(); err != nil {
+		fmt.Println(err.Error())
+	}
+}
@@ -0,0 +1,121 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/health"
+	"gourlshortener/internals/models"
+	"time"
+)
+
+// DefaultBrokenAfter is the number of checks in a row which must fail for a
+// link to be broken, by default
+const DefaultBrokenAfter = 3
+
+// WithLinkChecker sets the checker which checks links' destinations, and the
+// number of checks in a row which must fail for a link to be broken
+func WithLinkChecker(checker *health.Checker, brokenAfter int) Option {
+	return func(a *App) {
+		a.checker = checker
+		a.brokenAfter = brokenAfter
+	}
+}
+
+// HealthResponse is the API representation of the health of a link's
+// destination
+type HealthResponse struct {
+	Status              string    `json:"status"`
+	StatusCode          int       `json:"status_code"`
+	FinalURL            string    `json:"final_url"`
+	LatencyMS           int64     `json:"latency_ms"`
+	Error               string    `json:"error,omitempty"`
+	Checked             time.Time `json:"checked"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+func newHealthResponse(h *models.LinkHealth) *HealthResponse {
+	if h == nil {
+		return nil
+	}
+	return &HealthResponse{
+		Status:              h.Status(),
+		StatusCode:          h.StatusCode,
+		FinalURL:            h.FinalURL,
+		LatencyMS:           h.Latency.Milliseconds(),
+		Error:               h.Error,
+		Checked:             h.Checked,
+		ConsecutiveFailures: h.ConsecutiveFailures,
+	}
+}
+
+// newLinkHealth converts the result of a check into the link's health
+func newLinkHealth(result health.Result) *models.LinkHealth {
+	h := &models.LinkHealth{
+		ShortenedURL: result.ShortenedURL,
+		StatusCode:   result.StatusCode,
+		FinalURL:     result.FinalURL,
+		Latency:      result.Latency,
+		Checked:      result.Checked,
+	}
+	if result.Err != nil {
+		h.Error = result.Err.Error()
+	}
+	return h
+}
+
+// CheckLinks checks every link's destination once, and records the results.
+// Results aren't recorded in maintenance mode, as the database mustn't be
+// written to.
+func (a *App) CheckLinks(ctx context.Context) error {
+	if a.checker == nil {
+		return errors.New("the link checker isn't configured")
+	}
+	brokenAfter := a.brokenAfter
+	if brokenAfter <= 0 {
+		brokenAfter = DefaultBrokenAfter
+	}
+
+	urls, err := a.urls.Latest()
+	if err != nil {
+		return err
+	}
+	targets := make([]health.Target, 0, len(urls))
+	for _, urlData := range urls {
+		targets = append(targets, health.Target{ShortenedURL: urlData.ShortenedURL, URL: urlData.OriginalURL})
+	}
+
+	a.checker.CheckAll(ctx, targets, func(result health.Result) {
+		if a.InMaintenance() {
+			return
+		}
+		// The link might have been deleted while it was checked
+		err := a.urls.RecordHealth(newLinkHealth(result), brokenAfter)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			fmt.Println(err.Error())
+		}
+	})
+	return ctx.Err()
+}
+
+// MonitorLinks checks every link's destination every interval, until ctx is
+// cancelled, calling onError with any error which stopped them from being
+// checked. Checks are skipped in maintenance mode.
+func (a *App) MonitorLinks(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if a.InMaintenance() {
+				continue
+			}
+			if err := a.CheckLinks(ctx); err != nil && ctx.Err() == nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
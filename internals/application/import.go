@@ -0,0 +1,237 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/importer"
+	"gourlshortener/internals/models"
+	"gourlshortener/internals/shortcode"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// maxImportSize is the largest import file, in bytes, that can be uploaded
+const maxImportSize = 10 << 20
+
+// ImportPageData stores the template data for the import page
+//
+// This is the error that stopped the import, if any, and the report of the
+// last import, if one was run.
+type ImportPageData struct {
+	Error  string
+	Report *importer.Report
+}
+
+// importValidators is how many of an import's destinations are validated at
+// once, as validating them can include checking that they're reachable
+const importValidators = 8
+
+// ImportLinks validates and imports the links in r, which is in the supplied
+// format, attributing them to actor. Each link's destination is validated in
+// the same way as links shortened in the UI. The links are inserted in a
+// single transaction, unless dryRun is true, in which case nothing is stored,
+// and no codes are generated. The returned report says what happened, or
+// would have happened, to each row.
+func (a *App) ImportLinks(ctx context.Context, r io.Reader, format, actor string, dryRun bool) (*importer.Report, error) {
+	rows, err := importer.Parse(r, format)
+	if err != nil {
+		return nil, err
+	}
+	destinations, errs := a.validateDestinations(ctx, rows)
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &importer.Report{DryRun: dryRun}
+	results := make([]importer.Result, len(rows))
+	var (
+		links     []*models.ImportLink
+		linkIndex []int
+	)
+	for i, row := range rows {
+		results[i] = importer.Result{Line: row.Line, Destination: row.Destination}
+		if row.Reason != "" {
+			results[i].Status, results[i].Reason = importer.StatusInvalid, row.Reason
+			continue
+		}
+		if errs[i] != nil {
+			results[i].Status, results[i].Reason = importer.StatusInvalid, validationMessage(nil, errs[i], "The destination isn't a valid URL.")
+			continue
+		}
+		parsedURL, err := url.Parse(destinations[i])
+		if err != nil {
+			return nil, err
+		}
+
+		link := &models.ImportLink{
+			OriginalURL: destinations[i],
+			Clicks:      row.Clicks,
+			Created:     row.Created,
+		}
+		if row.Alias != "" {
+			link.ShortenedURL = parsedURL.Scheme + "://" + row.Alias
+		} else {
+			link.Allocate = a.allocateImport(parsedURL.Scheme)
+		}
+		results[i].Destination = destinations[i]
+		links = append(links, link)
+		linkIndex = append(linkIndex, i)
+	}
+
+	if len(links) > 0 {
+		errs, err := a.urls.Import(links, actor, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		for j, err := range errs {
+			result := &results[linkIndex[j]]
+			switch {
+			case err == nil:
+				result.Status, result.ShortenedURL = importer.StatusCreated, links[j].ShortenedURL
+			case errors.Is(err, models.ErrDuplicate):
+				result.Status, result.Reason = importer.StatusDuplicate, "The destination or alias has already been shortened."
+			default:
+				result.Status, result.Reason = importer.StatusInvalid, err.Error()
+			}
+		}
+	}
+
+	for _, result := range results {
+		report.Add(result)
+	}
+
+	return report, nil
+}
+
+// validateDestinations validates the destinations of the rows which were
+// parsed, importValidators at a time, returning each one's normalised
+// destination, or why it's invalid
+func (a *App) validateDestinations(ctx context.Context, rows []importer.Row) ([]string, []error) {
+	destinations, errs := make([]string, len(rows)), make([]error, len(rows))
+	slots := make(chan struct{}, importValidators)
+	var wg sync.WaitGroup
+	for i, row := range rows {
+		if row.Reason != "" {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, destination string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			destinations[i], errs[i] = a.ValidateURL(ctx, destination)
+		}(i, row.Destination)
+	}
+	wg.Wait()
+	return destinations, errs
+}
+
+// allocateImport returns a function which allocates an imported link's
+// shortened URL, with the supplied scheme, retrying codes which are in use
+func (a *App) allocateImport(scheme string) func(available func(shortened string) error) (string, error) {
+	return func(available func(shortened string) error) (string, error) {
+		var shortenedURL string
+		_, err := a.codeAllocator().Allocate(func(code string) error {
+			shortenedURL = scheme + "://" + code
+			err := available(shortenedURL)
+			if errors.Is(err, models.ErrDuplicateCode) {
+				return shortcode.ErrCollision
+			}
+			return err
+		})
+		return shortenedURL, err
+	}
+}
+
+// renderImport renders the import page, with the supplied page data
+func (a *App) renderImport(w http.ResponseWriter, r *http.Request, status int, pageData ImportPageData) {
+	tmpl, err := a.parseTemplate(r, "import.html", nil)
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(status)
+	err = tmpl.Execute(w, pageData)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// getImportRoute renders the form for importing links from a file
+func (a *App) getImportRoute(w http.ResponseWriter, r *http.Request) {
+	a.renderImport(w, r, http.StatusOK, ImportPageData{})
+}
+
+// importLinks processes the import form, and renders the import's report.
+// The file's format is taken from its extension.
+func (a *App) importLinks(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		fmt.Println(err.Error())
+		a.renderImport(w, r, http.StatusBadRequest, ImportPageData{Error: a.locale(r).T("Please choose a CSV or JSON Lines file, of at most 10 MB, to import.")})
+		return
+	}
+	defer file.Close()
+
+	format := importer.FormatFromFilename(header.Filename)
+	if format == "" {
+		a.renderImport(w, r, http.StatusBadRequest, ImportPageData{Error: a.locale(r).T("Please choose a file ending in .csv, .jsonl, or .ndjson.")})
+		return
+	}
+
+	dryRun := r.PostForm.Get("dry_run") != ""
+	report, err := a.ImportLinks(r.Context(), file, format, a.actor(r), dryRun)
+	if err != nil {
+		fmt.Println(err.Error())
+		a.renderImport(w, r, http.StatusBadRequest, ImportPageData{Error: a.locale(r).T("We weren't able to import the file: %s", err.Error())})
+		return
+	}
+
+	a.renderImport(w, r, http.StatusOK, ImportPageData{Report: report})
+}
+
+// apiImportLinks imports the links in the request body, and returns the
+// import's report. The body's format is taken from the format query
+// parameter or, failing that, the Content-Type header. Setting the dry_run
+// query parameter to true validates the links without storing them.
+func (a *App) apiImportLinks(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = importer.FormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	if format != importer.FormatCSV && format != importer.FormatJSONL {
+		apiError(w, http.StatusUnsupportedMediaType, "the body must be CSV (text/csv) or JSON Lines (application/jsonl)")
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			apiError(w, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+	}
+
+	report, err := a.ImportLinks(r.Context(), http.MaxBytesReader(w, r.Body, maxImportSize), format, a.actor(r), dryRun)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			apiError(w, http.StatusRequestEntityTooLarge, "the body must be at most 10 MB")
+			return
+		}
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,104 @@
+package application
+
+import (
+	"fmt"
+	"gourlshortener/internals/i18n"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// WithLocalizer sets how the language of each request is selected, and how
+// click counts are formatted
+func WithLocalizer(localizer i18n.Localizer) Option {
+	return func(a *App) {
+		a.localizer = &localizer
+	}
+}
+
+// locale returns the locale of the request, falling back to the default
+// localizer if one wasn't configured
+func (a *App) locale(r *http.Request) *i18n.Locale {
+	if a.localizer == nil {
+		return i18n.DefaultLocalizer().FromRequest(r)
+	}
+	return a.localizer.FromRequest(r)
+}
+
+// translate translates the message into the locale's language, unless
+// locale is nil, e.g., for messages returned by the API
+func translate(locale *i18n.Locale, key string, args ...interface{}) string {
+	if locale == nil {
+		return fmt.Sprintf(key, args...)
+	}
+	return locale.T(key, args...)
+}
+
+// localeFuncs returns the template functions which translate a page into the
+// locale's language, e.g., {{ t "Shorten URL" }}, and format its numbers and
+// dates. Messages which contain markup are translated with tHTML, which
+// escapes their arguments instead.
+func localeFuncs(locale *i18n.Locale) template.FuncMap {
+	return template.FuncMap{
+		"t": locale.T,
+		"tHTML": func(key string, args ...interface{}) template.HTML {
+			escaped := make([]interface{}, len(args))
+			for i, arg := range args {
+				escaped[i] = template.HTMLEscapeString(fmt.Sprint(arg))
+			}
+			return template.HTML(locale.T(key, escaped...))
+		},
+		"lang":         locale.Lang,
+		"formatClicks": locale.FormatClicks,
+		"formatDate":   locale.FormatDate,
+		"languages": func() []i18n.Language {
+			return i18n.Languages
+		},
+	}
+}
+
+// setLanguage processes the language form, setting the language cookie, which
+// overrides the languages that the browser asks for, then redirects the user
+// back to the page which they changed it on. Choosing no language clears the
+// cookie, so that the browser's languages are used again.
+func (a *App) setLanguage(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     i18n.CookieName,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	}
+	if value := r.PostForm.Get("lang"); value != "" {
+		tag, err := language.Parse(value)
+		if err != nil || !i18n.Supported(tag) {
+			http.Error(w, "Unsupported language", http.StatusBadRequest)
+			return
+		}
+		cookie.Value = tag.String()
+		cookie.MaxAge = int((365 * 24 * time.Hour).Seconds())
+	}
+	http.SetCookie(w, cookie)
+
+	http.Redirect(w, r, localReferer(r), http.StatusSeeOther)
+}
+
+// localReferer returns the path and query of the page which referred the
+// request, if it's on this site, or the default route
+func localReferer(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Host != r.Host || !strings.HasPrefix(referer.Path, "/") {
+		return "/"
+	}
+	return referer.RequestURI()
+}
@@ -0,0 +1,210 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maintenance is the application's read-only maintenance mode. While it's
+// on, redirects keep working, but links can't be created or changed, and
+// clicks are buffered in memory, then recorded when it's turned off.
+type Maintenance struct {
+	// RetryAfter is how long clients are asked to wait before retrying a
+	// write which was refused
+	RetryAfter time.Duration
+
+	mu     sync.Mutex
+	on     bool
+	clicks map[string]int
+}
+
+// NewMaintenance creates a maintenance mode, which is on if on is true
+func NewMaintenance(on bool, retryAfter time.Duration) *Maintenance {
+	return &Maintenance{RetryAfter: retryAfter, on: on, clicks: map[string]int{}}
+}
+
+// WithMaintenance sets the maintenance mode, which can then be turned on and
+// off while the App is running. Without one, the App is never in
+// maintenance mode.
+func WithMaintenance(maintenance *Maintenance) Option {
+	return func(a *App) {
+		a.maintenance = maintenance
+	}
+}
+
+// InMaintenance reports whether the App is in maintenance mode
+func (a *App) InMaintenance() bool {
+	if a.maintenance == nil {
+		return false
+	}
+	a.maintenance.mu.Lock()
+	defer a.maintenance.mu.Unlock()
+	return a.maintenance.on
+}
+
+// errNoMaintenance is returned when maintenance mode is turned on for an App
+// which wasn't configured with one
+var errNoMaintenance = errors.New("maintenance mode isn't configured")
+
+// SetMaintenance turns maintenance mode on or off. Turning it off records the
+// clicks which were buffered while it was on; if they can't be recorded, it
+// stays on, so that they aren't lost.
+func (a *App) SetMaintenance(on bool) error {
+	if a.maintenance == nil {
+		if on {
+			return errNoMaintenance
+		}
+		return nil
+	}
+	a.maintenance.mu.Lock()
+	defer a.maintenance.mu.Unlock()
+	return a.switchMaintenance(on)
+}
+
+// ToggleMaintenance turns maintenance mode off if it's on, and on otherwise,
+// returning whether it's now on. The check and the change happen under one
+// lock, so concurrent toggles can't both see the same state.
+func (a *App) ToggleMaintenance() (bool, error) {
+	if a.maintenance == nil {
+		return false, errNoMaintenance
+	}
+	a.maintenance.mu.Lock()
+	defer a.maintenance.mu.Unlock()
+	err := a.switchMaintenance(!a.maintenance.on)
+	return a.maintenance.on, err
+}
+
+// FlushClicks records the clicks which were buffered in maintenance mode,
+// without turning it off, so that they aren't lost when the server stops
+func (a *App) FlushClicks() error {
+	if a.maintenance == nil {
+		return nil
+	}
+	a.maintenance.mu.Lock()
+	defer a.maintenance.mu.Unlock()
+	return a.flushClicks()
+}
+
+// switchMaintenance turns maintenance mode on or off, recording the buffered
+// clicks when it's turned off. The caller must hold the maintenance lock.
+func (a *App) switchMaintenance(on bool) error {
+	if !on {
+		if err := a.flushClicks(); err != nil {
+			return err
+		}
+	}
+	a.maintenance.on = on
+	return nil
+}
+
+// flushClicks records the buffered clicks. The caller must hold the
+// maintenance lock.
+func (a *App) flushClicks() error {
+	m := a.maintenance
+	if len(m.clicks) == 0 {
+		return nil
+	}
+	if err := a.urls.AddClicks(m.clicks); err != nil {
+		return fmt.Errorf("the buffered clicks couldn't be recorded: %w", err)
+	}
+	m.clicks = map[string]int{}
+	return nil
+}
+
+// ToggleMaintenanceOnSignal turns maintenance mode on or off whenever one of
+// the signals is received, until ctx is cancelled, calling onToggle with
+// whether it's on, and any error from turning it off. It does nothing without
+// any signals.
+func (a *App) ToggleMaintenanceOnSignal(ctx context.Context, onToggle func(bool, error), signals ...os.Signal) {
+	if len(signals) == 0 {
+		return
+	}
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+
+	go func() {
+		defer signal.Stop(received)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-received:
+				on, err := a.ToggleMaintenance()
+				if onToggle != nil {
+					onToggle(on, err)
+				}
+			}
+		}
+	}()
+}
+
+// recordClick counts a click on a shortened URL, buffering it in maintenance
+// mode
+func (a *App) recordClick(shortened string) error {
+	if a.maintenance != nil {
+		a.maintenance.mu.Lock()
+		if a.maintenance.on {
+			a.maintenance.clicks[shortened]++
+			a.maintenance.mu.Unlock()
+			return nil
+		}
+		a.maintenance.mu.Unlock()
+	}
+	return a.urls.IncrementClicks(shortened)
+}
+
+// refuseInMaintenance refuses requests which change links while the App is in
+// maintenance mode, with JSON for API requests, and the 503 Service
+// Unavailable page for all others
+func (a *App) refuseInMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.InMaintenance() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if seconds := int(a.maintenance.RetryAfter.Seconds()); seconds > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			apiError(w, http.StatusServiceUnavailable, "links can't be changed during maintenance, please try again later")
+			return
+		}
+		a.renderError(w, r, http.StatusServiceUnavailable)
+	})
+}
+
+// MaintenanceRequest is the body of a request to turn maintenance mode on
+// or off, and the response which describes it
+type MaintenanceRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// apiGetMaintenance reports whether the App is in maintenance mode
+func (a *App) apiGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, MaintenanceRequest{Enabled: a.InMaintenance()})
+}
+
+// apiSetMaintenance turns maintenance mode on or off
+func (a *App) apiSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "the request body must be JSON, with an enabled field")
+		return
+	}
+	if err := a.SetMaintenance(req.Enabled); err != nil {
+		fmt.Println(err.Error())
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, MaintenanceRequest{Enabled: a.InMaintenance()})
+}
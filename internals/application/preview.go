@@ -0,0 +1,115 @@
+package application
+
+import (
+	"fmt"
+	"gourlshortener/internals/models"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// PreviewPageData stores the template data for a link's preview page
+//
+// This is the link's statistics, its public short URL, the URL that follows
+// it, and signals about the destination's safety: its scheme and host, the
+// host's Unicode form if it's punycode-encoded, and whether the host is an IP
+// address.
+type PreviewPageData struct {
+	Link                   *models.LinkStats
+	PublicURL, ContinueURL string
+	Scheme, Host           string
+	UnicodeHost            string
+	Secure, Punycode, IP   bool
+}
+
+// wantsPreview reports whether a request asked for a link's preview page,
+// rather than its destination
+func wantsPreview(r *http.Request) bool {
+	preview, _ := strconv.ParseBool(r.URL.Query().Get("preview"))
+	return preview
+}
+
+// confirmed reports whether a request is following a link from its preview
+// page, so shouldn't be shown the preview page again
+func confirmed(r *http.Request) bool {
+	confirmed, _ := strconv.ParseBool(r.URL.Query().Get("confirmed"))
+	return confirmed
+}
+
+// alwaysPreview reports whether a link is set to always show its preview page
+func (a *App) alwaysPreview(urlData *models.ShortenerData) bool {
+	settings, err := a.urls.Settings(urlData.ShortenedURL)
+	if err != nil {
+		fmt.Println(err.Error())
+		return false
+	}
+	return settings[models.SettingAlwaysPreview] == "true"
+}
+
+// newPreviewPageData builds the preview page's data for a link, inspecting its
+// destination for safety signals
+func (a *App) newPreviewPageData(r *http.Request, stats *models.LinkStats) PreviewPageData {
+	pageData := PreviewPageData{
+		Link:        stats,
+		PublicURL:   a.PublicURL(r, stats.ShortenedURL),
+		ContinueURL: "/" + url.PathEscape(models.Code(stats.ShortenedURL)) + "?confirmed=true",
+	}
+
+	destination, err := url.Parse(stats.OriginalURL)
+	if err != nil {
+		return pageData
+	}
+	pageData.Scheme = destination.Scheme
+	pageData.Secure = destination.Scheme == "https"
+	pageData.Host = destination.Hostname()
+	pageData.IP = net.ParseIP(pageData.Host) != nil
+	for _, label := range strings.Split(pageData.Host, ".") {
+		if strings.HasPrefix(strings.ToLower(label), "xn--") {
+			pageData.Punycode = true
+		}
+	}
+	if pageData.Punycode {
+		if unicodeHost, err := idna.ToUnicode(pageData.Host); err == nil {
+			pageData.UnicodeHost = unicodeHost
+		}
+	}
+
+	return pageData
+}
+
+// preview renders a link's preview page, which shows where it goes, without
+// following it, so its click isn't counted. If the destination is on the
+// blocklist, the user is shown a warning instead.
+func (a *App) preview(w http.ResponseWriter, r *http.Request, urlData *models.ShortenerData) {
+	if a.blocklist != nil {
+		if _, blocked := a.blocklist.Match(urlData.OriginalURL); blocked {
+			a.blocked(w, r, urlData)
+			return
+		}
+	}
+
+	stats, err := a.urls.Stats(urlData.ShortenedURL)
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	tmpl, err := a.parseTemplate(r, "preview.html", nil)
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err = tmpl.Execute(w, a.newPreviewPageData(r, stats))
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,212 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/models"
+	"gourlshortener/internals/validation"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HistoryPageData stores the template data for a shortened URL's history page
+//
+// This is the shortened URL's current details and settings, along with every
+// revision of its destination and settings, newest first.
+type HistoryPageData struct {
+	Error         string
+	URLData       *models.ShortenerData
+	Settings      map[string]string
+	AlwaysPreview bool
+	Revisions     []*models.LinkRevision
+}
+
+// historyRoute returns the path of a shortened URL's history page
+func historyRoute(shortened string) string {
+	return "/links/history?url=" + url.QueryEscape(shortened)
+}
+
+// getHistoryRoute renders a shortened URL's revision history, along with
+// forms for changing its destination and reverting to an earlier revision.
+func (a *App) getHistoryRoute(w http.ResponseWriter, r *http.Request) {
+	shortenedURL := r.URL.Query().Get("url")
+	urlData, err := a.urls.Get(shortenedURL)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w, r)
+			return
+		}
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	settings, err := a.urls.Settings(shortenedURL)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	revisions, err := a.urls.Revisions(shortenedURL)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	tmpl, err := a.parseTemplate(r, "history.html", template.FuncMap{
+		"joinTags": func(tags []string) string { return strings.Join(tags, ", ") },
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	session, err := a.store.Get(r, "flash-session")
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	pageData := HistoryPageData{
+		URLData:       urlData,
+		Settings:      settings,
+		AlwaysPreview: settings[models.SettingAlwaysPreview] == "true",
+		Revisions:     revisions,
+	}
+
+	fm := session.Flashes("error")
+	if fm != nil {
+		if error, ok := fm[0].(string); ok {
+			pageData.Error = error
+		}
+	}
+	session.Save(r, w)
+
+	err = tmpl.Execute(w, pageData)
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+	}
+}
+
+// updateURL processes the form for changing a shortened URL's destination,
+// then redirects the user back to the shortened URL's history page.
+func (a *App) updateURL(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	shortenedURL := r.PostForm.Get("url")
+	destination, err := a.ValidateURL(r.Context(), r.PostForm.Get("destination"))
+	if err != nil {
+		a.setErrorInFlash(validationMessage(a.locale(r), err, "Please provide a valid URL."), w, r)
+		http.Redirect(w, r, historyRoute(shortenedURL), http.StatusSeeOther)
+		return
+	}
+
+	err = a.urls.Update(shortenedURL, destination, a.actor(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w, r)
+			return
+		}
+		fmt.Println(err.Error())
+		a.setErrorInFlash(a.locale(r).T("We weren't able to change the URL's destination."), w, r)
+	}
+
+	http.Redirect(w, r, historyRoute(shortenedURL), http.StatusSeeOther)
+}
+
+// revertURL processes the form for reverting a shortened URL to an earlier
+// revision, then redirects the user back to the shortened URL's history page.
+func (a *App) revertURL(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	shortenedURL := r.PostForm.Get("url")
+	revision, err := strconv.Atoi(r.PostForm.Get("revision"))
+	if err != nil {
+		a.setErrorInFlash(a.locale(r).T("Please choose a revision to revert to."), w, r)
+		http.Redirect(w, r, historyRoute(shortenedURL), http.StatusSeeOther)
+		return
+	}
+
+	err = a.validateRevision(r.Context(), shortenedURL, revision)
+	if err == nil {
+		err = a.urls.Revert(shortenedURL, revision, a.actor(r))
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w, r)
+			return
+		}
+		var validationErr *validation.Error
+		if !errors.As(err, &validationErr) {
+			fmt.Println(err.Error())
+		}
+		a.setErrorInFlash(validationMessage(a.locale(r), err, "We weren't able to revert the URL."), w, r)
+	}
+
+	http.Redirect(w, r, historyRoute(shortenedURL), http.StatusSeeOther)
+}
+
+// validateRevision runs the destination of one of a shortened URL's revisions
+// through the App's validation pipeline and blocklist, which may have changed
+// since the revision was recorded, before it's reverted to
+func (a *App) validateRevision(ctx context.Context, shortened string, revision int) error {
+	revisions, err := a.urls.Revisions(shortened)
+	if err != nil {
+		return err
+	}
+	for _, r := range revisions {
+		if r.Revision == revision {
+			_, err = a.ValidateURL(ctx, r.OriginalURL)
+			return err
+		}
+	}
+	return models.ErrNoRecord
+}
+
+// updateSettings processes the form for changing a shortened URL's settings,
+// then redirects the user back to the shortened URL's history page.
+func (a *App) updateSettings(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	shortenedURL := r.PostForm.Get("url")
+	changes := map[string]string{models.SettingAlwaysPreview: ""}
+	if r.PostForm.Get("always_preview") == "true" {
+		changes[models.SettingAlwaysPreview] = "true"
+	}
+
+	err = a.urls.UpdateSettings(shortenedURL, changes, a.actor(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w, r)
+			return
+		}
+		fmt.Println(err.Error())
+		a.setErrorInFlash(a.locale(r).T("We weren't able to change the URL's settings."), w, r)
+	}
+
+	http.Redirect(w, r, historyRoute(shortenedURL), http.StatusSeeOther)
+}
@@ -0,0 +1,134 @@
+package application
+
+import (
+	"gourlshortener/internals/ratelimit"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// SecurityHeaders configures the security headers set on every response, and
+// whether plain HTTP requests are redirected to HTTPS
+//
+// Headers which are empty aren't set. Strict-Transport-Security is only set
+// on responses to HTTPS requests, as browsers ignore it otherwise.
+type SecurityHeaders struct {
+	ContentSecurityPolicy   string
+	StrictTransportSecurity string
+	FrameOptions            string
+	ContentTypeOptions      string
+	ReferrerPolicy          string
+	PermissionsPolicy       string
+
+	// ClearSiteData is only set on responses to signing out, so that
+	// browsers forget the site's cookies, storage, and cache. Setting it on
+	// every response would sign everyone out on every request.
+	ClearSiteData string
+
+	// RouteContentSecurityPolicies replaces the Content-Security-Policy for
+	// requests whose path starts with the key. The longest matching prefix
+	// wins.
+	RouteContentSecurityPolicies map[string]string
+
+	// RedirectToHTTPS permanently redirects plain HTTP requests to HTTPS.
+	// Requests are treated as HTTPS if they were made over TLS, or if a
+	// trusted proxy set X-Forwarded-Proto to https.
+	RedirectToHTTPS bool
+}
+
+// DefaultSecurityHeaders returns the default security headers. The static
+// assets have a relaxed Content-Security-Policy, so that SVG images can use
+// inline styles.
+func DefaultSecurityHeaders() SecurityHeaders {
+	return SecurityHeaders{
+		ContentSecurityPolicy:   "default-src 'self'; frame-ancestors 'self'; form-action 'self'; base-uri 'self'",
+		StrictTransportSecurity: "max-age=63072000; includeSubDomains",
+		FrameOptions:            "sameorigin",
+		ContentTypeOptions:      "nosniff",
+		ReferrerPolicy:          "strict-origin",
+		PermissionsPolicy:       "camera=(), microphone=(), geolocation=()",
+		ClearSiteData:           `"cache", "cookies", "storage"`,
+		RouteContentSecurityPolicies: map[string]string{
+			"/static/": "default-src 'self'; img-src 'self' data:; style-src 'self' 'unsafe-inline'",
+		},
+	}
+}
+
+// WithSecurityHeaders sets the security headers set on every response
+func WithSecurityHeaders(headers SecurityHeaders) Option {
+	return func(a *App) {
+		a.securityHeaders = &headers
+	}
+}
+
+// WithTrustedProxies sets the proxies whose X-Forwarded-Proto header is
+// trusted. It's ignored on requests from anyone else, so that clients can't
+// claim that plain HTTP requests were made over HTTPS.
+func WithTrustedProxies(proxies []*net.IPNet) Option {
+	return func(a *App) {
+		a.trustedProxies = proxies
+	}
+}
+
+// isHTTPS reports whether a request was made over HTTPS, either directly or
+// to a trusted proxy in front of the application
+func (a *App) isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !ratelimit.FromTrustedProxy(r, a.trustedProxies) {
+		return false
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// contentSecurityPolicy returns the Content-Security-Policy for the supplied
+// path
+func (h SecurityHeaders) contentSecurityPolicy(path string) string {
+	policy, longest := h.ContentSecurityPolicy, -1
+	for prefix, routePolicy := range h.RouteContentSecurityPolicies {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			policy, longest = routePolicy, len(prefix)
+		}
+	}
+	return policy
+}
+
+// secureHeaders is middleware which sets the App's security headers on every
+// response, along with Clear-Site-Data when signing out, and redirects plain
+// HTTP requests to HTTPS, if enabled. The ping route is never redirected, so
+// that it can be used for health checks.
+func (a *App) secureHeaders(next http.Handler) http.Handler {
+	headers := DefaultSecurityHeaders()
+	if a.securityHeaders != nil {
+		headers = *a.securityHeaders
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secure := a.isHTTPS(r)
+		if headers.RedirectToHTTPS && !secure && r.URL.Path != "/api/ping" {
+			http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+			return
+		}
+
+		set := func(name, value string) {
+			if value != "" {
+				w.Header().Set(name, value)
+			}
+		}
+		set("Content-Security-Policy", headers.contentSecurityPolicy(r.URL.Path))
+		set("X-Frame-Options", headers.FrameOptions)
+		set("X-Content-Type-Options", headers.ContentTypeOptions)
+		set("Referrer-Policy", headers.ReferrerPolicy)
+		set("Permissions-Policy", headers.PermissionsPolicy)
+		if secure {
+			set("Strict-Transport-Security", headers.StrictTransportSecurity)
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/logout" {
+			set("Clear-Site-Data", headers.ClearSiteData)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
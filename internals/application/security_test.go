@@ -0,0 +1,116 @@
+package application
+
+import (
+	"gourlshortener/internals/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeadersAreSet(t *testing.T) {
+	app := &App{}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL + "/api/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	defaults := DefaultSecurityHeaders()
+	for header, expected := range map[string]string{
+		"Content-Security-Policy":   defaults.ContentSecurityPolicy,
+		"Strict-Transport-Security": defaults.StrictTransportSecurity,
+		"X-Frame-Options":           "sameorigin",
+		"X-Content-Type-Options":    "nosniff",
+		"Referrer-Policy":           "strict-origin",
+	} {
+		if value := rs.Header.Get(header); value != expected {
+			t.Errorf("%s: got '%s'; want '%s'", header, value, expected)
+		}
+	}
+	if value := rs.Header.Get("Clear-Site-Data"); value != "" {
+		t.Errorf("Did not expect Clear-Site-Data to be set, except when signing out. Got: %s", value)
+	}
+}
+
+func TestStaticAssetsHaveRelaxedContentSecurityPolicy(t *testing.T) {
+	app := &App{}
+
+	ts := httptest.NewTLSServer(app.Routes())
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL + "/static/css/styles.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	expected := DefaultSecurityHeaders().RouteContentSecurityPolicies["/static/"]
+	if value := rs.Header.Get("Content-Security-Policy"); value != expected {
+		t.Errorf("got '%s'; want '%s'", value, expected)
+	}
+}
+
+func TestStrictTransportSecurityIsOnlySetOverHttps(t *testing.T) {
+	app := &App{}
+
+	ts := httptest.NewServer(app.Routes())
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL + "/api/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if value := rs.Header.Get("Strict-Transport-Security"); value != "" {
+		t.Errorf("Did not expect Strict-Transport-Security to be set over HTTP. Got: %s", value)
+	}
+}
+
+func TestHttpRequestsAreRedirectedToHttps(t *testing.T) {
+	headers := DefaultSecurityHeaders()
+	headers.RedirectToHTTPS = true
+	proxies, err := ratelimit.ParseTrustedProxies([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{
+		securityHeaders: &headers,
+		trustedProxies:  proxies,
+	}
+	handler := app.Routes()
+
+	tests := []struct {
+		name, path, remoteAddr, forwardedProto string
+		expected                               int
+	}{
+		{"plain http", "/links/history?url=x", "192.0.2.1:1234", "", http.StatusPermanentRedirect},
+		{"https behind a proxy", "/api/ping", "10.0.0.1:1234", "https", http.StatusOK},
+		{"a client claiming https", "/links/history?url=x", "192.0.2.1:1234", "https", http.StatusPermanentRedirect},
+		{"health checks", "/api/ping", "192.0.2.1:1234", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://short.example"+test.path, nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.forwardedProto != "" {
+				r.Header.Set("X-Forwarded-Proto", test.forwardedProto)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != test.expected {
+				t.Errorf("got %d; want %d", rr.Code, test.expected)
+			}
+			if test.expected == http.StatusPermanentRedirect {
+				if location := rr.Header().Get("Location"); location != "https://short.example"+test.path {
+					t.Errorf("got '%s'; want '%s'", location, "https://short.example"+test.path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"gourlshortener/internals/i18n"
+	"gourlshortener/internals/models"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// crawlerUserAgents are (parts of) the user agents of the crawlers which chat
+// apps and social networks use to unfurl links, in lower case
+var crawlerUserAgents = []string{
+	"bitlybot",
+	"discordbot",
+	"embedly",
+	"facebookcatalog",
+	"facebookexternalhit",
+	"facebot",
+	"iframely",
+	"linkedinbot",
+	"mastodon",
+	"pinterest",
+	"redditbot",
+	"skypeuripreview",
+	"slack-imgproxy",
+	"slackbot",
+	"telegrambot",
+	"tumblr",
+	"twitterbot",
+	"vkshare",
+	"whatsapp",
+	"xing-contenttabreceiver",
+}
+
+// SocialPageData stores the template data for a link's social card
+//
+// This is the card's title, description, and image, the link's public short
+// URL, and its destination, which the page refreshes to.
+type SocialPageData struct {
+	Title, Description, Image string
+	PublicURL, Destination    string
+}
+
+// isCrawler reports whether a user agent is a chat app's or social network's
+// crawler, unfurling a link
+func isCrawler(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, crawler := range crawlerUserAgents {
+		if strings.Contains(userAgent, crawler) {
+			return true
+		}
+	}
+	return false
+}
+
+// socialChanges validates a link's social card title, description, and image,
+// returning them as settings changes. If any is invalid, it returns a message
+// explaining why, suitable for showing to the user, in the locale's language.
+func socialChanges(locale *i18n.Locale, title, description, image string) (map[string]string, string) {
+	title, description, image = strings.TrimSpace(title), strings.TrimSpace(description), strings.TrimSpace(image)
+	if utf8.RuneCountInString(title) > models.MaxTitleLength || utf8.RuneCountInString(description) > models.MaxDescriptionLength {
+		return nil, translate(locale, "Social card titles can be up to %d characters long, and descriptions up to %d.",
+			models.MaxTitleLength, models.MaxDescriptionLength)
+	}
+	if image != "" {
+		u, err := url.Parse(image)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(image) > 2048 {
+			return nil, translate(locale, "The social card image must be an http or https URL.")
+		}
+	}
+
+	return map[string]string{
+		models.SettingOGTitle:       title,
+		models.SettingOGDescription: description,
+		models.SettingOGImage:       image,
+	}, ""
+}
+
+// newSocialPageData builds a link's social card from its settings, falling
+// back to the link's title and description, and then to its destination
+func (a *App) newSocialPageData(r *http.Request, urlData *models.ShortenerData, settings map[string]string) SocialPageData {
+	pageData := SocialPageData{
+		Title:       settings[models.SettingOGTitle],
+		Description: settings[models.SettingOGDescription],
+		Image:       settings[models.SettingOGImage],
+		PublicURL:   a.PublicURL(r, urlData.ShortenedURL),
+		Destination: urlData.OriginalURL,
+	}
+	if pageData.Title == "" {
+		pageData.Title = urlData.Title
+	}
+	if pageData.Title == "" {
+		pageData.Title = urlData.OriginalURL
+	}
+	if pageData.Description == "" {
+		pageData.Description = urlData.Description
+	}
+
+	return pageData
+}
+
+// socialCard renders a small page with a link's Open Graph and Twitter card
+// meta tags for crawlers, which refreshes to the link's destination. It's
+// rendered with html/template, as its content is set by the link's owner and
+// republished by the crawlers. Crawlers' requests aren't counted as clicks.
+// If the destination is on the blocklist, the blocked page is shown instead.
+func (a *App) socialCard(w http.ResponseWriter, r *http.Request, urlData *models.ShortenerData) {
+	if a.blocklist != nil {
+		if _, blocked := a.blocklist.Match(urlData.OriginalURL); blocked {
+			a.blocked(w, r, urlData)
+			return
+		}
+	}
+
+	settings, err := a.urls.Settings(urlData.ShortenedURL)
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	site := a.siteSettings()
+	tmpl, err := template.New("social.html").
+		Funcs(template.FuncMap{"site": func() Site { return site }}).
+		ParseFS(a.templateFiles(), "social.html")
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Vary", "User-Agent")
+	err = tmpl.Execute(w, a.newSocialPageData(r, urlData, settings))
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+	}
+}
+
+// updateSocialCard processes the form for changing a shortened URL's social
+// card, then redirects the user back to the shortened URL's history page.
+func (a *App) updateSocialCard(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	shortenedURL := r.PostForm.Get("url")
+	changes, message := socialChanges(a.locale(r), r.PostForm.Get("og_title"), r.PostForm.Get("og_description"), r.PostForm.Get("og_image"))
+	if message != "" {
+		a.setErrorInFlash(message, w, r)
+		http.Redirect(w, r, historyRoute(shortenedURL), http.StatusSeeOther)
+		return
+	}
+
+	err = a.urls.UpdateSettings(shortenedURL, changes, a.actor(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w, r)
+			return
+		}
+		fmt.Println(err.Error())
+		a.setErrorInFlash(a.locale(r).T("We weren't able to change the URL's social card."), w, r)
+	}
+
+	http.Redirect(w, r, historyRoute(shortenedURL), http.StatusSeeOther)
+}
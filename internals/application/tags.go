@@ -0,0 +1,126 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"gourlshortener/internals/i18n"
+	"gourlshortener/internals/models"
+	"net/http"
+)
+
+// TagResponse is the API representation of a tag, along with the number of
+// links with the tag and their total clicks
+type TagResponse struct {
+	Tag    string `json:"tag"`
+	Links  int    `json:"links"`
+	Clicks int    `json:"clicks"`
+}
+
+// organiseMessage returns a message explaining why a link's folder or tags
+// couldn't be changed, suitable for showing to the user, in the locale's
+// language
+func organiseMessage(locale *i18n.Locale, err error) string {
+	switch {
+	case errors.Is(err, models.ErrInvalidTag):
+		return translate(locale, "Tags can only contain letters, numbers, hyphens, and underscores, be up to 32 characters long, and there can be up to %d of them.", models.MaxTags)
+	case errors.Is(err, models.ErrInvalidFolder):
+		return translate(locale, "Folder names can only contain letters, numbers, spaces, and . / _ -, and be up to %d characters long.", models.MaxFolderLength)
+	default:
+		return translate(locale, "We weren't able to change the URL's folder and tags.")
+	}
+}
+
+// organise changes the folder and/or tags of a shortened URL, leaving either
+// unchanged if it's nil
+func (a *App) organise(shortened string, folder *string, tags *[]string) error {
+	if folder != nil {
+		if err := a.urls.SetFolder(shortened, *folder); err != nil {
+			return err
+		}
+	}
+	if tags != nil {
+		if err := a.urls.SetTags(shortened, *tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// organiseURL processes the form for changing a shortened URL's folder and
+// tags, then redirects the user back to the shortened URL's history page.
+func (a *App) organiseURL(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		fmt.Println(err.Error())
+		a.serverError(w, r, err)
+		return
+	}
+
+	shortenedURL := r.PostForm.Get("url")
+	folder, err := models.NormaliseFolder(r.PostForm.Get("folder"))
+	var tags []string
+	if err == nil {
+		tags, err = models.ParseTags(r.PostForm.Get("tags"))
+	}
+	if err == nil {
+		err = a.organise(shortenedURL, &folder, &tags)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w, r)
+			return
+		}
+		if !errors.Is(err, models.ErrInvalidTag) && !errors.Is(err, models.ErrInvalidFolder) {
+			fmt.Println(err.Error())
+		}
+		a.setErrorInFlash(organiseMessage(a.locale(r), err), w, r)
+	}
+
+	http.Redirect(w, r, historyRoute(shortenedURL), http.StatusSeeOther)
+}
+
+// apiListLinks returns the shortened URLs, newest first, filtered by the tag
+// and folder query parameters, and searched for the q query parameter
+func (a *App) apiListLinks(w http.ResponseWriter, r *http.Request) {
+	urls, err := a.urls.List(models.LinkFilter{
+		Tag:    r.URL.Query().Get("tag"),
+		Folder: r.URL.Query().Get("folder"),
+		Query:  r.URL.Query().Get("q"),
+	})
+	if err != nil {
+		apiModelError(w, err)
+		return
+	}
+
+	linkHealth, err := a.urls.AllHealth()
+	if err != nil {
+		apiModelError(w, err)
+		return
+	}
+
+	response := make([]LinkResponse, 0, len(urls))
+	for _, urlData := range urls {
+		link := newLinkResponse(urlData)
+		link.Health = newHealthResponse(linkHealth[urlData.ShortenedURL])
+		response = append(response, link)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// apiGetTags returns every tag in use, along with the number of links with
+// the tag and their total clicks
+func (a *App) apiGetTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := a.urls.Tags()
+	if err != nil {
+		apiModelError(w, err)
+		return
+	}
+
+	response := make([]TagResponse, 0, len(tags))
+	for _, tag := range tags {
+		response = append(response, TagResponse{Tag: tag.Tag, Links: tag.Links, Clicks: tag.Clicks})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
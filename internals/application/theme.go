@@ -0,0 +1,226 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Site is the branding shown on every page, which templates read with the
+// site function, e.g., {{ site.Name }}
+//
+// LogoURL is shown next to the Name, if it's set, and Stylesheet is included
+// after the default styles, so that a theme can change the colours. The
+// SupportContact is an email address or a URL.
+type Site struct {
+	Name, Footer, LogoURL, SupportContact, Stylesheet string
+	LegalLinks                                        []Link
+}
+
+// Link is a named link, such as one of a Site's legal links
+type Link struct {
+	Name, URL string
+}
+
+// SupportURL returns the URL which contacts the site's support, which is a
+// mailto: URL if the SupportContact is an email address
+func (s Site) SupportURL() string {
+	if strings.Contains(s.SupportContact, "@") && !strings.Contains(s.SupportContact, ":") {
+		return "mailto:" + s.SupportContact
+	}
+	return s.SupportContact
+}
+
+// DefaultSite returns the default branding
+func DefaultSite() Site {
+	return Site{
+		Name:   "A Go URL Shortener",
+		Footer: "Created by Matthew Setter.",
+	}
+}
+
+// WithSite sets the branding shown on every page
+func WithSite(site Site) Option {
+	return func(a *App) {
+		a.site = &site
+	}
+}
+
+// WithTheme sets the theme directory, whose templates and static directories
+// override individual templates, partials, and static assets
+func WithTheme(theme fs.FS) Option {
+	return func(a *App) {
+		a.theme = theme
+	}
+}
+
+// siteSettings returns the App's branding, falling back to the default
+// branding if it wasn't configured
+func (a *App) siteSettings() Site {
+	if a.site == nil {
+		return DefaultSite()
+	}
+	return *a.site
+}
+
+// themed returns base, with the files in the named directory of the App's
+// theme, if it has one, in front of it
+func (a *App) themed(base fs.FS, dir string) fs.FS {
+	if a.theme == nil {
+		return base
+	}
+	theme, err := fs.Sub(a.theme, dir)
+	if err != nil {
+		fmt.Println(err.Error())
+		return base
+	}
+	return overlayFS{theme, base}
+}
+
+// overlayFS is a stack of file systems. Files are opened from the first one
+// which has them, and directories list the files in all of them.
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	for _, layer := range o {
+		file, err := layer.Open(name)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries := map[string]fs.DirEntry{}
+	found := false
+	for i := len(o) - 1; i >= 0; i-- {
+		layerEntries, err := fs.ReadDir(o[i], name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range layerEntries {
+			entries[entry.Name()] = entry
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	merged := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		merged = append(merged, entry)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Name() < merged[j].Name()
+	})
+	return merged, nil
+}
+
+// parseTemplate parses the named template, along with the partials which
+// every page shares, if there are any, with the supplied functions, the site
+// function, and the functions which translate the page into the request's
+// language
+func (a *App) parseTemplate(r *http.Request, name string, funcs template.FuncMap) (*template.Template, error) {
+	files := a.templateFiles()
+	patterns := []string{name}
+	if partials, _ := fs.Glob(files, "partials/*.html"); len(partials) > 0 {
+		patterns = append(patterns, "partials/*.html")
+	}
+
+	site := a.siteSettings()
+	return template.New(name).
+		Funcs(template.FuncMap{
+			"site":        func() Site { return site },
+			"maintenance": a.InMaintenance,
+			"signedIn":    func() string { return signedIn(r) },
+		}).
+		Funcs(localeFuncs(a.locale(r))).
+		Funcs(funcs).
+		ParseFS(files, patterns...)
+}
+
+// ErrorPageData stores the template data for the error pages
+type ErrorPageData struct {
+	Status         int
+	Title, Message string
+}
+
+// errorMessages are the messages shown on the error pages, which are
+// translated into the request's language
+var errorMessages = map[int]string{
+	http.StatusNotFound:            "Sadly, we were not able to find the route that you were looking for.",
+	http.StatusGone:                "This short link has been deleted, so it no longer goes anywhere.",
+	http.StatusTooManyRequests:     "You've made too many requests. Please wait a moment, then try again.",
+	http.StatusServiceUnavailable:  "We're carrying out maintenance, so links can't be created or changed. Please try again later.",
+	http.StatusInternalServerError: "Something went wrong on our side. Please try again later.",
+}
+
+// renderError renders the error page for the supplied status. It's the
+// status's own template, e.g., 404.html, if there is one, or error.html.
+func (a *App) renderError(w http.ResponseWriter, r *http.Request, status int) {
+	name := fmt.Sprintf("%d.html", status)
+	if _, err := fs.Stat(a.templateFiles(), name); err != nil {
+		name = "error.html"
+	}
+
+	tmpl, err := a.parseTemplate(r, name, nil)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	locale := a.locale(r)
+	err = tmpl.Execute(w, ErrorPageData{
+		Status:  status,
+		Title:   locale.T(http.StatusText(status)),
+		Message: locale.T(errorMessages[status]),
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// serverError renders the 500 Internal Server Error page
+func (a *App) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	a.renderError(w, r, http.StatusInternalServerError)
+}
+
+// gone renders the 410 Gone page, for links which have been deleted
+func (a *App) gone(w http.ResponseWriter, r *http.Request) {
+	a.renderError(w, r, http.StatusGone)
+}
+
+// tooManyRequests responds to requests which were rate limited, with JSON for
+// API requests, and the 429 Too Many Requests page for all others
+func (a *App) tooManyRequests(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		apiError(w, http.StatusTooManyRequests, "too many requests, please try again later")
+		return
+	}
+	a.renderError(w, r, http.StatusTooManyRequests)
+}
+
+// wasDeleted reports whether a link with the supplied code existed, but has
+// been deleted
+func (a *App) wasDeleted(code string) bool {
+	deleted, err := a.urls.Deleted(code)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+	return deleted
+}
@@ -0,0 +1,331 @@
+// Package backup takes consistent snapshots of the SQLite database while it's
+// in use, with VACUUM INTO, and restores them.
+//
+// Backups are named after the time that they were taken, in UTC, e.g.,
+// gourlshortener-20261019T142500Z.sqlite3, with a .gz suffix if they're
+// compressed, so that they sort in the order that they were taken.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/migrate"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	prefix = "gourlshortener-"
+	suffix = ".sqlite3"
+	// timeLayout is the layout of the time in a backup's name
+	timeLayout = "20060102T150405Z"
+	// gzipSuffix is added to the names of compressed backups
+	gzipSuffix = ".gz"
+)
+
+// Backup is a backup of the database
+type Backup struct {
+	Name, Path string
+	Size       int64
+	Created    time.Time
+	Compressed bool
+}
+
+// parse returns the backup in the named file, in dir, and whether the file is
+// a backup
+func parse(dir string, entry os.DirEntry) (Backup, bool) {
+	name := entry.Name()
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), gzipSuffix)
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(stamp, suffix) || entry.IsDir() {
+		return Backup{}, false
+	}
+	created, err := time.Parse(timeLayout, strings.TrimSuffix(stamp, suffix))
+	if err != nil {
+		return Backup{}, false
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return Backup{}, false
+	}
+	return Backup{
+		Name:       name,
+		Path:       filepath.Join(dir, name),
+		Size:       info.Size(),
+		Created:    created,
+		Compressed: strings.HasSuffix(name, gzipSuffix),
+	}, true
+}
+
+// Manager takes the backups of a database, keeping them in a directory
+type Manager struct {
+	// Database is the path of the database file
+	Database string
+	// Dir is the directory which backups are written to
+	Dir string
+	// Keep is the number of backups which are kept; the oldest are removed
+	// after each backup. 0 keeps every backup.
+	Keep int
+	// Compress compresses backups with gzip
+	Compress bool
+
+	// mu stops backups from being taken at the same time
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// Create backs up the database into the Manager's directory, creating it if
+// needed, then removes the oldest backups beyond the number to keep. The
+// database can be used while it's backed up.
+func (m *Manager) Create(ctx context.Context) (*Backup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	now := time.Now
+	if m.now != nil {
+		now = m.now
+	}
+	created := now().UTC().Truncate(time.Second)
+	name := prefix + created.Format(timeLayout) + suffix
+	if m.Compress {
+		name += gzipSuffix
+	}
+	path := filepath.Join(m.Dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("backup: %s already exists", name)
+	}
+
+	// The snapshot is written to a temporary file, which isn't listed as a
+	// backup, until it's complete
+	snapshot := filepath.Join(m.Dir, "."+prefix+created.Format(timeLayout)+suffix+".tmp")
+	defer os.Remove(snapshot)
+	if err := m.snapshot(ctx, snapshot); err != nil {
+		return nil, err
+	}
+
+	if m.Compress {
+		compressed := snapshot + gzipSuffix
+		defer os.Remove(compressed)
+		if err := compress(snapshot, compressed); err != nil {
+			return nil, err
+		}
+		snapshot = compressed
+	}
+	if err := os.Rename(snapshot, path); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	backup := &Backup{Name: name, Path: path, Size: info.Size(), Created: created, Compressed: m.Compress}
+	return backup, m.prune()
+}
+
+// snapshot writes a consistent copy of the database to file. It uses its own
+// connection, which only reads the database, so that writes carry on while
+// it's copied.
+func (m *Manager) snapshot(ctx context.Context, file string) error {
+	if _, err := os.Stat(m.Database); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", m.Database+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, `VACUUM INTO ?`, file)
+	return err
+}
+
+// compress writes a gzip-compressed copy of src to dst
+func compress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// List lists the backups in the Manager's directory, newest first
+func (m *Manager) List() ([]Backup, error) {
+	entries, err := os.ReadDir(m.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []Backup{}
+	for _, entry := range entries {
+		if backup, ok := parse(m.Dir, entry); ok {
+			backups = append(backups, backup)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Created.After(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// prune removes the oldest backups beyond the number to keep
+func (m *Manager) prune() error {
+	if m.Keep <= 0 {
+		return nil
+	}
+	backups, err := m.List()
+	if err != nil {
+		return err
+	}
+	for i := m.Keep; i < len(backups); i++ {
+		if err = os.Remove(backups[i].Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Schedule backs up the database every interval until ctx is cancelled,
+// calling onBackup with each backup, or the error which stopped it from being
+// taken
+func (m *Manager) Schedule(ctx context.Context, interval time.Duration, onBackup func(*Backup, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			backup, err := m.Create(ctx)
+			if onBackup != nil {
+				onBackup(backup, err)
+			}
+		}
+	}
+}
+
+// Restored describes a restored backup
+type Restored struct {
+	// Previous is where the database which was replaced was moved to
+	Previous string
+	// Pending are the migrations which the backup doesn't have applied,
+	// which need to be applied before it's used
+	Pending []migrate.Migration
+}
+
+// Restore replaces the database with a backup, which can be compressed. The
+// backup is checked first: it must be intact, and its schema must not be
+// newer than migrations. The database is kept, with a .before-restore
+// suffix. Nothing can be using the database while it's restored.
+func Restore(ctx context.Context, backupFile, database string, migrations []migrate.Migration) (*Restored, error) {
+	// The backup is copied next to the database, so that it can be moved
+	// over it in one step
+	restored := filepath.Join(filepath.Dir(database), "."+filepath.Base(database)+".restore")
+	defer os.Remove(restored)
+	if err := copyBackup(backupFile, restored); err != nil {
+		return nil, err
+	}
+
+	pending, err := check(ctx, restored, migrations)
+	if err != nil {
+		return nil, fmt.Errorf("backup: %s can't be restored: %w", backupFile, err)
+	}
+
+	previous := database + ".before-restore"
+	for _, extension := range []string{"", "-wal", "-shm"} {
+		err = os.Rename(database+extension, previous+extension)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			os.Remove(previous + extension)
+		}
+	}
+	if err = os.Rename(restored, database); err != nil {
+		return nil, err
+	}
+
+	return &Restored{Previous: previous, Pending: pending}, nil
+}
+
+// copyBackup copies a backup to dst, decompressing it if it's compressed
+func copyBackup(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if strings.HasSuffix(src, gzipSuffix) {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("backup: %s: %w", src, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, r); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// check checks that the database in file is intact, and that its schema
+// isn't newer than migrations, returning the migrations which it doesn't
+// have applied
+func check(ctx context.Context, file string, migrations []migrate.Migration) ([]migrate.Migration, error) {
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var result string
+	if err = db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return nil, err
+	}
+	if result != "ok" {
+		return nil, fmt.Errorf("the integrity check failed: %s", result)
+	}
+
+	migrator := &migrate.Migrator{DB: db, Migrations: migrations}
+	return migrator.Pending(ctx)
+}
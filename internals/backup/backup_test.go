@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gourlshortener/internals/migrate"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var testMigrations = []migrate.Migration{
+	{Version: "1", Name: "create_links", Up: `CREATE TABLE links (url TEXT)`, UpTransaction: true},
+	{Version: "2", Name: "add_clicks", Up: `ALTER TABLE links ADD COLUMN clicks INTEGER`, UpTransaction: true},
+}
+
+// newTestDB creates a database in dir, migrated with the supplied migrations,
+// with a link in it
+func newTestDB(t *testing.T, dir string, migrations []migrate.Migration) string {
+	file := filepath.Join(dir, "database.sqlite3")
+	conn, err := sql.Open("sqlite", file+"?_pragma=journal_mode(wal)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	m := &migrate.Migrator{DB: conn, Migrations: migrations}
+	if _, err = m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Exec(`INSERT INTO links (url) VALUES ('https://osnews.com')`); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// countLinks returns the number of links in the database in file
+func countLinks(t *testing.T, file string) int {
+	conn, err := sql.Open("sqlite", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var links int
+	if err = conn.QueryRow(`SELECT COUNT(*) FROM links`).Scan(&links); err != nil {
+		t.Fatal(err)
+	}
+	return links
+}
+
+func TestCreateKeepsTheNewestBackups(t *testing.T) {
+	dir := t.TempDir()
+	database := newTestDB(t, dir, testMigrations)
+
+	now := time.Date(2026, 10, 19, 14, 25, 0, 0, time.UTC)
+	m := &Manager{
+		Database: database,
+		Dir:      filepath.Join(dir, "backups"),
+		Keep:     2,
+		Compress: true,
+		now:      func() time.Time { return now },
+	}
+	for i := 0; i < 3; i++ {
+		backup, err := m.Create(context.Background())
+		if err != nil {
+			t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+		}
+		if want := "gourlshortener-" + now.Format(timeLayout) + ".sqlite3.gz"; backup.Name != want || !backup.Compressed || backup.Size == 0 {
+			t.Errorf("Incorrect backup created. Expected %s; got %+v", want, backup)
+		}
+		now = now.Add(time.Hour)
+	}
+
+	if _, err := m.Create(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(-time.Hour)
+	if _, err := m.Create(context.Background()); err == nil {
+		t.Error("Expected a second backup at the same time to fail")
+	}
+
+	backups, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Created != now.Add(time.Hour) || backups[1].Created != now {
+		t.Errorf("Expected the newest 2 backups to be kept. Got: %+v", backups)
+	}
+	entries, _ := os.ReadDir(m.Dir)
+	if len(entries) != 2 {
+		t.Errorf("Expected no temporary files to be left behind. Got %d files", len(entries))
+	}
+}
+
+func TestRestoreChecksTheBackup(t *testing.T) {
+	dir := t.TempDir()
+	database := newTestDB(t, dir, testMigrations)
+	m := &Manager{Database: database, Dir: filepath.Join(dir, "backups")}
+	backup, err := m.Create(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes made after the backup are undone by restoring it
+	conn, err := sql.Open("sqlite", database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Exec(`INSERT INTO links (url) VALUES ('https://go.dev')`); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if _, err = Restore(context.Background(), backup.Path, database, testMigrations[:1]); !errors.Is(err, migrate.ErrUnknownVersion) {
+		t.Errorf("Expected a backup with a newer schema to be rejected. Got: %v", err)
+	}
+	notBackup := filepath.Join(dir, "notes.txt")
+	if err = os.WriteFile(notBackup, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Restore(context.Background(), notBackup, database, testMigrations); err == nil {
+		t.Error("Expected a file which isn't a database to be rejected")
+	}
+	if links := countLinks(t, database); links != 2 {
+		t.Errorf("Expected the database to be unchanged by failed restores. Got %d links", links)
+	}
+
+	restored, err := Restore(context.Background(), backup.Path, database, append(testMigrations, migrate.Migration{Version: "3"}))
+	if err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if len(restored.Pending) != 1 || restored.Pending[0].Version != "3" {
+		t.Errorf("Expected the newer migration to be pending. Got: %+v", restored.Pending)
+	}
+	if links := countLinks(t, database); links != 1 {
+		t.Errorf("Expected the backup to be restored. Got %d links", links)
+	}
+	if links := countLinks(t, restored.Previous); links != 2 {
+		t.Errorf("Expected the previous database to be kept. Got %d links", links)
+	}
+}
@@ -0,0 +1,242 @@
+// Package blocklist stops known malicious and phishing destinations from being
+// shortened, or from being redirected to.
+//
+// Blocklists are loaded from plain text files, with one rule per line. Blank
+// lines, and lines starting with "#", are ignored. Each rule is one of:
+//
+//	example.com          a plain domain, which blocks that host only
+//	*.example.com        a wildcard suffix, which blocks example.com and all of its subdomains
+//	/^https?://[^/]+/wp-login\.php/
+//	                     a regular expression, between slashes, which is matched against the whole URL
+//
+// Domains are matched case-insensitively, and against the punycode form of
+// internationalised domain names.
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gourlshortener/internals/validation"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrBlocked is wrapped by the errors returned when a URL is on the blocklist
+var ErrBlocked = errors.New("blocklist: url is blocked")
+
+// Rule is a single entry in a blocklist file
+type Rule struct {
+	// Pattern is the rule as it appears in the file
+	Pattern string
+	// File and Line identify where the rule was loaded from
+	File string
+	Line int
+
+	domain string
+	suffix string
+	regex  *regexp.Regexp
+}
+
+// matches reports whether the rule matches the supplied URL, whose host has
+// already been normalised
+func (r Rule) matches(rawURL, host string) bool {
+	switch {
+	case r.regex != nil:
+		return r.regex.MatchString(rawURL)
+	case r.suffix != "":
+		return host == r.suffix || strings.HasSuffix(host, "."+r.suffix)
+	default:
+		return host == r.domain
+	}
+}
+
+// normaliseHost lower-cases a host name and converts it to punycode
+func normaliseHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
+
+// parseRule parses a single, non-empty, line of a blocklist file
+func parseRule(pattern string) (Rule, error) {
+	rule := Rule{Pattern: pattern}
+	switch {
+	case len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"):
+		regex, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return rule, err
+		}
+		rule.regex = regex
+	case strings.HasPrefix(pattern, "*."):
+		rule.suffix = normaliseHost(pattern[2:])
+	case strings.ContainsAny(pattern, "/*: "):
+		return rule, fmt.Errorf("%q is not a domain, wildcard suffix, or regular expression", pattern)
+	default:
+		rule.domain = normaliseHost(pattern)
+	}
+
+	return rule, nil
+}
+
+// parseFile loads every rule in a blocklist file
+func parseFile(file string) ([]Rule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []Rule
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		rule, err := parseRule(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, line, err)
+		}
+		rule.File, rule.Line = file, line
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// fileState records when a blocklist file was last modified, so that changes
+// can be detected
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Blocklist matches URLs against the rules loaded from one or more files.
+// It's safe for concurrent use, including while its files are being reloaded.
+type Blocklist struct {
+	files []string
+
+	mu     sync.RWMutex
+	rules  []Rule
+	states map[string]fileState
+}
+
+// Load creates a Blocklist from the rules in the supplied files
+func Load(files ...string) (*Blocklist, error) {
+	b := &Blocklist{files: files}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload reloads the rules from the blocklist's files. If any file can't be
+// loaded, the existing rules are kept.
+func (b *Blocklist) Reload() error {
+	var rules []Rule
+	states := make(map[string]fileState, len(b.files))
+	for _, file := range b.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		fileRules, err := parseFile(file)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, fileRules...)
+		states[file] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rules = rules
+	b.states = states
+
+	return nil
+}
+
+// changed reports whether any of the blocklist's files have changed since
+// they were last loaded
+func (b *Blocklist) changed() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, file := range b.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return true
+		}
+		if state := b.states[file]; !state.modTime.Equal(info.ModTime()) || state.size != info.Size() {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks the blocklist's files for changes at the supplied interval,
+// reloading them when they change, until the context is cancelled. Errors
+// reloading the files are passed to onError, and the existing rules are kept.
+func (b *Blocklist) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !b.changed() {
+				continue
+			}
+			if err := b.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Len returns the number of rules in the blocklist
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.rules)
+}
+
+// Match returns the first rule which matches the supplied URL, if any
+func (b *Blocklist) Match(rawURL string) (Rule, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Rule{}, false
+	}
+	host := normaliseHost(u.Hostname())
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, rule := range b.rules {
+		if rule.matches(rawURL, host) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Validate implements validation.Step, rejecting URLs which are on the
+// blocklist
+func (b *Blocklist) Validate(ctx context.Context, u *url.URL) error {
+	if _, blocked := b.Match(u.String()); blocked {
+		return validation.NewError(ErrBlocked, "This URL can't be shortened, as it points to a known malicious or phishing site.")
+	}
+	return nil
+}
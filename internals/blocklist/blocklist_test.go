@@ -0,0 +1,101 @@
+package blocklist
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchesRules(t *testing.T) {
+	b, err := Load("./testdata/blocklist.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 3 {
+		t.Errorf("Incorrect number of rules loaded. Expected %d; got %d", 3, b.Len())
+	}
+
+	tests := map[string]string{
+		"https://phishing.example/login":         "phishing.example",
+		"https://PHISHING.example.":              "phishing.example",
+		"https://www.phishing.example":           "",
+		"https://malware.example":                "*.malware.example",
+		"https://cdn.eu.malware.example/x.exe":   "*.malware.example",
+		"https://notmalware.example":             "",
+		"https://osnews.com/wp-login.php?x=1":    `/^https?://[^/]+/wp-login\.php/`,
+		"https://osnews.com/story/wp-login.php":  "",
+		"https://osnews.com/story/1/go-released": "",
+	}
+	for input, expected := range tests {
+		rule, blocked := b.Match(input)
+		if blocked != (expected != "") || rule.Pattern != expected {
+			t.Errorf("%s: got rule '%s' (blocked = %t); want '%s'", input, rule.Pattern, blocked, expected)
+		}
+	}
+}
+
+func TestRejectsInvalidRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(file, []byte("phishing.example\nhttps://osnews.com/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(file); err == nil {
+		t.Error("Expected an error to be returned for an invalid rule")
+	}
+}
+
+func TestValidateReturnsBlockedError(t *testing.T) {
+	b, err := Load("./testdata/blocklist.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("https://phishing.example")
+	if err = b.Validate(context.Background(), u); !errors.Is(err, ErrBlocked) {
+		t.Errorf("got error %v; want %v", err, ErrBlocked)
+	}
+}
+
+func TestWatchReloadsChangedFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(file, []byte("phishing.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the watcher to stop before the file is removed
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		b.Watch(ctx, 10*time.Millisecond, func(err error) {
+			t.Error(err)
+		})
+	}()
+
+	if err = os.WriteFile(file, []byte("phishing.example\n*.malware.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, blocked := b.Match("https://malware.example"); blocked {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("The blocklist was not reloaded after its file changed")
+}
@@ -0,0 +1,605 @@
+// Package cli implements the admin subcommands of the gourlshortener binary,
+// which manage links directly in the database, so that maintenance can be
+// scripted without the web UI.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gourlshortener/internals/backup"
+	"gourlshortener/internals/config"
+	"gourlshortener/internals/exporter"
+	"gourlshortener/internals/importer"
+	"gourlshortener/internals/migrate"
+	"gourlshortener/internals/models"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Usage describes the admin subcommands
+const Usage = `Usage: gourlshortener [flags] <command> [arguments]
+
+Commands:
+  serve                               start the web server (the default)
+  links list                          list every link, newest first
+  links get <code|url>                show a link
+  links create <url>                  shorten a URL
+  links update <code|url> <url>       change a link's destination
+  links delete <code|url>             delete a link
+  links import [--dry-run] <file>     import links from a CSV or JSON Lines
+                                      file, or from stdin if file is -
+  links export [flags]                write every link, with its statistics,
+                                      to stdout as CSV, JSON, or NDJSON
+  stats <code|url>                    show a link's statistics
+  migrate up                          apply every pending database migration
+  migrate down                        roll back the latest database migration
+  migrate status                      list the database migrations
+  config print                        print the configuration, as TOML, with
+                                      secrets redacted, and check it
+  backup                              back up the database while it's in use
+  backup list                         list the backups, newest first
+  restore <file>                      replace the database with a backup;
+                                      stop the server first
+  users list                          list the users who can change links
+  users create <name>                 add a user
+  users delete <name>                 delete a user, and their API keys
+  keys list [--user]                  list every API key, or a user's keys
+  keys create [--name] <user>         create an API key for a user, which is
+                                      only shown once
+  keys revoke <id>                    revoke an API key
+
+The links, stats, users, and keys commands accept a --format flag, which is either
+"table" (the default) or "json". links import takes the file's format from its
+extension, unless --input is "csv" or "jsonl", and fails if any row is invalid.
+links export's --format is "csv" (the default), "json", or "ndjson". Its links
+can be filtered with --from and --to dates, e.g., 2024-02-21, and --min-clicks
+and --max-clicks, and --format-clicks adds thousands separators to clicks.
+
+backup writes to --backup-dir, and keeps the newest --backup-keep backups.
+restore checks the backup before it replaces the database, which it keeps
+with a .before-restore suffix.
+
+Every setting can be set with a flag, before the command, which overrides its
+environment variable and the config file in --config; run gourlshortener -h
+to list them.
+`
+
+// Env is everything that the subcommands need to run
+type Env struct {
+	URLs models.ShortenerDataInterface
+	// Users manages the users who can change links, and their API keys
+	Users models.UserDataInterface
+	// Create validates and shortens a URL, in the same way as the web UI
+	Create func(ctx context.Context, originalURL string) (*models.ShortenerData, error)
+	// Validate validates and normalises a URL, in the same way as the web UI
+	Validate func(ctx context.Context, rawURL string) (string, error)
+	// Import validates and imports links in bulk, in the same way as the web UI
+	Import func(ctx context.Context, r io.Reader, format, actor string, dryRun bool) (*importer.Report, error)
+	// Actor identifies who is running the command, in links' revision history
+	Actor string
+	// Migrator applies the database migrations
+	Migrator *migrate.Migrator
+	// Config is the application's configuration
+	Config *config.Config
+	// Backups takes and lists the database's backups
+	Backups *backup.Manager
+	// Restore replaces the database with a backup
+	Restore        func(ctx context.Context, file string) (*backup.Restored, error)
+	Stdout, Stderr io.Writer
+}
+
+// errUsage is returned when a command is run with the wrong arguments
+var errUsage = errors.New("cli: invalid usage")
+
+// Run runs the supplied command with its arguments, returning the exit
+// status: 0 on success, 1 if the command failed, and 2 if it was used
+// incorrectly
+func Run(ctx context.Context, env Env, command string, args []string) int {
+	var err error
+	switch command {
+	case "links":
+		err = runLinks(ctx, env, args)
+	case "stats":
+		err = runStats(env, args)
+	case "migrate":
+		err = runMigrate(ctx, env, args)
+	case "config":
+		err = runConfig(env, args)
+	case "backup":
+		err = runBackup(ctx, env, args)
+	case "restore":
+		err = runRestore(ctx, env, args)
+	case "users":
+		err = runUsers(env, args)
+	case "keys":
+		err = runKeys(env, args)
+	case "help", "-h", "--help":
+		fmt.Fprint(env.Stdout, Usage)
+		return 0
+	default:
+		err = fmt.Errorf("%w: unknown command %q", errUsage, command)
+	}
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp):
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(env.Stderr, strings.TrimPrefix(err.Error(), errUsage.Error()+": "))
+		}
+		fmt.Fprint(env.Stderr, Usage)
+		return 2
+	default:
+		fmt.Fprintln(env.Stderr, err)
+		return 1
+	}
+}
+
+// parseFlags parses a subcommand's flags, returning the output format and the
+// remaining arguments, which must number exactly want. extra, if not nil,
+// defines the subcommand's other flags.
+func parseFlags(name string, args []string, want int, extra func(*flag.FlagSet)) (string, []string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", "table", `output format: "table" or "json"`)
+	if extra != nil {
+		extra(flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return "", nil, err
+		}
+		return "", nil, fmt.Errorf("%w: %s", errUsage, err)
+	}
+	if *format != "table" && *format != "json" {
+		return "", nil, fmt.Errorf("%w: unknown format %q", errUsage, *format)
+	}
+	if flags.NArg() != want {
+		return "", nil, fmt.Errorf("%w: %s takes %d argument(s)", errUsage, name, want)
+	}
+
+	return *format, flags.Args(), nil
+}
+
+// resolve retrieves the link identified by either its shortened URL or its
+// code
+func resolve(env Env, link string) (*models.ShortenerData, error) {
+	var (
+		urlData *models.ShortenerData
+		err     error
+	)
+	if strings.Contains(link, "://") {
+		urlData, err = env.URLs.Get(link)
+	} else {
+		urlData, err = env.URLs.GetByCode(link)
+	}
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil, fmt.Errorf("no link matching %s was found", link)
+	}
+	return urlData, err
+}
+
+func runLinks(ctx context.Context, env Env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: links requires a subcommand", errUsage)
+	}
+
+	subcommand, args := args[0], args[1:]
+	switch subcommand {
+	case "list":
+		format, _, err := parseFlags("links list", args, 0, nil)
+		if err != nil {
+			return err
+		}
+		urls, err := env.URLs.Latest()
+		if err != nil {
+			return err
+		}
+		return writeLinks(env.Stdout, format, urls)
+
+	case "get":
+		format, args, err := parseFlags("links get", args, 1, nil)
+		if err != nil {
+			return err
+		}
+		urlData, err := resolve(env, args[0])
+		if err != nil {
+			return err
+		}
+		return writeLink(env.Stdout, format, urlData)
+
+	case "create":
+		format, args, err := parseFlags("links create", args, 1, nil)
+		if err != nil {
+			return err
+		}
+		urlData, err := env.Create(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return writeLink(env.Stdout, format, urlData)
+
+	case "update":
+		format, args, err := parseFlags("links update", args, 2, nil)
+		if err != nil {
+			return err
+		}
+		urlData, err := resolve(env, args[0])
+		if err != nil {
+			return err
+		}
+		destination, err := env.Validate(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		if err = env.URLs.Update(urlData.ShortenedURL, destination, env.Actor); err != nil {
+			return err
+		}
+		urlData.OriginalURL = destination
+		return writeLink(env.Stdout, format, urlData)
+
+	case "delete":
+		_, args, err := parseFlags("links delete", args, 1, nil)
+		if err != nil {
+			return err
+		}
+		urlData, err := resolve(env, args[0])
+		if err != nil {
+			return err
+		}
+		if err = env.URLs.Delete(urlData.ShortenedURL); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "Deleted %s\n", urlData.ShortenedURL)
+		return nil
+
+	case "import":
+		return runImport(ctx, env, args)
+
+	case "export":
+		return runExport(env, args)
+
+	default:
+		return fmt.Errorf("%w: unknown links subcommand %q", errUsage, subcommand)
+	}
+}
+
+// errInvalidRows is returned when some of an import's rows are invalid
+var errInvalidRows = errors.New("some rows are invalid, and weren't imported")
+
+func runImport(ctx context.Context, env Env, args []string) error {
+	var (
+		dryRun bool
+		input  string
+	)
+	format, args, err := parseFlags("links import", args, 1, func(flags *flag.FlagSet) {
+		flags.BoolVar(&dryRun, "dry-run", false, "check the file, without importing anything")
+		flags.StringVar(&input, "input", "", `the file's format: "csv" or "jsonl"`)
+	})
+	if err != nil {
+		return err
+	}
+
+	if input == "" {
+		input = importer.FormatFromFilename(args[0])
+	}
+	if input != importer.FormatCSV && input != importer.FormatJSONL {
+		return fmt.Errorf("%w: set --input to csv or jsonl", errUsage)
+	}
+
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	report, err := env.Import(ctx, r, input, env.Actor, dryRun)
+	if err != nil {
+		return err
+	}
+	if err = writeReport(env.Stdout, format, report); err != nil {
+		return err
+	}
+	if report.Invalid > 0 {
+		return errInvalidRows
+	}
+	return nil
+}
+
+func runExport(env Env, args []string) error {
+	flags := flag.NewFlagSet("links export", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", exporter.FormatCSV, `output format: "csv", "json", or "ndjson"`)
+	from := flags.String("from", "", "only export links created on or after this date")
+	to := flags.String("to", "", "only export links created on or before this date")
+	minClicks := flags.String("min-clicks", "", "only export links with at least this many clicks")
+	maxClicks := flags.String("max-clicks", "", "only export links with at most this many clicks")
+	formatClicks := flags.Bool("format-clicks", false, "write clicks with thousands separators")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %s", errUsage, err)
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("%w: links export takes no arguments", errUsage)
+	}
+
+	filter, err := exporter.ParseFilter(*from, *to, *minClicks, *maxClicks)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errUsage, strings.TrimPrefix(err.Error(), "exporter: "))
+	}
+	writer, err := exporter.NewWriter(env.Stdout, *format, *formatClicks)
+	if err != nil {
+		return fmt.Errorf("%w: unknown format %q", errUsage, *format)
+	}
+
+	if err = env.URLs.Export(filter, writer.Write); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func runStats(env Env, args []string) error {
+	format, args, err := parseFlags("stats", args, 1, nil)
+	if err != nil {
+		return err
+	}
+	urlData, err := resolve(env, args[0])
+	if err != nil {
+		return err
+	}
+	stats, err := env.URLs.Stats(urlData.ShortenedURL)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		return writeJSON(env.Stdout, statsOutput{
+			OriginalURL:  stats.OriginalURL,
+			ShortenedURL: stats.ShortenedURL,
+			Clicks:       stats.Clicks,
+			Revisions:    stats.Revisions,
+			Created:      stats.Created,
+			Updated:      stats.Updated,
+		})
+	}
+
+	tw := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Shortened URL\t%s\n", stats.ShortenedURL)
+	fmt.Fprintf(tw, "Original URL\t%s\n", stats.OriginalURL)
+	fmt.Fprintf(tw, "Clicks\t%d\n", stats.Clicks)
+	fmt.Fprintf(tw, "Revisions\t%d\n", stats.Revisions)
+	fmt.Fprintf(tw, "Created\t%s\n", stats.Created.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Updated\t%s\n", stats.Updated.Format(time.RFC3339))
+	return tw.Flush()
+}
+
+func runMigrate(ctx context.Context, env Env, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: migrate requires one of up, down, or status", errUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := env.Migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(env.Stdout, "Applied %s\n", migration.Filename())
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(env.Stdout, "The database is up to date")
+		}
+		return err
+
+	case "down":
+		migration, err := env.Migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "Rolled back %s\n", migration.Filename())
+		return nil
+
+	case "status":
+		statuses, err := env.Migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied"
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", state, status.Filename())
+		}
+		return tw.Flush()
+
+	default:
+		return fmt.Errorf("%w: unknown migrate subcommand %q", errUsage, args[0])
+	}
+}
+
+// runConfig prints the configuration, then fails if it's invalid, listing
+// every problem with it
+func runConfig(env Env, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("%w: config requires print", errUsage)
+	}
+
+	if err := env.Config.Write(env.Stdout); err != nil {
+		return err
+	}
+	return env.Config.Validate()
+}
+
+// runBackup backs up the database, or lists its backups
+func runBackup(ctx context.Context, env Env, args []string) error {
+	if len(args) > 0 && args[0] == "list" {
+		format, _, err := parseFlags("backup list", args[1:], 0, nil)
+		if err != nil {
+			return err
+		}
+		backups, err := env.Backups.List()
+		if err != nil {
+			return err
+		}
+		return writeBackups(env.Stdout, format, backups)
+	}
+
+	format, _, err := parseFlags("backup", args, 0, nil)
+	if err != nil {
+		return err
+	}
+	created, err := env.Backups.Create(ctx)
+	if err != nil {
+		return err
+	}
+	return writeBackups(env.Stdout, format, []backup.Backup{*created})
+}
+
+// runRestore replaces the database with a backup, then lists the migrations
+// which the backup needs applied
+func runRestore(ctx context.Context, env Env, args []string) error {
+	_, args, err := parseFlags("restore", args, 1, nil)
+	if err != nil {
+		return err
+	}
+	restored, err := env.Restore(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(env.Stdout, "Restored %s; the previous database was moved to %s\n", args[0], restored.Previous)
+	if len(restored.Pending) > 0 {
+		fmt.Fprintln(env.Stdout, "Run migrate up, or start the server, to apply its pending migrations:")
+		for _, migration := range restored.Pending {
+			fmt.Fprintf(env.Stdout, "  %s\n", migration.Filename())
+		}
+	}
+	return nil
+}
+
+func runUsers(env Env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: users requires a subcommand", errUsage)
+	}
+
+	subcommand, args := args[0], args[1:]
+	switch subcommand {
+	case "list":
+		format, _, err := parseFlags("users list", args, 0, nil)
+		if err != nil {
+			return err
+		}
+		users, err := env.Users.Users()
+		if err != nil {
+			return err
+		}
+		return writeUsers(env.Stdout, format, users)
+
+	case "create":
+		format, args, err := parseFlags("users create", args, 1, nil)
+		if err != nil {
+			return err
+		}
+		switch err = env.Users.CreateUser(args[0]); {
+		case errors.Is(err, models.ErrInvalidUser):
+			return errors.New("user names can only contain lower-case letters, numbers, and . _ -, and be up to 32 characters long")
+		case errors.Is(err, models.ErrDuplicate):
+			return fmt.Errorf("the user %s already exists", args[0])
+		case err != nil:
+			return err
+		}
+		return writeUsers(env.Stdout, format, []*models.User{{Name: args[0], Created: time.Now().UTC()}})
+
+	case "delete":
+		_, args, err := parseFlags("users delete", args, 1, nil)
+		if err != nil {
+			return err
+		}
+		err = env.Users.DeleteUser(args[0])
+		if errors.Is(err, models.ErrNoRecord) {
+			return fmt.Errorf("no user named %s was found", args[0])
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "Deleted %s, and their API keys\n", args[0])
+		return nil
+
+	default:
+		return fmt.Errorf("%w: unknown users subcommand %q", errUsage, subcommand)
+	}
+}
+
+func runKeys(env Env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: keys requires a subcommand", errUsage)
+	}
+
+	subcommand, args := args[0], args[1:]
+	switch subcommand {
+	case "list":
+		var user string
+		format, _, err := parseFlags("keys list", args, 0, func(flags *flag.FlagSet) {
+			flags.StringVar(&user, "user", "", "only list this user's keys")
+		})
+		if err != nil {
+			return err
+		}
+		keys, err := env.Users.Keys(user)
+		if err != nil {
+			return err
+		}
+		return writeKeys(env.Stdout, format, keys)
+
+	case "create":
+		var name string
+		format, args, err := parseFlags("keys create", args, 1, func(flags *flag.FlagSet) {
+			flags.StringVar(&name, "name", "", "what the key is for")
+		})
+		if err != nil {
+			return err
+		}
+		created, key, err := env.Users.CreateKey(args[0], name)
+		if errors.Is(err, models.ErrNoRecord) {
+			return fmt.Errorf("no user named %s was found", args[0])
+		}
+		if err != nil {
+			return err
+		}
+		return writeCreatedKey(env.Stdout, format, created, key)
+
+	case "revoke":
+		_, args, err := parseFlags("keys revoke", args, 1, nil)
+		if err != nil {
+			return err
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("%w: %q is not an API key's ID", errUsage, args[0])
+		}
+		err = env.Users.RevokeKey(id)
+		if errors.Is(err, models.ErrNoRecord) {
+			return fmt.Errorf("no API key with the ID %d was found", id)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "Revoked API key %d\n", id)
+		return nil
+
+	default:
+		return fmt.Errorf("%w: unknown keys subcommand %q", errUsage, subcommand)
+	}
+}
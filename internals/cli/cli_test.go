@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"gourlshortener/internals/backup"
+	"gourlshortener/internals/config"
+	"gourlshortener/internals/importer"
+	"gourlshortener/internals/migrate"
+	"gourlshortener/internals/models"
+	"gourlshortener/internals/models/mocks"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+func newTestEnv() (Env, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	env := Env{
+		URLs:  &mocks.ShortenerDataModel{},
+		Users: &mocks.UserModel{},
+		Create: func(ctx context.Context, originalURL string) (*models.ShortenerData, error) {
+			return &models.ShortenerData{OriginalURL: originalURL, ShortenedURL: "https://abc123"}, nil
+		},
+		Validate: func(ctx context.Context, rawURL string) (string, error) {
+			if !strings.HasPrefix(rawURL, "https://") {
+				return "", errors.New("invalid url")
+			}
+			return rawURL, nil
+		},
+		Import: func(ctx context.Context, r io.Reader, format, actor string, dryRun bool) (*importer.Report, error) {
+			rows, err := importer.Parse(r, format)
+			if err != nil {
+				return nil, err
+			}
+			report := &importer.Report{DryRun: dryRun}
+			for _, row := range rows {
+				status := importer.StatusCreated
+				if row.Reason != "" {
+					status = importer.StatusInvalid
+				}
+				report.Add(importer.Result{Line: row.Line, Destination: row.Destination, Status: status, Reason: row.Reason})
+			}
+			return report, nil
+		},
+		Actor:  "cli:test",
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	return env, &stdout, &stderr
+}
+
+func TestRunCommands(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		status int
+		output string
+	}{
+		{"list", []string{"links", "list"}, 0, "https://osnews.com"},
+		{"get by code", []string{"links", "get", "shorten3d"}, 0, "http://shorten3d"},
+		{"get by url", []string{"links", "get", "http://shorten3d"}, 0, "2120"},
+		{"get missing", []string{"links", "get", "missing"}, 1, ""},
+		{"create", []string{"links", "create", "https://go.dev"}, 0, "https://abc123"},
+		{"update", []string{"links", "update", "shorten3d", "https://go.dev"}, 0, "https://go.dev"},
+		{"update invalid", []string{"links", "update", "shorten3d", "ftp://go.dev"}, 1, ""},
+		{"delete", []string{"links", "delete", "shorten3d"}, 0, "Deleted http://shorten3d"},
+		{"stats", []string{"stats", "shorten3d"}, 0, "Revisions"},
+		{"export", []string{"links", "export", "--format", "ndjson", "--min-clicks", "100"}, 0, `"clicks":2120`},
+		{"export filtered out", []string{"links", "export", "--max-clicks", "100"}, 0, "shortened_url,original_url"},
+		{"export invalid date", []string{"links", "export", "--from", "yesterday"}, 2, ""},
+		{"help", []string{"help"}, 0, "Usage:"},
+		{"list users", []string{"users", "list"}, 0, "ops"},
+		{"create user", []string{"users", "create", "support"}, 0, "support"},
+		{"create existing user", []string{"users", "create", "ops"}, 1, ""},
+		{"delete user", []string{"users", "delete", "ops"}, 0, "Deleted ops"},
+		{"list keys", []string{"keys", "list", "--user", "ops"}, 0, "deploys"},
+		{"create key", []string{"keys", "create", "--name", "ci", "ops"}, 0, "another-mock-api-key"},
+		{"create key for missing user", []string{"keys", "create", "missing"}, 1, ""},
+		{"revoke key", []string{"keys", "revoke", "1"}, 0, "Revoked API key 1"},
+		{"revoke invalid key", []string{"keys", "revoke", "first"}, 2, ""},
+		{"unknown command", []string{"widgets"}, 2, ""},
+		{"unknown subcommand", []string{"links", "rename"}, 2, ""},
+		{"missing argument", []string{"links", "get"}, 2, ""},
+		{"unknown format", []string{"links", "list", "--format", "xml"}, 2, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, stdout, stderr := newTestEnv()
+			status := Run(context.Background(), env, tt.args[0], tt.args[1:])
+			if status != tt.status {
+				t.Errorf("Incorrect exit status. Expected %d; got %d (stderr: %s)", tt.status, status, stderr)
+			}
+			if !strings.Contains(stdout.String(), tt.output) {
+				t.Errorf("Expected the output to contain %q. Got: %s", tt.output, stdout)
+			}
+		})
+	}
+}
+
+func TestRunWithJSONFormat(t *testing.T) {
+	env, stdout, _ := newTestEnv()
+	if status := Run(context.Background(), env, "stats", []string{"--format", "json", "shorten3d"}); status != 0 {
+		t.Fatalf("Incorrect exit status. Expected %d; got %d", 0, status)
+	}
+
+	var stats statsOutput
+	if err := json.Unmarshal(stdout.Bytes(), &stats); err != nil {
+		t.Fatalf("Could not decode the output: %s", err)
+	}
+	if stats.Clicks != 2120 || stats.Revisions != 1 {
+		t.Errorf("Incorrect statistics returned. Got: %+v", stats)
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	conn, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	migrator, err := migrate.New(conn, fstest.MapFS{
+		"1_create_things.sql": {Data: []byte("-- migrate:up\nCREATE TABLE things (name TEXT);\n-- migrate:down\nDROP TABLE things;\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ subcommand, output string }{
+		{"status", "pending  1_create_things.sql"},
+		{"up", "Applied 1_create_things.sql"},
+		{"status", "applied  1_create_things.sql"},
+		{"down", "Rolled back 1_create_things.sql"},
+	} {
+		env, stdout, stderr := newTestEnv()
+		env.Migrator = migrator
+		if status := Run(context.Background(), env, "migrate", []string{tt.subcommand}); status != 0 {
+			t.Fatalf("migrate %s failed with status %d: %s", tt.subcommand, status, stderr)
+		}
+		if !strings.Contains(stdout.String(), tt.output) {
+			t.Errorf("Expected migrate %s to output %q. Got: %s", tt.subcommand, tt.output, stdout)
+		}
+	}
+}
+
+func TestRunImport(t *testing.T) {
+	dir := t.TempDir()
+	valid, invalid := filepath.Join(dir, "valid.csv"), filepath.Join(dir, "invalid.jsonl")
+	os.WriteFile(valid, []byte("destination\nhttps://go.dev\n"), 0o644)
+	os.WriteFile(invalid, []byte("{\"destination\": \"https://go.dev\"}\nnot json\n"), 0o644)
+
+	tests := []struct {
+		name   string
+		args   []string
+		status int
+		output string
+	}{
+		{"dry run", []string{"import", "--dry-run", valid}, 0, "1 would be created"},
+		{"invalid rows", []string{"import", invalid}, 1, "1 created, 0 skipped as duplicates, 1 invalid"},
+		{"unknown format", []string{"import", filepath.Join(dir, "links.txt")}, 2, ""},
+		{"missing file", []string{"import", filepath.Join(dir, "missing.csv")}, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, stdout, stderr := newTestEnv()
+			status := Run(context.Background(), env, "links", tt.args)
+			if status != tt.status {
+				t.Errorf("Incorrect exit status. Expected %d; got %d (stderr: %s)", tt.status, status, stderr)
+			}
+			if !strings.Contains(stdout.String(), tt.output) {
+				t.Errorf("Expected the output to contain %q. Got: %s", tt.output, stdout)
+			}
+		})
+	}
+}
+
+func TestRunConfigPrint(t *testing.T) {
+	env, stdout, stderr := newTestEnv()
+	env.Config = config.Default()
+	env.Config.Server.AuthenticationKey = "not-long-enough"
+
+	status := Run(context.Background(), env, "config", []string{"print"})
+	if status != 1 {
+		t.Errorf("got status %d; want 1, as the configuration is invalid", status)
+	}
+	if !strings.Contains(stdout.String(), `authentication_key = "[redacted]"`) {
+		t.Errorf("expected the authentication key to be redacted, got:\n%s", stdout.String())
+	}
+	if strings.Contains(stdout.String(), "not-long-enough") {
+		t.Error("did not expect the authentication key to be printed")
+	}
+	if !strings.Contains(stderr.String(), "server.authentication_key: must be at least 32 bytes long") {
+		t.Errorf("expected the invalid key to be reported, got:\n%s", stderr.String())
+	}
+
+	if status = Run(context.Background(), env, "config", nil); status != 2 {
+		t.Errorf("got status %d; want 2 without a subcommand", status)
+	}
+}
+
+func TestRunBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	database := filepath.Join(dir, "test.sqlite")
+	conn, err := sql.Open("sqlite", database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.Exec(`CREATE TABLE things (name TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+
+	env, stdout, stderr := newTestEnv()
+	env.Backups = &backup.Manager{Database: database, Dir: filepath.Join(dir, "backups")}
+	if status := Run(context.Background(), env, "backup", []string{"--format", "json"}); status != 0 {
+		t.Fatalf("backup failed with status %d: %s", status, stderr)
+	}
+	var created []backupOutput
+	if err = json.Unmarshal(stdout.Bytes(), &created); err != nil || len(created) != 1 || created[0].Size == 0 {
+		t.Fatalf("Expected the backup to be written as JSON. Got: %s", stdout)
+	}
+
+	env, stdout, _ = newTestEnv()
+	env.Backups = &backup.Manager{Database: database, Dir: filepath.Join(dir, "backups")}
+	if status := Run(context.Background(), env, "backup", []string{"list"}); status != 0 || !strings.Contains(stdout.String(), created[0].Path) {
+		t.Errorf("Expected backup list to list the backup. Got status %d: %s", status, stdout)
+	}
+
+	env, stdout, _ = newTestEnv()
+	env.Restore = func(ctx context.Context, file string) (*backup.Restored, error) {
+		return &backup.Restored{
+			Previous: database + ".before-restore",
+			Pending:  []migrate.Migration{{Version: "2", Name: "add_things"}},
+		}, nil
+	}
+	if status := Run(context.Background(), env, "restore", []string{created[0].Path}); status != 0 {
+		t.Errorf("restore failed with status %d", status)
+	}
+	if !strings.Contains(stdout.String(), "2_add_things.sql") {
+		t.Errorf("Expected the pending migrations to be listed. Got: %s", stdout)
+	}
+	if status := Run(context.Background(), env, "restore", nil); status != 2 {
+		t.Errorf("got status %d; want 2 without a file", status)
+	}
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"gourlshortener/internals/backup"
+	"gourlshortener/internals/importer"
+	"gourlshortener/internals/models"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// linkOutput is the JSON representation of a link
+type linkOutput struct {
+	OriginalURL  string `json:"original_url"`
+	ShortenedURL string `json:"shortened_url"`
+	Clicks       int    `json:"clicks"`
+}
+
+// statsOutput is the JSON representation of a link's statistics
+type statsOutput struct {
+	OriginalURL  string    `json:"original_url"`
+	ShortenedURL string    `json:"shortened_url"`
+	Clicks       int       `json:"clicks"`
+	Revisions    int       `json:"revisions"`
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+}
+
+// backupOutput is the JSON representation of a backup
+type backupOutput struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	Created    time.Time `json:"created"`
+	Compressed bool      `json:"compressed"`
+}
+
+// userOutput is the JSON representation of a user
+type userOutput struct {
+	Name    string    `json:"name"`
+	Keys    int       `json:"keys"`
+	Created time.Time `json:"created"`
+}
+
+// keyOutput is the JSON representation of an API key. Key is only set when
+// the key is created.
+type keyOutput struct {
+	ID      int       `json:"id"`
+	User    string    `json:"user"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Key     string    `json:"key,omitempty"`
+}
+
+func newLinkOutput(urlData *models.ShortenerData) linkOutput {
+	return linkOutput{
+		OriginalURL:  urlData.OriginalURL,
+		ShortenedURL: urlData.ShortenedURL,
+		Clicks:       urlData.Clicks,
+	}
+}
+
+func writeJSON(w io.Writer, data any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// writeLinks writes a list of links as a table or as a JSON array
+func writeLinks(w io.Writer, format string, urls []*models.ShortenerData) error {
+	if format == "json" {
+		links := make([]linkOutput, 0, len(urls))
+		for _, urlData := range urls {
+			links = append(links, newLinkOutput(urlData))
+		}
+		return writeJSON(w, links)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SHORTENED URL\tORIGINAL URL\tCLICKS")
+	for _, urlData := range urls {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", urlData.ShortenedURL, urlData.OriginalURL, urlData.Clicks)
+	}
+	return tw.Flush()
+}
+
+// writeLink writes a single link as a table or as a JSON object
+func writeLink(w io.Writer, format string, urlData *models.ShortenerData) error {
+	if format == "json" {
+		return writeJSON(w, newLinkOutput(urlData))
+	}
+	return writeLinks(w, format, []*models.ShortenerData{urlData})
+}
+
+// writeReport writes an import's report as a table followed by a summary, or
+// as a JSON object
+func writeReport(w io.Writer, format string, report *importer.Report) error {
+	if format == "json" {
+		return writeJSON(w, report)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tSTATUS\tDESTINATION\tSHORTENED URL OR REASON")
+	for _, result := range report.Results {
+		detail := result.ShortenedURL
+		if result.Reason != "" {
+			detail = result.Reason
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", result.Line, result.Status, result.Destination, detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	verb := "created"
+	if report.DryRun {
+		verb = "would be created"
+	}
+	_, err := fmt.Fprintf(w, "\n%d %s, %d skipped as duplicates, %d invalid\n", report.Created, verb, report.Duplicates, report.Invalid)
+	return err
+}
+
+// writeBackups writes a list of backups as a table or as a JSON array
+func writeBackups(w io.Writer, format string, backups []backup.Backup) error {
+	if format == "json" {
+		output := make([]backupOutput, 0, len(backups))
+		for _, b := range backups {
+			output = append(output, backupOutput(b))
+		}
+		return writeJSON(w, output)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CREATED\tSIZE\tPATH")
+	for _, b := range backups {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", b.Created.Format(time.RFC3339), b.Size, b.Path)
+	}
+	return tw.Flush()
+}
+
+// writeUsers writes a list of users as a table or as a JSON array
+func writeUsers(w io.Writer, format string, users []*models.User) error {
+	if format == "json" {
+		output := make([]userOutput, 0, len(users))
+		for _, user := range users {
+			output = append(output, userOutput(*user))
+		}
+		return writeJSON(w, output)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tKEYS\tCREATED")
+	for _, user := range users {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", user.Name, user.Keys, user.Created.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// writeKeys writes a list of API keys as a table or as a JSON array, without
+// the keys themselves, which aren't stored
+func writeKeys(w io.Writer, format string, keys []*models.APIKey) error {
+	if format == "json" {
+		output := make([]keyOutput, 0, len(keys))
+		for _, key := range keys {
+			output = append(output, keyOutput{ID: key.ID, User: key.User, Name: key.Name, Created: key.Created})
+		}
+		return writeJSON(w, output)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSER\tNAME\tCREATED")
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", key.ID, key.User, key.Name, key.Created.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// writeCreatedKey writes a newly created API key, along with the key itself,
+// which can't be shown again
+func writeCreatedKey(w io.Writer, format string, created *models.APIKey, key string) error {
+	if format == "json" {
+		return writeJSON(w, keyOutput{ID: created.ID, User: created.User, Name: created.Name, Created: created.Created, Key: key})
+	}
+
+	if err := writeKeys(w, format, []*models.APIKey{created}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nAPI key: %s\nStore it somewhere safe; it can't be shown again.\n", key)
+	return err
+}
@@ -0,0 +1,640 @@
+// Package config loads the application's configuration, layering its
+// defaults, an optional TOML or YAML config file, environment variables, and
+// command-line flags, each overriding the last, and validates it.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gourlshortener/internals/application"
+	"gourlshortener/internals/backup"
+	"gourlshortener/internals/database"
+	"gourlshortener/internals/health"
+	"gourlshortener/internals/i18n"
+	"gourlshortener/internals/metadata"
+	"gourlshortener/internals/shortcode"
+	"gourlshortener/internals/validation"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// Config is the application's configuration. Each field is set by the key in
+// its section of the config file, e.g., port in [server], by the environment
+// variable in its env tag, and by a flag named after its section and key,
+// e.g., -server-port, unless it has a flag tag.
+type Config struct {
+	Server      Server      `toml:"server"`
+	Site        Site        `toml:"site"`
+	Locale      Locale      `toml:"locale"`
+	Database    Database    `toml:"database"`
+	Backup      Backup      `toml:"backup"`
+	Maintenance Maintenance `toml:"maintenance"`
+	Health      Health      `toml:"health"`
+	Codes       Codes       `toml:"codes"`
+	URLs        URLs        `toml:"urls"`
+	Metadata    Metadata    `toml:"metadata"`
+	Blocklist   Blocklist   `toml:"blocklist"`
+	RateLimits  RateLimits  `toml:"rate_limits"`
+	Headers     Headers     `toml:"headers"`
+	TLS         TLS         `toml:"tls"`
+}
+
+// Server configures the web server
+type Server struct {
+	// Addr is the address to listen on, which defaults to all interfaces on
+	// Port
+	Addr              string `toml:"addr" flag:"addr"`
+	Port              int    `toml:"port" env:"PORT"`
+	BaseURL           string `toml:"base_url" env:"BASE_URL"`
+	AuthenticationKey string `toml:"authentication_key" env:"AUTHENTICATION_KEY" secret:"true"`
+	// AdminToken authenticates requests to the admin API, which is disabled
+	// if it isn't set
+	AdminToken string `toml:"admin_token" env:"ADMIN_TOKEN" secret:"true"`
+	// TemplateDir and StaticDir override the templates and static assets
+	// embedded in the binary, if they're set and exist
+	TemplateDir string `toml:"template_dir" env:"TEMPLATE_BASEDIR"`
+	StaticDir   string `toml:"static_dir" env:"STATIC_DIR"`
+}
+
+// Site configures the site's branding, and its theme
+type Site struct {
+	Name           string `toml:"name" env:"SITE_NAME"`
+	Footer         string `toml:"footer" env:"SITE_FOOTER,allowempty"`
+	LogoURL        string `toml:"logo_url" env:"SITE_LOGO_URL"`
+	SupportContact string `toml:"support_contact" env:"SITE_SUPPORT_CONTACT"`
+	Stylesheet     string `toml:"stylesheet" env:"SITE_STYLESHEET"`
+	// LegalLinks are links shown in the footer, as <name>=<URL>, e.g.,
+	// "Privacy=/static/privacy.html"
+	LegalLinks []string `toml:"legal_links" env:"SITE_LEGAL_LINKS"`
+	// ThemeDir contains templates and static directories, whose files
+	// override individual templates, partials, and static assets
+	ThemeDir string `toml:"theme_dir" env:"THEME_DIR"`
+}
+
+// Locale configures the languages that the UI is shown in
+type Locale struct {
+	// DefaultLanguage is used when a request doesn't ask for one which the
+	// UI is translated into
+	DefaultLanguage string `toml:"default_language" env:"LOCALE_DEFAULT"`
+	// CompactClicks formats click counts in compact notation, e.g., 1.2K
+	CompactClicks bool `toml:"compact_clicks" env:"LOCALE_COMPACT_CLICKS"`
+}
+
+// Database configures the SQLite database
+type Database struct {
+	URL         string `toml:"url" env:"DATABASE_URL"`
+	AutoMigrate bool   `toml:"auto_migrate" env:"AUTO_MIGRATE"`
+}
+
+// Backup configures the database's backups
+type Backup struct {
+	// Dir defaults to the backups directory next to the database file
+	Dir      string `toml:"dir" env:"BACKUP_DIR"`
+	Keep     int    `toml:"keep" env:"BACKUP_KEEP"`
+	Compress bool   `toml:"compress" env:"BACKUP_COMPRESS"`
+	// Interval is how often the server backs up the database; 0 turns
+	// scheduled backups off
+	Interval time.Duration `toml:"interval" env:"BACKUP_INTERVAL"`
+}
+
+// Maintenance configures the read-only maintenance mode, which can also be
+// turned on and off while the server is running
+type Maintenance struct {
+	Enabled bool `toml:"enabled" env:"MAINTENANCE_MODE"`
+	// RetryAfter is how long clients are asked to wait before retrying a
+	// write which was refused
+	RetryAfter time.Duration `toml:"retry_after" env:"MAINTENANCE_RETRY_AFTER"`
+}
+
+// Health configures the checks that links' destinations still respond
+type Health struct {
+	// Interval is how often every destination is checked; 0 turns checks
+	// off
+	Interval    time.Duration `toml:"interval" env:"HEALTH_CHECK_INTERVAL"`
+	Concurrency int           `toml:"concurrency" env:"HEALTH_CHECK_CONCURRENCY"`
+	// HostDelay is the minimum time between requests to the same host
+	HostDelay time.Duration `toml:"host_delay" env:"HEALTH_CHECK_HOST_DELAY"`
+	Timeout   time.Duration `toml:"timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	// BrokenAfter is the number of checks in a row which must fail for a
+	// link to be broken
+	BrokenAfter int `toml:"broken_after" env:"HEALTH_CHECK_BROKEN_AFTER"`
+}
+
+// Codes configures how new links' codes are generated
+type Codes struct {
+	Generator string `toml:"generator" env:"CODE_GENERATOR"`
+	Length    int    `toml:"length" env:"CODE_LENGTH"`
+	Salt      uint64 `toml:"salt" env:"CODE_SALT" secret:"true"`
+}
+
+// URLs configures how URLs are validated before they're shortened
+type URLs struct {
+	AllowedSchemes        []string      `toml:"allowed_schemes" env:"URL_ALLOWED_SCHEMES"`
+	MaxLength             int           `toml:"max_length" env:"URL_MAX_LENGTH"`
+	AllowedHosts          []string      `toml:"allowed_hosts" env:"URL_ALLOWED_HOSTS"`
+	DeniedHosts           []string      `toml:"denied_hosts" env:"URL_DENIED_HOSTS"`
+	BlockPrivateAddresses bool          `toml:"block_private_addresses" env:"URL_BLOCK_PRIVATE_ADDRESSES"`
+	ResolveHosts          bool          `toml:"resolve_hosts" env:"URL_RESOLVE_HOSTS"`
+	CheckReachability     bool          `toml:"check_reachability" env:"URL_CHECK_REACHABILITY"`
+	ReachabilityTimeout   time.Duration `toml:"reachability_timeout" env:"URL_REACHABILITY_TIMEOUT"`
+}
+
+// Metadata configures fetching new links' titles and descriptions
+type Metadata struct {
+	Fetch    bool          `toml:"fetch" env:"FETCH_METADATA"`
+	Timeout  time.Duration `toml:"timeout" env:"FETCH_METADATA_TIMEOUT"`
+	MaxBytes int64         `toml:"max_bytes" env:"FETCH_METADATA_MAX_BYTES"`
+}
+
+// Blocklist configures the blocklist of malicious destinations
+type Blocklist struct {
+	Files          []string      `toml:"files" env:"BLOCKLIST_FILES"`
+	ReloadInterval time.Duration `toml:"reload_interval" env:"BLOCKLIST_RELOAD_INTERVAL"`
+}
+
+// RateLimits configures the rate limits, as <requests>/<duration>, or "off"
+type RateLimits struct {
+	Create         string   `toml:"create" env:"RATE_LIMIT_CREATE"`
+	Redirect       string   `toml:"redirect" env:"RATE_LIMIT_REDIRECT"`
+	TrustedProxies []string `toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// Headers configures the security headers. Headers which are set to an empty
+// value, including by an empty environment variable, aren't sent.
+type Headers struct {
+	ContentSecurityPolicy       string `toml:"content_security_policy" env:"CONTENT_SECURITY_POLICY,allowempty"`
+	StaticContentSecurityPolicy string `toml:"static_content_security_policy" env:"STATIC_CONTENT_SECURITY_POLICY,allowempty"`
+	StrictTransportSecurity     string `toml:"strict_transport_security" env:"STRICT_TRANSPORT_SECURITY,allowempty"`
+	FrameOptions                string `toml:"frame_options" env:"FRAME_OPTIONS,allowempty"`
+	ReferrerPolicy              string `toml:"referrer_policy" env:"REFERRER_POLICY,allowempty"`
+	PermissionsPolicy           string `toml:"permissions_policy" env:"PERMISSIONS_POLICY,allowempty"`
+	ClearSiteData               string `toml:"clear_site_data" env:"CLEAR_SITE_DATA,allowempty"`
+	RedirectToHTTPS             bool   `toml:"redirect_to_https" env:"REDIRECT_TO_HTTPS"`
+}
+
+// TLS configures serving HTTPS
+type TLS struct {
+	CertFile         string        `toml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile          string        `toml:"key_file" env:"TLS_KEY_FILE"`
+	ReloadInterval   time.Duration `toml:"reload_interval" env:"TLS_RELOAD_INTERVAL"`
+	HTTPRedirectPort int           `toml:"http_redirect_port" env:"HTTP_REDIRECT_PORT"`
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	urls := validation.DefaultConfig()
+	headers := application.DefaultSecurityHeaders()
+	site := application.DefaultSite()
+
+	return &Config{
+		Server: Server{
+			Port: 8000,
+		},
+		Site: Site{
+			Name:   site.Name,
+			Footer: site.Footer,
+		},
+		Locale: Locale{
+			DefaultLanguage: "en",
+		},
+		Database: Database{
+			AutoMigrate: true,
+		},
+		Backup: Backup{
+			Keep:     7,
+			Compress: true,
+		},
+		Maintenance: Maintenance{
+			RetryAfter: 5 * time.Minute,
+		},
+		Health: Health{
+			Concurrency: health.DefaultConcurrency,
+			HostDelay:   health.DefaultHostDelay,
+			Timeout:     health.DefaultTimeout,
+			BrokenAfter: application.DefaultBrokenAfter,
+		},
+		Codes: Codes{
+			Generator: "random",
+			Length:    shortcode.DefaultLength,
+		},
+		URLs: URLs{
+			AllowedSchemes:        urls.AllowedSchemes,
+			MaxLength:             urls.MaxLength,
+			BlockPrivateAddresses: urls.BlockPrivateAddresses,
+			ResolveHosts:          urls.ResolveHosts,
+			CheckReachability:     urls.CheckReachability,
+			ReachabilityTimeout:   urls.ReachabilityTimeout,
+		},
+		Metadata: Metadata{
+			Timeout:  metadata.DefaultTimeout,
+			MaxBytes: metadata.DefaultMaxBytes,
+		},
+		Blocklist: Blocklist{
+			ReloadInterval: 30 * time.Second,
+		},
+		RateLimits: RateLimits{
+			Create:   "30/1m",
+			Redirect: "300/1m",
+		},
+		Headers: Headers{
+			ContentSecurityPolicy:       headers.ContentSecurityPolicy,
+			StaticContentSecurityPolicy: headers.RouteContentSecurityPolicies["/static/"],
+			StrictTransportSecurity:     headers.StrictTransportSecurity,
+			FrameOptions:                headers.FrameOptions,
+			ReferrerPolicy:              headers.ReferrerPolicy,
+			PermissionsPolicy:           headers.PermissionsPolicy,
+			ClearSiteData:               headers.ClearSiteData,
+			RedirectToHTTPS:             headers.RedirectToHTTPS,
+		},
+		TLS: TLS{
+			ReloadInterval: time.Minute,
+		},
+	}
+}
+
+// Error lists every problem found with the configuration
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// setting is a single field of the configuration, along with the key which
+// sets it in the config file, the environment variable which overrides that,
+// and the flag which overrides both
+type setting struct {
+	section, key, env, flag string
+	// secret settings are redacted when the configuration is written
+	secret bool
+	// allowEmpty settings can be set to an empty value by an environment
+	// variable, which otherwise leaves the setting unchanged
+	allowEmpty bool
+	value      reflect.Value
+}
+
+// name returns the setting's key, prefixed by its section
+func (s setting) name() string {
+	return s.section + "." + s.key
+}
+
+// settings returns every setting of the configuration, in order
+func (c *Config) settings() []setting {
+	var all []setting
+	config := reflect.ValueOf(c).Elem()
+	for i := 0; i < config.NumField(); i++ {
+		section := config.Field(i)
+		sectionName := config.Type().Field(i).Tag.Get("toml")
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			env, options, _ := strings.Cut(field.Tag.Get("env"), ",")
+			s := setting{
+				section:    sectionName,
+				key:        field.Tag.Get("toml"),
+				env:        env,
+				flag:       field.Tag.Get("flag"),
+				secret:     field.Tag.Get("secret") == "true",
+				allowEmpty: options == "allowempty",
+				value:      section.Field(j),
+			}
+			if s.flag == "" {
+				s.flag = strings.ReplaceAll(sectionName+"-"+s.key, "_", "-")
+			}
+			all = append(all, s)
+		}
+	}
+	return all
+}
+
+// set parses raw into the setting. Lists are comma-separated.
+func (s setting) set(raw string) error {
+	var err error
+	switch v := s.value.Addr().Interface().(type) {
+	case *string:
+		*v = raw
+	case *bool:
+		*v, err = strconv.ParseBool(raw)
+	case *int:
+		*v, err = strconv.Atoi(raw)
+	case *int64:
+		*v, err = strconv.ParseInt(raw, 10, 64)
+	case *uint64:
+		*v, err = strconv.ParseUint(raw, 10, 64)
+	case *time.Duration:
+		*v, err = time.ParseDuration(raw)
+	case *[]string:
+		*v = splitList(raw)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", raw, s.kind())
+	}
+	return nil
+}
+
+// setList sets a list setting to values
+func (s setting) setList(values []string) error {
+	list, ok := s.value.Addr().Interface().(*[]string)
+	if !ok {
+		return fmt.Errorf("must be a %s, not a list", s.kind())
+	}
+	*list = values
+	return nil
+}
+
+// kind describes the type of value which the setting takes
+func (s setting) kind() string {
+	switch s.value.Interface().(type) {
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "number"
+	case time.Duration:
+		return "duration"
+	case []string:
+		return "list"
+	default:
+		return "string"
+	}
+}
+
+// splitList splits a comma-separated list into its values, ignoring empty
+// ones
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// settingFlag is a flag which sets a setting
+type settingFlag struct {
+	setting
+}
+
+func (f settingFlag) String() string {
+	return ""
+}
+
+func (f settingFlag) Set(raw string) error {
+	return f.set(raw)
+}
+
+// IsBoolFlag lets boolean settings be enabled by their flag alone
+func (f settingFlag) IsBoolFlag() bool {
+	return f.kind() == "boolean"
+}
+
+// flagSet returns the flags which set the configuration, along with the
+// -config flag, which sets file
+func (c *Config) flagSet(file *string) *flag.FlagSet {
+	flags := flag.NewFlagSet("gourlshortener", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(file, "config", *file, "the TOML or YAML config file to load (or $CONFIG_FILE)")
+	for _, s := range c.settings() {
+		usage := "sets " + s.name()
+		if s.env != "" {
+			usage += " (or $" + s.env + ")"
+		}
+		flags.Var(settingFlag{s}, s.flag, usage)
+	}
+	return flags
+}
+
+// PrintFlags writes the usage of the flags which set the configuration to w
+func PrintFlags(w io.Writer) {
+	var file string
+	flags := Default().flagSet(&file)
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+}
+
+// Load loads the configuration from its defaults, overridden by the config
+// file in the -config flag or the CONFIG_FILE environment variable, if any,
+// then by the environment variables found by lookupEnv, then by the flags at
+// the start of args. It returns the arguments after the flags.
+//
+// Load doesn't validate the configuration, but it fails with an *Error
+// listing every setting which couldn't be parsed. It returns flag.ErrHelp if
+// args ask for help.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, []string, error) {
+	// Parse the flags first, to find the config file, and to fail early if
+	// they're invalid; they're parsed again, last, to override the rest
+	file, _ := lookupEnv("CONFIG_FILE")
+	if err := Default().flagSet(&file).Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, err
+		}
+		return nil, nil, &Error{Problems: []string{err.Error()}}
+	}
+
+	cfg := Default()
+	var problems []string
+	if file != "" {
+		if err := cfg.loadFile(file); err != nil {
+			var fileErr *Error
+			if !errors.As(err, &fileErr) {
+				return nil, nil, err
+			}
+			problems = append(problems, fileErr.Problems...)
+		}
+	}
+
+	for _, s := range cfg.settings() {
+		if s.env == "" {
+			continue
+		}
+		raw, ok := lookupEnv(s.env)
+		if !ok || (raw == "" && !s.allowEmpty) {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", s.env, err))
+		}
+	}
+
+	flags := cfg.flagSet(&file)
+	if err := flags.Parse(args); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, &Error{Problems: problems}
+	}
+	return cfg, flags.Args(), nil
+}
+
+// loadFile overrides the configuration with the settings in the TOML or YAML
+// file
+func (c *Config) loadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return &Error{Problems: []string{fmt.Sprintf("could not open the config file: %s", err)}}
+	}
+	defer f.Close()
+
+	values, err := parseFile(file, f)
+	if err != nil {
+		return &Error{Problems: []string{fmt.Sprintf("%s: %s", file, err)}}
+	}
+
+	settings := map[string]setting{}
+	for _, s := range c.settings() {
+		settings[s.name()] = s
+	}
+
+	var problems []string
+	for _, value := range values {
+		s, ok := settings[value.key]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: unknown setting %s", file, value.key))
+			continue
+		case value.err != nil:
+			err = value.err
+		case value.isList:
+			err = s.setList(value.list)
+		default:
+			err = s.set(value.scalar)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s: %s", file, value.key, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &Error{Problems: problems}
+	}
+	return nil
+}
+
+// ListenAddr returns the address that the web server listens on
+func (s Server) ListenAddr() string {
+	if s.Addr != "" {
+		return s.Addr
+	}
+	return ":" + strconv.Itoa(s.Port)
+}
+
+// ListenPort returns the port that the web server listens on
+func (s Server) ListenPort() string {
+	_, port, err := net.SplitHostPort(s.ListenAddr())
+	if err != nil {
+		return strconv.Itoa(s.Port)
+	}
+	return port
+}
+
+// File returns the path of the database file in the database URL, without
+// its query parameters
+func (d Database) File() string {
+	_, file, _ := strings.Cut(d.URL, ":")
+	file, _, _ = strings.Cut(file, "?")
+	if strings.HasPrefix(file, "///") {
+		file = strings.TrimPrefix(file, "//")
+	}
+	return file
+}
+
+// Options returns the connection options in the database URL's query
+// parameters, e.g., sqlite:data/database.sqlite3?busy_timeout=10000
+func (d Database) Options() (database.Options, error) {
+	_, query, _ := strings.Cut(d.URL, "?")
+	return database.ParseOptions(query)
+}
+
+// Manager returns the manager of the database's backups
+func (b Backup) Manager(db Database) *backup.Manager {
+	dir := b.Dir
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(db.File()), "backups")
+	}
+	return &backup.Manager{
+		Database: db.File(),
+		Dir:      dir,
+		Keep:     b.Keep,
+		Compress: b.Compress,
+	}
+}
+
+// Mode returns the maintenance mode
+func (m Maintenance) Mode() *application.Maintenance {
+	return application.NewMaintenance(m.Enabled, m.RetryAfter)
+}
+
+// Checker returns the checker of links' destinations, which skips those at
+// private or local addresses if blockPrivate is set
+func (h Health) Checker(blockPrivate bool) *health.Checker {
+	return health.NewChecker(h.Timeout, h.HostDelay, h.Concurrency, blockPrivate)
+}
+
+// Validation returns the URL validation configuration
+func (u URLs) Validation() validation.Config {
+	return validation.Config{
+		AllowedSchemes:        u.AllowedSchemes,
+		MaxLength:             u.MaxLength,
+		AllowedHosts:          u.AllowedHosts,
+		DeniedHosts:           u.DeniedHosts,
+		BlockPrivateAddresses: u.BlockPrivateAddresses,
+		ResolveHosts:          u.ResolveHosts,
+		CheckReachability:     u.CheckReachability,
+		ReachabilityTimeout:   u.ReachabilityTimeout,
+	}
+}
+
+// Branding returns the site's branding, for the application
+func (s Site) Branding() application.Site {
+	site := application.Site{
+		Name:           s.Name,
+		Footer:         s.Footer,
+		LogoURL:        s.LogoURL,
+		SupportContact: s.SupportContact,
+		Stylesheet:     s.Stylesheet,
+	}
+	for _, link := range s.LegalLinks {
+		name, url, _ := strings.Cut(link, "=")
+		site.LegalLinks = append(site.LegalLinks, application.Link{
+			Name: strings.TrimSpace(name),
+			URL:  strings.TrimSpace(url),
+		})
+	}
+	return site
+}
+
+// Localizer returns how the application selects each request's language.
+// It falls back to English if the default language is invalid, which
+// Validate reports.
+func (l Locale) Localizer() i18n.Localizer {
+	localizer := i18n.DefaultLocalizer()
+	if tag, err := language.Parse(l.DefaultLanguage); err == nil && i18n.Supported(tag) {
+		localizer.Default = tag
+	}
+	localizer.CompactClicks = l.CompactClicks
+	return localizer
+}
+
+// SecurityHeaders returns the security headers configuration
+func (h Headers) SecurityHeaders() application.SecurityHeaders {
+	headers := application.DefaultSecurityHeaders()
+	headers.ContentSecurityPolicy = h.ContentSecurityPolicy
+	headers.RouteContentSecurityPolicies["/static/"] = h.StaticContentSecurityPolicy
+	headers.StrictTransportSecurity = h.StrictTransportSecurity
+	headers.FrameOptions = h.FrameOptions
+	headers.ReferrerPolicy = h.ReferrerPolicy
+	headers.PermissionsPolicy = h.PermissionsPolicy
+	headers.ClearSiteData = h.ClearSiteData
+	headers.RedirectToHTTPS = h.RedirectToHTTPS
+	return headers
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// env returns a lookupEnv function for the supplied environment
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+// writeFile writes a config file to a temporary directory
+func writeFile(t *testing.T, contents string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(file, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadLayersFileEnvAndFlags(t *testing.T) {
+	file := writeFile(t, `
+# Set by the file, and overridden by the environment and the flags
+[server]
+port = 9000
+base_url = "https://go.example"
+
+[codes]
+generator = 'sequential'
+length = 10
+
+[urls]
+allowed_hosts = [
+  "example.com", # Comments are allowed in arrays
+  "go.dev",
+]
+`)
+
+	cfg, args, err := Load(
+		[]string{"-codes-length", "12", "-metadata-fetch", "-addr", "127.0.0.1:9001", "links", "list", "-format", "json"},
+		env(map[string]string{
+			"CONFIG_FILE":             file,
+			"BASE_URL":                "https://short.example",
+			"CODE_LENGTH":             "11",
+			"URL_MAX_LENGTH":          "",
+			"CONTENT_SECURITY_POLICY": "",
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(args, []string{"links", "list", "-format", "json"}) {
+		t.Errorf("got args %v; want the arguments after the flags", args)
+	}
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"the default", cfg.RateLimits.Create, "30/1m"},
+		{"the file", cfg.Server.Port, 9000},
+		{"the file", cfg.Codes.Generator, "sequential"},
+		{"the file", cfg.URLs.AllowedHosts, []string{"example.com", "go.dev"}},
+		{"the environment", cfg.Server.BaseURL, "https://short.example"},
+		{"an empty environment variable", cfg.URLs.MaxLength, 2048},
+		{"an empty header environment variable", cfg.Headers.ContentSecurityPolicy, ""},
+		{"the flags", cfg.Codes.Length, 12},
+		{"a boolean flag", cfg.Metadata.Fetch, true},
+		{"the addr flag", cfg.Server.ListenAddr(), "127.0.0.1:9001"},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadListsEveryInvalidSetting(t *testing.T) {
+	file := writeFile(t, `
+[server]
+port = "eighty"
+colour = "blue"
+`)
+
+	_, _, err := Load(nil, env(map[string]string{
+		"CONFIG_FILE":              file,
+		"URL_REACHABILITY_TIMEOUT": "soon",
+		"FETCH_METADATA":           "maybe",
+	}))
+	var configErr *Error
+	if !errors.As(err, &configErr) {
+		t.Fatalf("got %v; want an *Error", err)
+	}
+
+	want := []string{
+		file + `: unknown setting server.colour`,
+		file + `: server.port: "eighty" is not a valid number`,
+		`URL_REACHABILITY_TIMEOUT: "soon" is not a valid duration`,
+		`FETCH_METADATA: "maybe" is not a valid boolean`,
+	}
+	if !reflect.DeepEqual(configErr.Problems, want) {
+		t.Errorf("got problems %q; want %q", configErr.Problems, want)
+	}
+
+	if _, _, err = Load([]string{"-h"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("got %v; want flag.ErrHelp", err)
+	}
+	if _, _, err = Load([]string{"-colour", "blue"}, env(nil)); !errors.As(err, &configErr) {
+		t.Errorf("got %v; want an *Error for an unknown flag", err)
+	}
+}
+
+func TestParseFileRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name, file, contents string
+	}{
+		{"a missing value", "config.toml", "port ="},
+		{"a missing equals sign", "config.toml", "port"},
+		{"an unquoted string", "config.toml", `generator = random`},
+		{"an unterminated string", "config.toml", `generator = "random`},
+		{"an invalid table", "config.toml", "[server"},
+		{"a key set twice", "config.toml", "port = 1\nport = 2"},
+		{"invalid YAML", "config.yaml", "server: [port"},
+		{"a YAML key set twice", "config.yml", "server:\n  port: 1\n  port: 2"},
+	}
+	for _, tt := range tests {
+		if _, err := parseFile(tt.file, strings.NewReader(tt.contents)); err == nil {
+			t.Errorf("%s: expected an error to be returned", tt.name)
+		}
+	}
+
+	values, err := parseFile("config.toml", strings.NewReader(`
+[urls]
+allowed_hosts = ["example.com", 1]
+max_length = 1.5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0].key != "urls.allowed_hosts" || values[0].err == nil || values[1].scalar != "1.5" {
+		t.Errorf("got %+v; want a list which isn't only strings to be rejected, and numbers as text", values)
+	}
+}
+
+func TestLoadReadsYAMLFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	contents := `
+# Comments are allowed
+server:
+  port: 9000
+  base_url: https://go.example
+codes:
+  generator: sequential
+urls:
+  allowed_hosts:
+    - example.com
+    - go.dev
+  max_length: eighty
+`
+	if err := os.WriteFile(file, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := Load(nil, env(map[string]string{"CONFIG_FILE": file}))
+	want := &Error{Problems: []string{file + `: urls.max_length: "eighty" is not a valid number`}}
+	if !reflect.DeepEqual(err, want) {
+		t.Fatalf("got %v; want %v", err, want)
+	}
+
+	if err := os.WriteFile(file, []byte(strings.Replace(contents, "eighty", "4096", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := Load(nil, env(map[string]string{"CONFIG_FILE": file}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Server.BaseURL != "https://go.example" || cfg.Codes.Generator != "sequential" ||
+		cfg.URLs.MaxLength != 4096 || !reflect.DeepEqual(cfg.URLs.AllowedHosts, []string{"example.com", "go.dev"}) {
+		t.Errorf("got %+v; want the settings in the YAML file", cfg)
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	cfg := Default()
+	cfg.Server.AuthenticationKey = "too-short"
+	cfg.Server.AdminToken = "short"
+	cfg.Server.TemplateDir = "config.go"
+	cfg.Server.StaticDir = "config.go"
+	cfg.Site.LegalLinks = []string{"Privacy"}
+	cfg.Site.ThemeDir = "testdata/missing"
+	cfg.Locale.DefaultLanguage = "ja"
+	cfg.Database.URL = "postgres://localhost/links"
+	cfg.Backup.Keep = -1
+	cfg.Maintenance.RetryAfter = -time.Second
+	cfg.Health.Concurrency = 0
+	cfg.Health.BrokenAfter = 0
+	cfg.Codes.Generator = "emoji"
+	cfg.RateLimits.Create = "lots"
+	cfg.TLS.CertFile = "cert.pem"
+
+	err := cfg.Validate()
+	var configErr *Error
+	if !errors.As(err, &configErr) {
+		t.Fatalf("got %v; want an *Error", err)
+	}
+
+	for _, name := range []string{
+		"server.authentication_key",
+		"server.admin_token",
+		"server.template_dir",
+		"server.static_dir",
+		"site.legal_links",
+		"site.theme_dir",
+		"locale.default_language",
+		"database.url",
+		"backup.keep",
+		"maintenance.retry_after",
+		"health.concurrency",
+		"health.broken_after",
+		"codes.generator",
+		"rate_limits.create",
+		"tls",
+	} {
+		if !strings.Contains(err.Error(), "\n  - "+name+": ") {
+			t.Errorf("expected a problem with %s to be listed in:\n%s", name, err)
+		}
+	}
+
+	cfg = Default()
+	cfg.Server.AuthenticationKey = strings.Repeat("k", 40)
+	cfg.Server.TemplateDir = "testdata/missing"
+	cfg.Server.StaticDir = "."
+	cfg.Site.LegalLinks = []string{"Privacy = /static/privacy.html"}
+	cfg.Locale.DefaultLanguage = "de"
+	cfg.Database.URL = "sqlite:data/database.sqlite3?busy_timeout=10000&read_connections=8"
+	if err = cfg.Validate(); err != nil {
+		t.Errorf("expected the configuration to be valid, got %v", err)
+	}
+	if links := cfg.Site.Branding().LegalLinks; len(links) != 1 || links[0].Name != "Privacy" || links[0].URL != "/static/privacy.html" {
+		t.Errorf("got legal links %+v; want Privacy, linking to /static/privacy.html", links)
+	}
+	if file := cfg.Database.File(); file != "data/database.sqlite3" {
+		t.Errorf("got database file %q; want %q", file, "data/database.sqlite3")
+	}
+	if opts, err := cfg.Database.Options(); err != nil || opts.BusyTimeout != 10*time.Second || opts.ReadConnections != 8 || opts.JournalMode != "wal" {
+		t.Errorf("got database options %+v, %v; want the URL's options, and the defaults", opts, err)
+	}
+	if manager := cfg.Backup.Manager(cfg.Database); manager.Dir != filepath.Join("data", "backups") || manager.Database != "data/database.sqlite3" {
+		t.Errorf("got backups of %q in %q; want the database's backups next to it", manager.Database, manager.Dir)
+	}
+	if localizer := cfg.Locale.Localizer(); localizer.Default != language.German {
+		t.Errorf("got default language %s; want %s", localizer.Default, language.German)
+	}
+}
+
+func TestWriteRedactsSecretsAndCanBeLoaded(t *testing.T) {
+	cfg := Default()
+	cfg.Server.AuthenticationKey = strings.Repeat("k", 32)
+	cfg.Codes.Salt = 1234
+	cfg.Server.BaseURL = `https://go.example/"quoted"`
+	cfg.Blocklist.Files = []string{"a.txt", "b.txt"}
+	cfg.Metadata.Timeout = 1500 * time.Millisecond
+
+	var out bytes.Buffer
+	if err := cfg.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), cfg.Server.AuthenticationKey) || strings.Contains(out.String(), "1234") {
+		t.Errorf("expected secrets to be redacted:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `authentication_key = "[redacted]"`) {
+		t.Errorf("expected the authentication key to be shown as redacted:\n%s", out.String())
+	}
+
+	// Written configuration can be loaded again, once secrets are removed
+	written := strings.NewReplacer(
+		`authentication_key = "[redacted]"`, `authentication_key = "`+cfg.Server.AuthenticationKey+`"`,
+		`salt = "[redacted]"`, `salt = 1234`,
+	).Replace(out.String())
+	loaded, _, err := Load([]string{"-config", writeFile(t, written)}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("got %+v; want %+v", loaded, cfg)
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileValue is a value set in a config file: either a scalar, as its text,
+// or a list of strings
+type fileValue struct {
+	key    string
+	scalar string
+	list   []string
+	isList bool
+	err    error
+}
+
+// parseFile parses a config file, as YAML if its name ends in .yaml or .yml,
+// and as TOML otherwise. Keys are prefixed with their table, e.g.,
+// "server.port", and are sorted.
+func parseFile(name string, r io.Reader) ([]fileValue, error) {
+	var tables map[string]any
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		if err := yaml.NewDecoder(r).Decode(&tables); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	default:
+		if _, err := toml.NewDecoder(r).Decode(&tables); err != nil {
+			return nil, err
+		}
+	}
+
+	var values []fileValue
+	flatten("", tables, &values)
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].key < values[j].key
+	})
+	return values, nil
+}
+
+// flatten appends the values in a table, and the tables within it, to values
+func flatten(prefix string, table map[string]any, values *[]fileValue) {
+	for key, raw := range table {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := raw.(map[string]any); ok {
+			flatten(key, nested, values)
+			continue
+		}
+
+		value := fileValue{key: key}
+		switch v := raw.(type) {
+		case string:
+			value.scalar = v
+		case bool, int, int64, uint64, float64:
+			value.scalar = fmt.Sprint(v)
+		case []any:
+			value.isList = true
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					value.err = errors.New("lists may only contain strings")
+					break
+				}
+				value.list = append(value.list, s)
+			}
+		default:
+			value.err = errors.New("must be a string, number, boolean, or list of strings")
+		}
+		*values = append(*values, value)
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// quote quotes s as a TOML basic string
+func quote(s string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteRune(c)
+		case c == '\n':
+			quoted.WriteString(`\n`)
+		case c == '\t':
+			quoted.WriteString(`\t`)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&quoted, `\u%04x`, c)
+		default:
+			quoted.WriteRune(c)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+// redacted replaces the values of secret settings, when they're set
+const redacted = `"[redacted]"`
+
+// Write writes the configuration to w as a TOML config file, with the values
+// of secret settings redacted
+func (c *Config) Write(w io.Writer) error {
+	var section string
+	for _, s := range c.settings() {
+		if s.section != section {
+			prefix := "\n"
+			if section == "" {
+				prefix = ""
+			}
+			section = s.section
+			if _, err := fmt.Fprintf(w, "%s[%s]\n", prefix, section); err != nil {
+				return err
+			}
+		}
+
+		var value string
+		switch v := s.value.Interface().(type) {
+		case string:
+			value = quote(v)
+		case time.Duration:
+			value = quote(v.String())
+		case []string:
+			quoted := make([]string, 0, len(v))
+			for _, item := range v {
+				quoted = append(quoted, quote(item))
+			}
+			value = "[" + strings.Join(quoted, ", ") + "]"
+		default:
+			value = fmt.Sprint(v)
+		}
+		if s.secret && !s.value.IsZero() {
+			value = redacted
+		}
+
+		if _, err := fmt.Fprintf(w, "%s = %s\n", s.key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
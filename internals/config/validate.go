@@ -0,0 +1,265 @@
+package config
+
+import (
+	"fmt"
+	"gourlshortener/internals/i18n"
+	"gourlshortener/internals/ratelimit"
+	"gourlshortener/internals/shortcode"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// databaseSchemes are the schemes of the database URLs which are supported,
+// in the format that dbmate uses
+var databaseSchemes = []string{"sqlite", "sqlite3"}
+
+// Validate checks the configuration, returning an *Error which lists every
+// problem with it, so that they can all be fixed at once
+func (c *Config) Validate() error {
+	var problems []string
+	problem := func(name, format string, args ...any) {
+		problems = append(problems, name+": "+fmt.Sprintf(format, args...))
+	}
+
+	// The server
+	if c.Server.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+			problem("server.addr", "%q is not a valid address, such as :8000", c.Server.Addr)
+		}
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problem("server.port", "%d is not a valid port", c.Server.Port)
+	}
+	if c.Server.BaseURL != "" {
+		u, err := url.Parse(c.Server.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			problem("server.base_url", "%q must be an http or https URL, such as https://go.example", c.Server.BaseURL)
+		}
+	}
+	switch length := len(c.Server.AuthenticationKey); {
+	case length == 0:
+		problem("server.authentication_key", "is required")
+	case length < 32:
+		problem("server.authentication_key", "must be at least 32 bytes long, not %d", length)
+	}
+	if c.Server.AdminToken != "" && len(c.Server.AdminToken) < 16 {
+		problem("server.admin_token", "must be at least 16 characters long")
+	}
+	checkOverrideDir(problem, "server.template_dir", c.Server.TemplateDir)
+	checkOverrideDir(problem, "server.static_dir", c.Server.StaticDir)
+
+	// The site's branding
+	if strings.TrimSpace(c.Site.Name) == "" {
+		problem("site.name", "is required")
+	}
+	checkURL(problem, "site.logo_url", c.Site.LogoURL)
+	checkURL(problem, "site.stylesheet", c.Site.Stylesheet)
+	for _, link := range c.Site.LegalLinks {
+		name, target, found := strings.Cut(link, "=")
+		if !found || strings.TrimSpace(name) == "" || strings.TrimSpace(target) == "" {
+			problem("site.legal_links", "%q must be <name>=<URL>, such as Privacy=https://go.example/privacy", link)
+			continue
+		}
+		checkURL(problem, "site.legal_links", strings.TrimSpace(target))
+	}
+	checkDir(problem, "site.theme_dir", c.Site.ThemeDir)
+
+	// The UI's languages
+	if tag, err := language.Parse(c.Locale.DefaultLanguage); err != nil || !i18n.Supported(tag) {
+		problem("locale.default_language", "must be one of %s, not %q", strings.Join(languageTags(), ", "), c.Locale.DefaultLanguage)
+	}
+
+	// The database
+	scheme, _, found := strings.Cut(c.Database.URL, ":")
+	switch {
+	case c.Database.URL == "":
+		problem("database.url", "is required")
+	case !found || !contains(databaseSchemes, scheme):
+		problem("database.url", "must start with %s:, such as sqlite:data/database.sqlite3", strings.Join(databaseSchemes, ": or "))
+	case c.Database.File() == "":
+		problem("database.url", "must contain the path of the database file")
+	}
+	if _, err := c.Database.Options(); err != nil {
+		problem("database.url", "%s", err)
+	}
+
+	// Backups
+	if c.Backup.Keep < 0 {
+		problem("backup.keep", "must be 0, to keep every backup, or more")
+	}
+	if c.Backup.Interval < 0 {
+		problem("backup.interval", "must be 0s, for no scheduled backups, or more")
+	}
+
+	// Maintenance mode
+	if c.Maintenance.RetryAfter < 0 {
+		problem("maintenance.retry_after", "must be 0s, to not send Retry-After, or more")
+	}
+
+	// Link health checks
+	if c.Health.Interval < 0 {
+		problem("health.interval", "must be 0s, for no checks, or more")
+	}
+	if c.Health.Concurrency < 1 {
+		problem("health.concurrency", "must be 1 or more")
+	}
+	if c.Health.HostDelay < 0 {
+		problem("health.host_delay", "must be 0s or more")
+	}
+	if c.Health.Timeout <= 0 {
+		problem("health.timeout", "must be more than 0s")
+	}
+	if c.Health.BrokenAfter < 1 {
+		problem("health.broken_after", "must be 1 or more")
+	}
+
+	// Links' codes
+	if _, err := shortcode.New(c.Codes.Generator, nopCounter{}, c.Codes.Salt); err != nil {
+		problem("codes.generator", "must be random, unambiguous, or sequential, not %q", c.Codes.Generator)
+	}
+	if c.Codes.Length < 1 || c.Codes.Length > shortcode.MaxLength {
+		problem("codes.length", "must be from 1 to %d, not %d", shortcode.MaxLength, c.Codes.Length)
+	}
+
+	// URL validation
+	if len(c.URLs.AllowedSchemes) == 0 {
+		problem("urls.allowed_schemes", "must contain at least one scheme")
+	}
+	if c.URLs.MaxLength < 0 {
+		problem("urls.max_length", "must be 0, for no limit, or more")
+	}
+	checkPositive(problem, "urls.reachability_timeout", c.URLs.ReachabilityTimeout)
+
+	// Fetching links' titles
+	checkPositive(problem, "metadata.timeout", c.Metadata.Timeout)
+	if c.Metadata.MaxBytes <= 0 {
+		problem("metadata.max_bytes", "must be more than 0")
+	}
+
+	// The blocklist
+	for _, file := range c.Blocklist.Files {
+		if _, err := os.Stat(file); err != nil {
+			problem("blocklist.files", "%s", err)
+		}
+	}
+	checkPositive(problem, "blocklist.reload_interval", c.Blocklist.ReloadInterval)
+
+	// Rate limits
+	for _, limit := range []struct{ name, value string }{
+		{"rate_limits.create", c.RateLimits.Create},
+		{"rate_limits.redirect", c.RateLimits.Redirect},
+	} {
+		if strings.ToLower(limit.value) == "off" {
+			continue
+		}
+		if _, err := ratelimit.ParseLimit(limit.value); err != nil {
+			problem(limit.name, "%q must be <requests>/<duration>, such as 30/1m, or off", limit.value)
+		}
+	}
+	if _, err := ratelimit.ParseTrustedProxies(c.RateLimits.TrustedProxies); err != nil {
+		problem("rate_limits.trusted_proxies", "%s", err)
+	}
+
+	// HTTPS
+	switch {
+	case c.TLS.CertFile == "" && c.TLS.KeyFile == "":
+		if c.TLS.HTTPRedirectPort != 0 {
+			problem("tls.http_redirect_port", "can only be set when serving HTTPS")
+		}
+	case c.TLS.CertFile == "" || c.TLS.KeyFile == "":
+		problem("tls", "both cert_file and key_file must be set to serve HTTPS")
+	default:
+		checkFile(problem, "tls.cert_file", c.TLS.CertFile)
+		checkFile(problem, "tls.key_file", c.TLS.KeyFile)
+	}
+	checkPositive(problem, "tls.reload_interval", c.TLS.ReloadInterval)
+	if c.TLS.HTTPRedirectPort < 0 || c.TLS.HTTPRedirectPort > 65535 {
+		problem("tls.http_redirect_port", "%d is not a valid port", c.TLS.HTTPRedirectPort)
+	}
+
+	if len(problems) > 0 {
+		return &Error{Problems: problems}
+	}
+	return nil
+}
+
+// checkDir adds a problem if dir is set, but isn't a directory
+func checkDir(problem func(name, format string, args ...any), name, dir string) {
+	if dir == "" {
+		return
+	}
+	info, err := os.Stat(dir)
+	switch {
+	case err != nil:
+		problem(name, "%s", err)
+	case !info.IsDir():
+		problem(name, "%s is not a directory", dir)
+	}
+}
+
+// checkOverrideDir adds a problem if dir is set, and exists, but isn't a
+// directory. A missing directory isn't a problem, as the embedded files are
+// used instead.
+func checkOverrideDir(problem func(name, format string, args ...any), name, dir string) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		problem(name, "%s is not a directory", dir)
+	}
+}
+
+// checkURL adds a problem if u is set, but isn't an http or https URL, or a
+// path on this site
+func checkURL(problem func(name, format string, args ...any), name, u string) {
+	if u == "" {
+		return
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https" && !strings.HasPrefix(u, "/")) {
+		problem(name, "%q must be an http or https URL, or a path, such as /static/logo.svg", u)
+	}
+}
+
+// checkFile adds a problem if file doesn't exist
+func checkFile(problem func(name, format string, args ...any), name, file string) {
+	if _, err := os.Stat(file); err != nil {
+		problem(name, "%s", err)
+	}
+}
+
+// checkPositive adds a problem if d isn't more than zero
+func checkPositive(problem func(name, format string, args ...any), name string, d time.Duration) {
+	if d <= 0 {
+		problem(name, "must be more than 0s")
+	}
+}
+
+// languageTags returns the tags of the languages which the UI is translated
+// into
+func languageTags() []string {
+	tags := make([]string, 0, len(i18n.Languages))
+	for _, lang := range i18n.Languages {
+		tags = append(tags, lang.Tag.String())
+	}
+	return tags
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// nopCounter lets the sequential generator be validated without a database
+type nopCounter struct{}
+
+func (nopCounter) Next() (uint64, error) {
+	return 0, nil
+}
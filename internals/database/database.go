@@ -0,0 +1,196 @@
+// Package database opens the SQLite database as one writer connection and a
+// pool of read-only connections, with the pragmas which let them share it
+// under concurrent requests.
+//
+// SQLite allows only one writer at a time, so writes are serialised through
+// the single writer connection, rather than failing with SQLITE_BUSY, while
+// the readers, in WAL mode, read alongside it.
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// journalModes and synchronousLevels are the values which SQLite accepts for
+// the journal_mode and synchronous pragmas
+var (
+	journalModes      = []string{"delete", "truncate", "persist", "memory", "wal", "off"}
+	synchronousLevels = []string{"off", "normal", "full", "extra"}
+)
+
+// Options are the pragmas set on every connection, and the size of the pool
+// of read-only connections
+type Options struct {
+	JournalMode string
+	// BusyTimeout is how long a connection waits for another to release its
+	// lock, before failing with SQLITE_BUSY
+	BusyTimeout time.Duration
+	Synchronous string
+	ForeignKeys bool
+	// ReadConnections is the maximum number of read-only connections
+	ReadConnections int
+}
+
+// DefaultOptions returns the default options: WAL mode, which lets reads run
+// alongside writes, synchronous set to normal, which is safe in WAL mode, a
+// 5s busy timeout, foreign keys, and 4 read-only connections
+func DefaultOptions() Options {
+	return Options{
+		JournalMode:     "wal",
+		BusyTimeout:     5 * time.Second,
+		Synchronous:     "normal",
+		ForeignKeys:     true,
+		ReadConnections: 4,
+	}
+}
+
+// ParseOptions overrides the default options with the query parameters of a
+// database URL: journal_mode, busy_timeout, in milliseconds, as SQLite sets
+// it, or as a duration, such as 5s, synchronous, foreign_keys, and
+// read_connections
+func ParseOptions(query string) (Options, error) {
+	opts := DefaultOptions()
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return opts, fmt.Errorf("%q is not a valid query", query)
+	}
+
+	for name := range values {
+		value := strings.ToLower(values.Get(name))
+		switch name {
+		case "journal_mode":
+			if !contains(journalModes, value) {
+				return opts, fmt.Errorf("journal_mode must be one of %s, not %q", strings.Join(journalModes, ", "), value)
+			}
+			opts.JournalMode = value
+		case "busy_timeout":
+			opts.BusyTimeout, err = parseTimeout(value)
+			if err != nil {
+				return opts, fmt.Errorf("busy_timeout must be a number of milliseconds, or a duration, such as 5s, not %q", value)
+			}
+		case "synchronous":
+			if !contains(synchronousLevels, value) {
+				return opts, fmt.Errorf("synchronous must be one of %s, not %q", strings.Join(synchronousLevels, ", "), value)
+			}
+			opts.Synchronous = value
+		case "foreign_keys":
+			opts.ForeignKeys, err = parseSwitch(value)
+			if err != nil {
+				return opts, fmt.Errorf("foreign_keys must be on or off, not %q", value)
+			}
+		case "read_connections":
+			opts.ReadConnections, err = strconv.Atoi(value)
+			if err != nil || opts.ReadConnections < 1 {
+				return opts, fmt.Errorf("read_connections must be 1 or more, not %q", value)
+			}
+		default:
+			return opts, fmt.Errorf("unknown parameter %s", name)
+		}
+	}
+	return opts, nil
+}
+
+// parseTimeout parses a number of milliseconds, or a duration
+func parseTimeout(value string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", value)
+	}
+	return d, nil
+}
+
+// parseSwitch parses a boolean pragma value, as SQLite does
+func parseSwitch(value string) (bool, error) {
+	switch value {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// DB is the database, as its writer connection, which every write must use,
+// and its pool of read-only connections
+type DB struct {
+	Writer, Reader *sql.DB
+}
+
+// Open opens the database file with the supplied options, and checks that
+// it's reachable
+func Open(file string, opts Options) (*DB, error) {
+	// Transactions take the write lock when they begin, so that one which
+	// reads before it writes can't fail to upgrade its lock
+	writer, err := sql.Open("sqlite", dsn(file, opts, "_txlock=immediate"))
+	if err != nil {
+		return nil, err
+	}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxLifetime(0)
+	writer.SetConnMaxIdleTime(0)
+
+	// The writer is pinged first, so that the journal mode is set before
+	// any reader connects
+	if err = writer.Ping(); err != nil {
+		writer.Close()
+		return nil, err
+	}
+
+	reader, err := sql.Open("sqlite", dsn(file, opts, "_pragma=query_only(1)"))
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	reader.SetMaxOpenConns(opts.ReadConnections)
+	reader.SetMaxIdleConns(opts.ReadConnections)
+	if err = reader.Ping(); err != nil {
+		writer.Close()
+		reader.Close()
+		return nil, err
+	}
+
+	return &DB{Writer: writer, Reader: reader}, nil
+}
+
+// dsn returns the data source name which opens the database file with the
+// options' pragmas, and any extra query parameters
+func dsn(file string, opts Options, extra ...string) string {
+	params := []string{
+		// The busy timeout is set first, so that it applies to the others
+		fmt.Sprintf("_pragma=busy_timeout(%d)", opts.BusyTimeout.Milliseconds()),
+		fmt.Sprintf("_pragma=journal_mode(%s)", opts.JournalMode),
+		fmt.Sprintf("_pragma=synchronous(%s)", opts.Synchronous),
+		fmt.Sprintf("_pragma=foreign_keys(%t)", opts.ForeignKeys),
+	}
+	return file + "?" + strings.Join(append(params, extra...), "&")
+}
+
+// Close closes the reader pool, then the writer connection
+func (db *DB) Close() error {
+	readerErr := db.Reader.Close()
+	if err := db.Writer.Close(); err != nil {
+		return err
+	}
+	return readerErr
+}
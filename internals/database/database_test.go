@@ -0,0 +1,87 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name, query string
+		expected    Options
+		valid       bool
+	}{
+		{"no parameters", "", DefaultOptions(), true},
+		{"every parameter", "journal_mode=DELETE&busy_timeout=250&synchronous=full&foreign_keys=off&read_connections=8",
+			Options{JournalMode: "delete", BusyTimeout: 250 * time.Millisecond, Synchronous: "full", ReadConnections: 8}, true},
+		{"busy timeout as a duration", "busy_timeout=10s",
+			Options{JournalMode: "wal", BusyTimeout: 10 * time.Second, Synchronous: "normal", ForeignKeys: true, ReadConnections: 4}, true},
+		{"invalid journal mode", "journal_mode=fast", Options{}, false},
+		{"invalid busy timeout", "busy_timeout=-1", Options{}, false},
+		{"invalid synchronous level", "synchronous=sometimes", Options{}, false},
+		{"invalid foreign keys", "foreign_keys=maybe", Options{}, false},
+		{"no read connections", "read_connections=0", Options{}, false},
+		{"unknown parameter", "cache=shared", Options{}, false},
+	}
+
+	for _, tt := range tests {
+		opts, err := ParseOptions(tt.query)
+		if tt.valid && err != nil {
+			t.Errorf("%s: Did not expect an error to be returned. Got: %s", tt.name, err)
+		}
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("%s: Expected an error to be returned", tt.name)
+			}
+			continue
+		}
+		if opts != tt.expected {
+			t.Errorf("%s: got %+v; want %+v", tt.name, opts, tt.expected)
+		}
+	}
+}
+
+func TestOpenSetsPragmas(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BusyTimeout = 2 * time.Second
+	db, err := Open(filepath.Join(t.TempDir(), "test.sqlite"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	pragmas := []struct {
+		pragma, expected string
+	}{
+		{"journal_mode", "wal"},
+		{"busy_timeout", "2000"},
+		{"synchronous", "1"},
+		{"foreign_keys", "1"},
+	}
+	for _, p := range pragmas {
+		var writerValue, readerValue string
+		if err := db.Writer.QueryRow("PRAGMA " + p.pragma).Scan(&writerValue); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Reader.QueryRow("PRAGMA " + p.pragma).Scan(&readerValue); err != nil {
+			t.Fatal(err)
+		}
+		if writerValue != p.expected || readerValue != p.expected {
+			t.Errorf("%s: got %s for the writer, and %s for the readers; want %s", p.pragma, writerValue, readerValue, p.expected)
+		}
+	}
+
+	if _, err = db.Writer.Exec("CREATE TABLE links (url TEXT)"); err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if _, err = db.Reader.Exec("INSERT INTO links (url) VALUES ('https://osnews.com')"); err == nil {
+		t.Error("Expected writing to a reader to fail")
+	}
+	if stats := db.Writer.Stats(); stats.MaxOpenConnections != 1 {
+		t.Errorf("got %d writer connections; want 1", stats.MaxOpenConnections)
+	}
+	if stats := db.Reader.Stats(); stats.MaxOpenConnections != opts.ReadConnections {
+		t.Errorf("got %d reader connections; want %d", stats.MaxOpenConnections, opts.ReadConnections)
+	}
+}
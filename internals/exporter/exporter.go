@@ -0,0 +1,229 @@
+// Package exporter writes links, along with their statistics, as CSV, JSON, or
+// NDJSON (newline-delimited JSON), one link at a time, so that exports don't
+// need to be held in memory.
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/models"
+	"gourlshortener/internals/utils"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// The supported export formats
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// ErrFormat is returned when an export's format isn't supported
+var ErrFormat = errors.New("exporter: unsupported format, which must be csv, json, or ndjson")
+
+// header is the header row of CSV exports
+var header = []string{"shortened_url", "original_url", "clicks", "revisions", "created", "updated"}
+
+// Writer writes the links of an export, one at a time. Close must be called
+// once every link has been written.
+type Writer interface {
+	Write(link *models.LinkStats) error
+	Close() error
+}
+
+// ContentType returns the content type of an export format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/json"
+	}
+}
+
+// NewWriter returns a Writer which writes links to w in the supplied format.
+// If formatClicks is true, click counts are written with thousands separators,
+// e.g., 2,120, rather than as plain numbers.
+func NewWriter(w io.Writer, format string, formatClicks bool) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w), formatClicks: formatClicks}, nil
+	case FormatJSON:
+		return &jsonWriter{w: w, array: true, formatClicks: formatClicks}, nil
+	case FormatNDJSON:
+		return &jsonWriter{w: w, formatClicks: formatClicks}, nil
+	default:
+		return nil, ErrFormat
+	}
+}
+
+// clicks returns a click count, formatted if requested. Exports are always
+// formatted in English, so that they read the same wherever they're made.
+func clicks(count int, formatClicks bool) string {
+	if formatClicks {
+		return utils.FormatClicks(language.English, count)
+	}
+	return strconv.Itoa(count)
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	formatClicks  bool
+	headerWritten bool
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.headerWritten {
+		return nil
+	}
+	c.headerWritten = true
+	return c.w.Write(header)
+}
+
+func (c *csvWriter) Write(link *models.LinkStats) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	return c.w.Write([]string{
+		link.ShortenedURL,
+		link.OriginalURL,
+		clicks(link.Clicks, c.formatClicks),
+		strconv.Itoa(link.Revisions),
+		link.Created.UTC().Format(time.RFC3339),
+		link.Updated.UTC().Format(time.RFC3339),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonLink is the JSON representation of an exported link. Clicks is a number,
+// or a string if click counts are formatted.
+type jsonLink struct {
+	ShortenedURL string    `json:"shortened_url"`
+	OriginalURL  string    `json:"original_url"`
+	Clicks       any       `json:"clicks"`
+	Revisions    int       `json:"revisions"`
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+}
+
+// jsonWriter writes links as a JSON array, if array is true, or as NDJSON
+type jsonWriter struct {
+	w            io.Writer
+	array        bool
+	formatClicks bool
+	count        int
+}
+
+func (j *jsonWriter) Write(link *models.LinkStats) error {
+	data := jsonLink{
+		ShortenedURL: link.ShortenedURL,
+		OriginalURL:  link.OriginalURL,
+		Clicks:       link.Clicks,
+		Revisions:    link.Revisions,
+		Created:      link.Created.UTC(),
+		Updated:      link.Updated.UTC(),
+	}
+	if j.formatClicks {
+		data.Clicks = utils.FormatClicks(language.English, link.Clicks)
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !j.array:
+		_, err = fmt.Fprintf(j.w, "%s\n", encoded)
+	case j.count == 0:
+		_, err = fmt.Fprintf(j.w, "[\n%s", encoded)
+	default:
+		_, err = fmt.Fprintf(j.w, ",\n%s", encoded)
+	}
+	j.count++
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if !j.array {
+		return nil
+	}
+	if j.count == 0 {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+// ParseFilter parses the strings of an export filter, any of which can be
+// empty. Dates are either RFC 3339 timestamps, or dates such as 2024-02-21,
+// in which case to includes the whole day.
+func ParseFilter(from, to, minClicks, maxClicks string) (models.ExportFilter, error) {
+	var (
+		filter models.ExportFilter
+		err    error
+	)
+	if filter.CreatedFrom, err = parseDate(from, false); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = parseDate(to, true); err != nil {
+		return filter, err
+	}
+	if filter.MinClicks, err = parseClicks(minClicks); err != nil {
+		return filter, err
+	}
+	if filter.MaxClicks, err = parseClicks(maxClicks); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// parseDate parses a filter's date. If endOfDay is true, a date without a time
+// is moved to the start of the next day, as the end of a range is exclusive.
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("exporter: %q isn't a date such as 2024-02-21 or 2024-02-21T07:11:21Z", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parseClicks parses a filter's click count
+func parseClicks(value string) (*int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("exporter: %q isn't a whole number of clicks", value)
+	}
+	return &n, nil
+}
@@ -0,0 +1,108 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"gourlshortener/internals/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLinks = []*models.LinkStats{
+	{
+		OriginalURL:  "https://osnews.com",
+		ShortenedURL: "https://shorten3d",
+		Clicks:       2120,
+		Revisions:    2,
+		Created:      time.Date(2024, 2, 21, 7, 11, 21, 0, time.UTC),
+		Updated:      time.Date(2024, 2, 22, 7, 11, 21, 0, time.UTC),
+	},
+	{
+		OriginalURL:  "https://go.dev",
+		ShortenedURL: "https://g0",
+		Created:      time.Date(2024, 2, 23, 0, 0, 0, 0, time.UTC),
+		Updated:      time.Date(2024, 2, 23, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+func export(t *testing.T, format string, formatClicks bool, links []*models.LinkStats) string {
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf, format, formatClicks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range links {
+		if err = writer.Write(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCSVExport(t *testing.T) {
+	want := "shortened_url,original_url,clicks,revisions,created,updated\n" +
+		"https://shorten3d,https://osnews.com,\"2,120\",2,2024-02-21T07:11:21Z,2024-02-22T07:11:21Z\n" +
+		"https://g0,https://go.dev,0,0,2024-02-23T00:00:00Z,2024-02-23T00:00:00Z\n"
+	if got := export(t, FormatCSV, true, testLinks); got != want {
+		t.Errorf("Incorrect CSV exported. Expected:\n%s\nGot:\n%s", want, got)
+	}
+
+	if got := export(t, FormatCSV, false, nil); got != strings.Join(header, ",")+"\n" {
+		t.Errorf("Expected an empty export to have a header row. Got: %s", got)
+	}
+}
+
+func TestJSONExports(t *testing.T) {
+	var links []map[string]any
+	if err := json.Unmarshal([]byte(export(t, FormatJSON, false, testLinks)), &links); err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[0]["clicks"] != float64(2120) {
+		t.Errorf("Incorrect JSON exported. Got: %v", links)
+	}
+
+	if got := export(t, FormatJSON, false, nil); got != "[]\n" {
+		t.Errorf("Expected an empty JSON array. Got: %s", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(export(t, FormatNDJSON, true, testLinks)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Incorrect number of NDJSON lines exported. Expected %d; got %d", 2, len(lines))
+	}
+	var link map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &link); err != nil {
+		t.Fatal(err)
+	}
+	if link["clicks"] != "2,120" {
+		t.Errorf("Expected formatted clicks. Got: %v", link["clicks"])
+	}
+}
+
+func TestNewWriterRejectsUnknownFormat(t *testing.T) {
+	if _, err := NewWriter(&bytes.Buffer{}, "xml", false); err != ErrFormat {
+		t.Errorf("Expected %s. Got: %v", ErrFormat, err)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter("2024-02-21", "2024-02-22", "10", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.CreatedFrom.Equal(time.Date(2024, 2, 21, 0, 0, 0, 0, time.UTC)) || !filter.CreatedTo.Equal(time.Date(2024, 2, 23, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Incorrect dates parsed. Got: %+v", filter)
+	}
+	if *filter.MinClicks != 10 || filter.MaxClicks != nil {
+		t.Errorf("Incorrect clicks parsed. Got: %+v", filter)
+	}
+
+	for _, args := range [][4]string{{"yesterday", "", "", ""}, {"", "", "", "-1"}, {"", "", "many", ""}} {
+		if _, err := ParseFilter(args[0], args[1], args[2], args[3]); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package health checks that links' destinations still respond, so that
+// broken links can be found before anyone follows them.
+//
+// Destinations are checked with HEAD requests, falling back to GET for
+// servers which don't support HEAD, a few at a time, and with a delay
+// between requests to the same host, so that sites with many links aren't
+// flooded with requests. Destinations at private or local addresses can be
+// skipped, so that links can't be used to probe the internal network.
+package health
+
+import (
+	"container/heap"
+	"context"
+	"gourlshortener/internals/validation"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// The defaults for a Checker's settings
+const (
+	DefaultConcurrency = 4
+	DefaultHostDelay   = time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// userAgent identifies the checker's requests to the destinations' servers
+const userAgent = "gourlshortener-link-checker/1.0"
+
+// Target is a link whose destination is checked
+type Target struct {
+	ShortenedURL, URL string
+}
+
+// Result is the outcome of checking a link's destination: the status code of
+// the final response, or 0 if there wasn't one, the URL which it finally
+// redirected to, how long the check took, when it was made, and the error
+// which stopped it from getting a response, if any
+type Result struct {
+	Target
+	StatusCode int
+	FinalURL   string
+	Latency    time.Duration
+	Checked    time.Time
+	Err        error
+}
+
+// OK reports whether the destination responded, without an error status
+func (r Result) OK() bool {
+	return r.Err == nil && r.StatusCode > 0 && r.StatusCode < 400
+}
+
+// Checker checks links' destinations
+type Checker struct {
+	Client *http.Client
+	// Concurrency is the maximum number of destinations checked at once
+	Concurrency int
+	// HostDelay is the minimum time between requests to the same host
+	HostDelay time.Duration
+}
+
+// NewChecker creates a Checker whose requests time out after timeout, which
+// checks at most concurrency destinations at once, waiting at least
+// hostDelay between requests to the same host. A zero timeout or concurrency
+// uses the default. If blockPrivate is set, destinations at private or local
+// addresses aren't checked, including when a destination redirects to one.
+func NewChecker(timeout, hostDelay time.Duration, concurrency int, blockPrivate bool) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if blockPrivate {
+		// The proxy would be dialed instead of the destination, so it's not
+		// used
+		dialer := &net.Dialer{Timeout: timeout, Control: validation.RefusePrivateAddresses}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+
+	return &Checker{
+		Client:      &http.Client{Timeout: timeout, Transport: transport},
+		Concurrency: concurrency,
+		HostDelay:   hostDelay,
+	}
+}
+
+// Check checks a link's destination with a HEAD request, or with a GET
+// request if the server doesn't allow HEAD requests, following redirects
+func (c *Checker) Check(ctx context.Context, target Target) Result {
+	start := time.Now()
+	result := Result{Target: target, Checked: start}
+	rs, err := c.do(ctx, http.MethodHead, target.URL)
+	if err == nil && (rs.StatusCode == http.StatusMethodNotAllowed || rs.StatusCode == http.StatusNotImplemented) {
+		rs.Body.Close()
+		rs, err = c.do(ctx, http.MethodGet, target.URL)
+	}
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer rs.Body.Close()
+	// A little of the body is read, so that the connection can be reused
+	io.CopyN(io.Discard, rs.Body, 4096)
+
+	result.StatusCode = rs.StatusCode
+	result.FinalURL = rs.Request.URL.String()
+	return result
+}
+
+// do sends a request to rawURL with the supplied method
+func (c *Checker) do(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	return c.Client.Do(req)
+}
+
+// CheckAll checks every target, at most Concurrency at once, calling record
+// with each result as it's made, from several goroutines, until they've all
+// been checked, or ctx is cancelled. Checks which were interrupted by ctx
+// being cancelled aren't recorded, as they don't say anything about their
+// destinations.
+//
+// Targets are handed to the workers as their hosts become ready, so a worker
+// is never left waiting for a host's delay while other hosts' targets could
+// be checked.
+func (c *Checker) CheckAll(ctx context.Context, targets []Target, record func(Result)) {
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	queue := make(chan Target)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range queue {
+				result := c.Check(ctx, target)
+				if ctx.Err() == nil {
+					record(result)
+				}
+			}
+		}()
+	}
+
+	c.schedule(ctx, newHostQueues(targets), queue)
+	close(queue)
+	wg.Wait()
+}
+
+// schedule sends each host's targets to queue in turn, once the host's delay
+// since its last request has passed, until every target has been sent, or
+// ctx is cancelled
+func (c *Checker) schedule(ctx context.Context, hosts *hostQueues, queue chan<- Target) {
+	for hosts.Len() > 0 {
+		host := heap.Pop(hosts).(*hostQueue)
+		if wait := time.Until(host.next); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case queue <- host.targets[0]:
+		}
+
+		host.targets = host.targets[1:]
+		if len(host.targets) > 0 {
+			host.next = time.Now().Add(c.HostDelay)
+			heap.Push(hosts, host)
+		}
+	}
+}
+
+// hostQueue is the targets at a host which are still to be checked, and when
+// the next one can be
+type hostQueue struct {
+	targets []Target
+	next    time.Time
+}
+
+// hostQueues is a heap of hosts' queues, ordered by when they can next be
+// checked
+type hostQueues []*hostQueue
+
+// newHostQueues groups targets by their destinations' hosts, keeping them in
+// order
+func newHostQueues(targets []Target) *hostQueues {
+	byHost := map[string]*hostQueue{}
+	hosts := hostQueues{}
+	for _, target := range targets {
+		var host string
+		if u, err := url.Parse(target.URL); err == nil {
+			host = u.Host
+		}
+		queue, ok := byHost[host]
+		if !ok {
+			queue = &hostQueue{}
+			byHost[host] = queue
+			hosts = append(hosts, queue)
+		}
+		queue.targets = append(queue.targets, target)
+	}
+	return &hosts
+}
+
+func (h hostQueues) Len() int           { return len(h) }
+func (h hostQueues) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h hostQueues) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hostQueues) Push(x any)        { *h = append(*h, x.(*hostQueue)) }
+func (h *hostQueues) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
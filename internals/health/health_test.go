@@ -0,0 +1,159 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"gourlshortener/internals/validation"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckRecordsTheDestinationsResponse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Expected a HEAD request. Got %s", r.Method)
+		}
+	})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.Handle("/moved", http.RedirectHandler("/ok", http.StatusMovedPermanently))
+	mux.Handle("/missing", http.NotFoundHandler())
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	closed := httptest.NewServer(mux)
+	closed.Close()
+
+	tests := []struct {
+		name, url, finalURL string
+		status              int
+		ok, err             bool
+	}{
+		{"head", ts.URL + "/ok", ts.URL + "/ok", http.StatusOK, true, false},
+		{"falls back to get", ts.URL + "/get-only", ts.URL + "/get-only", http.StatusOK, true, false},
+		{"follows redirects", ts.URL + "/moved", ts.URL + "/ok", http.StatusOK, true, false},
+		{"error status", ts.URL + "/missing", ts.URL + "/missing", http.StatusNotFound, false, false},
+		{"no response", closed.URL + "/ok", "", 0, false, true},
+	}
+
+	checker := NewChecker(time.Second, 0, 1, false)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := checker.Check(context.Background(), Target{ShortenedURL: "https://abc", URL: test.url})
+			if result.StatusCode != test.status || result.FinalURL != test.finalURL {
+				t.Errorf("got %d from %q; want %d from %q", result.StatusCode, result.FinalURL, test.status, test.finalURL)
+			}
+			if result.OK() != test.ok || (result.Err != nil) != test.err {
+				t.Errorf("got ok: %t, error: %v; want ok: %t, an error: %t", result.OK(), result.Err, test.ok, test.err)
+			}
+			if result.Checked.IsZero() || (!test.err && result.Latency <= 0) {
+				t.Errorf("Expected the check's time and latency to be recorded. Got: %+v", result)
+			}
+		})
+	}
+}
+
+func TestCheckAllIsPoliteToEachHost(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []time.Time
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, time.Now())
+	}))
+	defer ts.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	targets := []Target{
+		{ShortenedURL: "https://a", URL: ts.URL + "/a"},
+		{ShortenedURL: "https://b", URL: ts.URL + "/b"},
+		{ShortenedURL: "https://c", URL: ts.URL + "/c"},
+		{ShortenedURL: "https://d", URL: other.URL + "/d"},
+	}
+	delay := 50 * time.Millisecond
+	checker := NewChecker(time.Second, delay, 4, false)
+
+	var results []string
+	checker.CheckAll(context.Background(), targets, func(result Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !result.OK() {
+			t.Errorf("Expected %s to be OK. Got: %+v", result.URL, result)
+		}
+		results = append(results, result.ShortenedURL)
+	})
+
+	sort.Strings(results)
+	if len(results) != 4 || results[0] != "https://a" || results[3] != "https://d" {
+		t.Errorf("Expected every target to be recorded. Got: %v", results)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests to the first host. Got %d", len(requests))
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Before(requests[j]) })
+	for i := 1; i < len(requests); i++ {
+		// Allow for the timer's granularity
+		if gap := requests[i].Sub(requests[i-1]); gap < delay-5*time.Millisecond {
+			t.Errorf("Expected at least %s between requests to the same host. Got %s", delay, gap)
+		}
+	}
+}
+
+func TestCheckAllStopsWhenCancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	checker := NewChecker(time.Second, time.Hour, 1, false)
+	recorded := 0
+	checker.CheckAll(ctx, []Target{{URL: ts.URL + "/a"}, {URL: ts.URL + "/b"}}, func(result Result) {
+		recorded++
+		// The second request to the host would wait for an hour
+		cancel()
+	})
+	if recorded != 1 {
+		t.Errorf("Expected only the first check to be recorded. Got %d", recorded)
+	}
+}
+
+func TestCheckAllDoesNotWaitForAHostWhileOthersAreReady(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	// With a single worker, the other host is checked while the first one's
+	// delay passes
+	checker := NewChecker(time.Second, 200*time.Millisecond, 1, false)
+	var order []string
+	checker.CheckAll(context.Background(), []Target{
+		{ShortenedURL: "https://a", URL: ts.URL + "/a"},
+		{ShortenedURL: "https://b", URL: ts.URL + "/b"},
+		{ShortenedURL: "https://c", URL: other.URL + "/c"},
+	}, func(result Result) {
+		order = append(order, result.ShortenedURL)
+	})
+	if len(order) != 3 || order[1] != "https://c" {
+		t.Errorf("Expected the other host to be checked second. Got: %v", order)
+	}
+}
+
+func TestCheckerRefusesPrivateAddresses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	result := NewChecker(time.Second, 0, 1, true).Check(context.Background(), Target{URL: ts.URL})
+	if !errors.Is(result.Err, validation.ErrPrivateAddress) {
+		t.Errorf("got %v; want %v", result.Err, validation.ErrPrivateAddress)
+	}
+}
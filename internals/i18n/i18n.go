@@ -0,0 +1,270 @@
+// Package i18n translates the UI, with message catalogs built on
+// golang.org/x/text/message, and selects the language of each request from
+// its language cookie, or its Accept-Language header.
+//
+// Messages are keyed by their English text, which is also their English
+// translation, unless it has plural forms. Each language's translations are
+// in locales/<language>.json, which maps each key to its translation, or to
+// an object of its plural forms, e.g., {"one": "%d link", "other": "%d links"}.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+	"golang.org/x/text/number"
+)
+
+// CookieName is the name of the cookie which overrides the languages
+// requested by the Accept-Language header
+const CookieName = "lang"
+
+// Language is a language which the UI is translated into
+type Language struct {
+	Tag language.Tag
+	// Name is the language's name, in the language itself
+	Name string
+}
+
+// Languages are the languages which the UI is translated into, starting with
+// English, which is the fallback for messages without a translation
+var Languages = []Language{
+	{language.English, "English"},
+	{language.German, "Deutsch"},
+	{language.French, "Français"},
+}
+
+//go:embed locales/*.json
+var locales embed.FS
+
+var (
+	messages = mustLoadCatalog(locales)
+	matcher  = language.NewMatcher(tags())
+)
+
+// tags returns the tags of the supported languages
+func tags() []language.Tag {
+	tags := make([]language.Tag, 0, len(Languages))
+	for _, lang := range Languages {
+		tags = append(tags, lang.Tag)
+	}
+	return tags
+}
+
+// mustLoadCatalog builds the message catalog from the translations in
+// files, panicking if they're invalid, as they're embedded in the binary
+func mustLoadCatalog(files fs.FS) catalog.Catalog {
+	builder, err := loadCatalog(files)
+	if err != nil {
+		panic(err)
+	}
+	return builder
+}
+
+// loadCatalog builds the message catalog from the translations in files
+func loadCatalog(files fs.FS) (*catalog.Builder, error) {
+	builder := catalog.NewBuilder(catalog.Fallback(language.English))
+	for _, lang := range Languages {
+		file := path.Join("locales", lang.Tag.String()+".json")
+		translations, err := readTranslations(files, file)
+		if err != nil {
+			return nil, err
+		}
+		for key, translation := range translations {
+			if err := builder.Set(lang.Tag, key, translation); err != nil {
+				return nil, fmt.Errorf("%s: %q: %w", file, key, err)
+			}
+		}
+	}
+	return builder, nil
+}
+
+// readTranslations reads the translations in a locale file, which are
+// either strings, or objects of plural forms
+func readTranslations(files fs.FS, file string) (map[string]catalog.Message, error) {
+	contents, err := fs.ReadFile(files, file)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	translations := make(map[string]catalog.Message, len(raw))
+	for key, value := range raw {
+		var text string
+		if err := json.Unmarshal(value, &text); err == nil {
+			translations[key] = catalog.String(text)
+			continue
+		}
+
+		var forms map[string]string
+		if err := json.Unmarshal(value, &forms); err != nil || forms["other"] == "" {
+			return nil, fmt.Errorf("%s: %q must be a string, or an object of plural forms, including other", file, key)
+		}
+		var cases []interface{}
+		for _, form := range []string{"=0", "=1", "one", "other"} {
+			if text, ok := forms[form]; ok {
+				cases = append(cases, form, text)
+			}
+		}
+		if len(cases) != 2*len(forms) {
+			return nil, fmt.Errorf("%s: %q can only have the plural forms =0, =1, one, and other", file, key)
+		}
+		// The first argument selects the form
+		translations[key] = plural.Selectf(1, "", cases...)
+	}
+	return translations, nil
+}
+
+// Localizer selects the language of each request
+type Localizer struct {
+	// Default is the language used when a request doesn't ask for one which
+	// the UI is translated into
+	Default language.Tag
+	// CompactClicks formats click counts in compact notation, e.g., 1.2K
+	CompactClicks bool
+}
+
+// DefaultLocalizer returns a Localizer which falls back to English, and
+// formats click counts in full
+func DefaultLocalizer() Localizer {
+	return Localizer{Default: language.English}
+}
+
+// Match returns the supported language which best matches the supplied
+// languages, in the format of an Accept-Language header, or the default
+// language, if none of them do
+func (l Localizer) Match(accept ...string) language.Tag {
+	var requested []language.Tag
+	for _, value := range accept {
+		tags, _, err := language.ParseAcceptLanguage(value)
+		if err == nil {
+			requested = append(requested, tags...)
+		}
+	}
+	if len(requested) == 0 {
+		return l.fallback()
+	}
+	_, index, confidence := matcher.Match(requested...)
+	if confidence == language.No {
+		return l.fallback()
+	}
+	return Languages[index].Tag
+}
+
+// fallback returns the default language, or English, if it isn't set
+func (l Localizer) fallback() language.Tag {
+	if l.Default == language.Und {
+		return language.English
+	}
+	return l.Default
+}
+
+// FromRequest returns the locale of the request, in the language of its
+// language cookie, if it's set to a supported language, or its
+// Accept-Language header
+func (l Localizer) FromRequest(r *http.Request) *Locale {
+	if cookie, err := r.Cookie(CookieName); err == nil {
+		if tag, err := language.Parse(cookie.Value); err == nil && Supported(tag) {
+			return l.Locale(tag)
+		}
+	}
+	return l.Locale(l.Match(r.Header.Get("Accept-Language")))
+}
+
+// Locale returns the locale for a supported language
+func (l Localizer) Locale(tag language.Tag) *Locale {
+	return &Locale{
+		Tag:           tag,
+		Printer:       message.NewPrinter(tag, message.Catalog(messages)),
+		compactClicks: l.CompactClicks,
+	}
+}
+
+// Supported reports whether the UI is translated into the language
+func Supported(tag language.Tag) bool {
+	for _, lang := range Languages {
+		if lang.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Locale translates messages, and formats numbers, in a language
+type Locale struct {
+	Tag language.Tag
+	*message.Printer
+	compactClicks bool
+}
+
+// T translates the message with the supplied key, which is a format string,
+// formatting the arguments in the locale's language
+func (l *Locale) T(key string, args ...interface{}) string {
+	return l.Sprintf(key, args...)
+}
+
+// Lang returns the locale's language, for the lang attribute of HTML
+func (l *Locale) Lang() string {
+	return l.Tag.String()
+}
+
+// FormatNumber formats the number with the locale's thousands separator
+func (l *Locale) FormatNumber(n int) string {
+	return l.Sprint(number.Decimal(n))
+}
+
+// FormatDate formats the date with the month's name, e.g., 2 January 2006
+func (l *Locale) FormatDate(t time.Time) string {
+	return l.T("%[1]s %[2]s %[3]s", strconv.Itoa(t.Day()), l.T(t.Month().String()), strconv.Itoa(t.Year()))
+}
+
+// compactUnits are the units of compact notation, from largest to smallest,
+// as format strings which are translated
+var compactUnits = []struct {
+	size   float64
+	format string
+}{
+	{1e9, "%sB"},
+	{1e6, "%sM"},
+	{1e3, "%sK"},
+}
+
+// FormatCompact formats the number in compact notation, e.g., 1.2K, or 3M.
+// Numbers are rounded down, so that 999,999 is 999.9K, not 1,000K.
+func (l *Locale) FormatCompact(n int) string {
+	abs := math.Abs(float64(n))
+	for _, unit := range compactUnits {
+		if abs < unit.size {
+			continue
+		}
+		scaled := math.Floor(abs/unit.size*10) / 10
+		if n < 0 {
+			scaled = -scaled
+		}
+		return l.T(unit.format, l.Sprint(number.Decimal(scaled, number.MaxFractionDigits(1))))
+	}
+	return l.FormatNumber(n)
+}
+
+// FormatClicks formats a click count, in compact notation, if the locale's
+// Localizer formats clicks that way
+func (l *Locale) FormatClicks(clicks int) string {
+	if l.compactClicks {
+		return l.FormatCompact(clicks)
+	}
+	return l.FormatNumber(clicks)
+}
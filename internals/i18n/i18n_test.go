@@ -0,0 +1,180 @@
+package i18n
+
+import (
+	"encoding/json"
+	"gourlshortener/templates"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestLocalizerSelectsTheRequestsLanguage(t *testing.T) {
+	tests := []struct {
+		name, accept, cookie string
+		localizer            Localizer
+		expected             language.Tag
+	}{
+		{"no languages", "", "", DefaultLocalizer(), language.English},
+		{"supported language", "de-DE,de;q=0.9,en;q=0.8", "", DefaultLocalizer(), language.German},
+		{"preferred language isn't supported", "ja,fr;q=0.8", "", DefaultLocalizer(), language.French},
+		{"no supported languages", "ja,zh;q=0.8", "", DefaultLocalizer(), language.English},
+		{"configured default", "ja", "", Localizer{Default: language.German}, language.German},
+		{"cookie overrides the header", "de", "fr", DefaultLocalizer(), language.French},
+		{"unsupported cookie is ignored", "de", "ja", DefaultLocalizer(), language.German},
+		{"invalid cookie is ignored", "de", "!!", DefaultLocalizer(), language.German},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.accept != "" {
+				r.Header.Set("Accept-Language", test.accept)
+			}
+			if test.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CookieName, Value: test.cookie})
+			}
+
+			locale := test.localizer.FromRequest(r)
+			if locale.Tag != test.expected {
+				t.Errorf("got %s; want %s", locale.Tag, test.expected)
+			}
+		})
+	}
+}
+
+func TestLocaleFormatsNumbers(t *testing.T) {
+	english := DefaultLocalizer().Locale(language.English)
+	german := Localizer{CompactClicks: true}.Locale(language.German)
+	french := DefaultLocalizer().Locale(language.French)
+
+	tests := []struct {
+		name, actual, expected string
+	}{
+		{"english number", english.FormatNumber(1234567), "1,234,567"},
+		{"german number", german.FormatNumber(1234567), "1.234.567"},
+		{"small compact number", english.FormatCompact(999), "999"},
+		{"compact thousands", english.FormatCompact(1234), "1.2K"},
+		{"compact thousands are rounded down", english.FormatCompact(999999), "999.9K"},
+		{"compact millions", english.FormatCompact(3000000), "3M"},
+		{"compact billions", english.FormatCompact(2500000000), "2.5B"},
+		{"negative compact number", english.FormatCompact(-1500), "-1.5K"},
+		{"german compact number", german.FormatCompact(1234), "1,2 Tsd."},
+		{"french compact number", french.FormatCompact(1234), "1,2 k"},
+		{"clicks in full", english.FormatClicks(1234), "1,234"},
+		{"compact clicks", german.FormatClicks(1234), "1,2 Tsd."},
+		{"plural", english.T("%d revisions recorded.", 1), "1 revision recorded."},
+		{"german plural", german.T("%d revisions recorded.", 2), "2 Revisionen gespeichert."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.actual != test.expected {
+				t.Errorf("got %q; want %q", test.actual, test.expected)
+			}
+		})
+	}
+}
+
+// templateKeys matches the messages which the templates translate, e.g.,
+// {{ t "Shorten URL" }}
+var templateKeys = regexp.MustCompile(`\bt(?:HTML)? ("(?:[^"\\]|\\.)*")`)
+
+// codeKeys matches the messages which the Go code translates
+var codeKeys = regexp.MustCompile(`(?:\.T\(|translate\(locale, |NewError\(\w+, )("(?:[^"\\]|\\.)*")`)
+
+// formatVerbs matches the verbs in a format string
+var formatVerbs = regexp.MustCompile(`%(?:\[\d+\])?[a-z]`)
+
+func TestEveryMessageIsTranslated(t *testing.T) {
+	keys := map[string]bool{}
+	templateFiles, err := fs.Glob(templates.FS, "*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	partials, _ := fs.Glob(templates.FS, "partials/*.html")
+	for _, file := range append(templateFiles, partials...) {
+		contents, err := fs.ReadFile(templates.FS, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range templateKeys.FindAllStringSubmatch(string(contents), -1) {
+			key, err := strconv.Unquote(match[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys[key] = true
+		}
+	}
+
+	sources, err := filepath.Glob("../*/*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range sources {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range codeKeys.FindAllStringSubmatch(string(contents), -1) {
+			key, err := strconv.Unquote(match[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys[key] = true
+		}
+	}
+
+	for _, lang := range Languages[1:] {
+		contents, err := fs.ReadFile(locales, "locales/"+lang.Tag.String()+".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var translations map[string]interface{}
+		if err := json.Unmarshal(contents, &translations); err != nil {
+			t.Fatal(err)
+		}
+
+		for key := range keys {
+			if _, ok := translations[key]; !ok {
+				t.Errorf("%s: %q isn't translated", lang.Tag, key)
+			}
+		}
+		for key, translation := range translations {
+			forms, ok := translation.(map[string]interface{})
+			if !ok {
+				forms = map[string]interface{}{"other": translation}
+			}
+			for form, text := range forms {
+				if !sameVerbs(key, text.(string)) {
+					t.Errorf("%s: %q (%s) doesn't have the same verbs as its key", lang.Tag, key, form)
+				}
+			}
+		}
+	}
+}
+
+// sameVerbs reports whether the translation uses the same format verbs as
+// its key, in any order
+func sameVerbs(key, translation string) bool {
+	expected := formatVerbs.FindAllString(key, -1)
+	actual := formatVerbs.FindAllString(translation, -1)
+	sort.Strings(expected)
+	sort.Strings(actual)
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,232 @@
+// Package importer parses links to be imported in bulk from CSV or JSON Lines
+// files, and reports what happened to each of them.
+//
+// CSV files must start with a header row naming the columns, in any order.
+// JSON Lines files have one JSON object per line, with the same keys. The
+// columns, or keys, are:
+//
+//   - destination: the URL to shorten (required)
+//   - alias: the code of the shortened URL, instead of a generated one
+//   - clicks: the number of times the link was clicked
+//   - created: when the link was created, as an RFC 3339 timestamp or a date
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/shortcode"
+	"io"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The supported import formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// MaxRows is the most rows that can be imported at once
+const MaxRows = 10000
+
+// ErrFormat is returned when an import's format isn't supported
+var ErrFormat = errors.New("importer: unsupported format, which must be csv or jsonl")
+
+// createdLayouts are the layouts that created dates may be in
+var createdLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// Row is a link to be imported. Line is the row's line number in the file. If
+// the row couldn't be parsed, Reason explains why, in a message suitable for
+// showing to the user.
+type Row struct {
+	Line        int
+	Destination string
+	Alias       string
+	Clicks      int
+	Created     time.Time
+	Reason      string
+}
+
+// FormatFromFilename returns the import format implied by a file's extension,
+// or an empty string if it doesn't imply one
+func FormatFromFilename(filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	}
+	return ""
+}
+
+// FormatFromContentType returns the import format implied by a content type,
+// or an empty string if it doesn't imply one
+func FormatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return FormatCSV
+	case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+		return FormatJSONL
+	}
+	return ""
+}
+
+// Parse reads the rows of an import in the supplied format. Rows which can't
+// be parsed are returned with Reason set; an error is only returned if the whole
+// import can't be read.
+func Parse(r io.Reader, format string) ([]Row, error) {
+	var (
+		rows []Row
+		err  error
+	)
+	switch format {
+	case FormatCSV:
+		rows, err = parseCSV(r)
+	case FormatJSONL:
+		rows, err = parseJSONL(r)
+	default:
+		return nil, ErrFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > MaxRows {
+		return nil, fmt.Errorf("importer: too many rows; at most %d can be imported at once", MaxRows)
+	}
+
+	return rows, nil
+}
+
+func parseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("importer: reading the header row: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["destination"]; !ok {
+		return nil, errors.New("importer: the header row has no destination column")
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rows = append(rows, Row{Line: parseErr.Line, Reason: "The row isn't valid CSV."})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		rows = append(rows, newRow(line, field("destination"), field("alias"), field("clicks"), field("created")))
+	}
+
+	return rows, nil
+}
+
+// jsonRow is a row of a JSON Lines import. Clicks can be either a number or a
+// string.
+type jsonRow struct {
+	Destination string          `json:"destination"`
+	Alias       string          `json:"alias"`
+	Clicks      json.RawMessage `json:"clicks"`
+	Created     string          `json:"created"`
+}
+
+func parseJSONL(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []Row
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var data jsonRow
+		if err := json.Unmarshal(text, &data); err != nil {
+			rows = append(rows, Row{Line: line, Reason: "The row isn't a valid JSON object."})
+			continue
+		}
+		clicks := strings.Trim(string(data.Clicks), `"`)
+		if clicks == "null" {
+			clicks = ""
+		}
+		rows = append(rows, newRow(line, data.Destination, data.Alias, clicks, data.Created))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// newRow parses a row's fields
+func newRow(line int, destination, alias, clicks, created string) Row {
+	row := Row{Line: line, Destination: strings.TrimSpace(destination), Alias: strings.TrimSpace(alias)}
+
+	switch {
+	case row.Destination == "":
+		row.Reason = "The destination is missing."
+	case shortcode.Reserved(row.Alias):
+		row.Reason = fmt.Sprintf("The alias %q is the name of one of the site's own pages.", row.Alias)
+	case row.Alias != "" && !shortcode.Valid(row.Alias):
+		row.Reason = fmt.Sprintf("Aliases may only contain letters, numbers, '_', and '-', and be at most %d characters long.", shortcode.MaxLength)
+	}
+	if row.Reason != "" {
+		return row
+	}
+
+	if clicks = strings.TrimSpace(clicks); clicks != "" {
+		n, err := strconv.Atoi(clicks)
+		if err != nil || n < 0 {
+			row.Reason = fmt.Sprintf("The number of clicks, %q, isn't a whole number.", clicks)
+			return row
+		}
+		row.Clicks = n
+	}
+
+	if created = strings.TrimSpace(created); created != "" {
+		for _, layout := range createdLayouts {
+			if t, err := time.Parse(layout, created); err == nil {
+				row.Created = t
+				break
+			}
+		}
+		if row.Created.IsZero() {
+			row.Reason = fmt.Sprintf("The created date, %q, isn't a date such as 2024-02-21 or 2024-02-21T07:11:21Z.", created)
+		}
+	}
+
+	return row
+}
@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCSV(t *testing.T) {
+	input := "Destination,Clicks,Alias,Created\n" +
+		"https://osnews.com,12,osn,2024-02-21\n" +
+		"https://go.dev,,,\n" +
+		"https://example.org,lots,,\n" +
+		",,,\n"
+	rows, err := Parse(strings.NewReader(input), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Incorrect number of rows parsed. Expected %d; got %d", 4, len(rows))
+	}
+
+	want := Row{Line: 2, Destination: "https://osnews.com", Alias: "osn", Clicks: 12, Created: time.Date(2024, 2, 21, 0, 0, 0, 0, time.UTC)}
+	if rows[0] != want {
+		t.Errorf("Incorrect row parsed. Expected %+v; got %+v", want, rows[0])
+	}
+	if rows[1].Reason != "" || rows[1].Line != 3 {
+		t.Errorf("Expected the row to be valid. Got: %+v", rows[1])
+	}
+	if !strings.Contains(rows[2].Reason, "clicks") {
+		t.Errorf("Expected the clicks to be invalid. Got: %+v", rows[2])
+	}
+	if !strings.Contains(rows[3].Reason, "destination is missing") {
+		t.Errorf("Expected the destination to be missing. Got: %+v", rows[3])
+	}
+
+	if _, err = Parse(strings.NewReader("url,alias\nhttps://go.dev,go\n"), FormatCSV); err == nil {
+		t.Error("Expected an error for a header row without a destination column")
+	}
+}
+
+func TestParseJSONL(t *testing.T) {
+	input := `{"destination": "https://osnews.com", "clicks": 12, "created": "2024-02-21T07:11:21Z"}
+
+{"destination": "https://go.dev", "clicks": "3", "alias": "c++"}
+not json
+`
+	rows, err := Parse(strings.NewReader(input), FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Incorrect number of rows parsed. Expected %d; got %d", 3, len(rows))
+	}
+
+	if rows[0].Clicks != 12 || rows[0].Created != time.Date(2024, 2, 21, 7, 11, 21, 0, time.UTC) || rows[0].Reason != "" {
+		t.Errorf("Incorrect row parsed. Got: %+v", rows[0])
+	}
+	if rows[1].Line != 3 || !strings.Contains(rows[1].Reason, "Aliases") {
+		t.Errorf("Expected the alias to be invalid. Got: %+v", rows[1])
+	}
+	if rows[2].Line != 4 || rows[2].Reason == "" {
+		t.Errorf("Expected the row to be invalid. Got: %+v", rows[2])
+	}
+}
+
+func TestParseRejectsReservedAliases(t *testing.T) {
+	rows, err := Parse(strings.NewReader("Destination,Alias\nhttps://go.dev,login\n"), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || !strings.Contains(rows[0].Reason, "site's own pages") {
+		t.Errorf("Expected the alias to be reserved. Got: %+v", rows)
+	}
+}
+
+func TestParseRejectsUnknownFormat(t *testing.T) {
+	if _, err := Parse(strings.NewReader(""), "xml"); err != ErrFormat {
+		t.Errorf("Expected %s. Got: %v", ErrFormat, err)
+	}
+}
+
+func TestFormatDetection(t *testing.T) {
+	for filename, want := range map[string]string{"links.CSV": FormatCSV, "links.ndjson": FormatJSONL, "links.json": ""} {
+		if got := FormatFromFilename(filename); got != want {
+			t.Errorf("%s: got %q; want %q", filename, got, want)
+		}
+	}
+	for contentType, want := range map[string]string{"text/csv; charset=utf-8": FormatCSV, "application/x-ndjson": FormatJSONL, "application/json": ""} {
+		if got := FormatFromContentType(contentType); got != want {
+			t.Errorf("%s: got %q; want %q", contentType, got, want)
+		}
+	}
+}
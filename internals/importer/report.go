@@ -0,0 +1,44 @@
+package importer
+
+// Status is what happened to a row of an import
+type Status string
+
+// The statuses of a row of an import
+const (
+	StatusCreated   Status = "created"
+	StatusDuplicate Status = "duplicate"
+	StatusInvalid   Status = "invalid"
+)
+
+// Result is what happened to a row of an import. Reason explains why an
+// invalid row wasn't imported.
+type Result struct {
+	Line         int    `json:"line"`
+	Destination  string `json:"destination"`
+	ShortenedURL string `json:"shortened_url,omitempty"`
+	Status       Status `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// Report is what happened to every row of an import, along with the number
+// of rows with each status. If DryRun is true, nothing was stored.
+type Report struct {
+	DryRun     bool     `json:"dry_run"`
+	Created    int      `json:"created"`
+	Duplicates int      `json:"duplicates"`
+	Invalid    int      `json:"invalid"`
+	Results    []Result `json:"results"`
+}
+
+// Add adds a row's result to the report
+func (r *Report) Add(result Result) {
+	switch result.Status {
+	case StatusCreated:
+		r.Created++
+	case StatusDuplicate:
+		r.Duplicates++
+	case StatusInvalid:
+		r.Invalid++
+	}
+	r.Results = append(r.Results, result)
+}
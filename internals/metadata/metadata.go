@@ -0,0 +1,194 @@
+// Package metadata fetches the title and description of web pages, from
+// their <title> element and their Open Graph and description meta tags.
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gourlshortener/internals/validation"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DefaultTimeout is how long a fetch can take, by default
+const DefaultTimeout = 5 * time.Second
+
+// DefaultMaxBytes is the maximum number of bytes of a page that are read, by
+// default. Pages' metadata is in their <head>, so there's rarely any need to
+// read more.
+const DefaultMaxBytes = 512 * 1024
+
+// MaxTitleLength and MaxDescriptionLength are the maximum lengths, in
+// characters, of a fetched title and description. Longer ones are truncated.
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 500
+)
+
+// ErrNotHTML is returned when a page isn't an HTML document
+var ErrNotHTML = errors.New("metadata: not an HTML document")
+
+// Metadata is the title and description of a web page
+type Metadata struct {
+	Title, Description string
+}
+
+// Fetcher fetches the metadata of web pages
+type Fetcher struct {
+	Client *http.Client
+	// MaxBytes is the maximum number of bytes of a page which are read
+	MaxBytes int64
+}
+
+// NewFetcher creates a Fetcher whose requests time out after timeout, and
+// which read at most maxBytes of each page. Zero values use the defaults. If
+// blockPrivate is set, pages at private or local addresses aren't fetched,
+// including when a page redirects to one.
+func NewFetcher(timeout time.Duration, maxBytes int64, blockPrivate bool) *Fetcher {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if blockPrivate {
+		// The proxy would be dialed instead of the page, so it's not used
+		dialer := &net.Dialer{Timeout: timeout, Control: validation.RefusePrivateAddresses}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+
+	return &Fetcher{
+		Client:   &http.Client{Timeout: timeout, Transport: transport},
+		MaxBytes: maxBytes,
+	}
+}
+
+// Fetch retrieves the page at rawURL, and reads its metadata. Open Graph tags
+// are preferred over the <title> element and the description meta tag.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Metadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	rs, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("metadata: %s responded with %d %s", rawURL, rs.StatusCode, http.StatusText(rs.StatusCode))
+	}
+	if mediaType, _, err := mime.ParseMediaType(rs.Header.Get("Content-Type")); err != nil ||
+		(mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return nil, ErrNotHTML
+	}
+
+	maxBytes := f.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+
+	return Parse(io.LimitReader(rs.Body, maxBytes))
+}
+
+// Parse reads the metadata of an HTML document, stopping at the end of its
+// <head>
+func Parse(r io.Reader) (*Metadata, error) {
+	var title, ogTitle, description, ogDescription string
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return newMetadata(title, ogTitle, description, ogDescription), nil
+			}
+			return nil, z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			switch token.DataAtom {
+			case atom.Title:
+				inTitle = title == ""
+			case atom.Meta:
+				key := attr(token, "property")
+				if key == "" {
+					key = attr(token, "name")
+				}
+				content := attr(token, "content")
+				switch strings.ToLower(key) {
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					ogDescription = content
+				case "description":
+					description = content
+				}
+			case atom.Body:
+				return newMetadata(title, ogTitle, description, ogDescription), nil
+			}
+		case html.TextToken:
+			if inTitle {
+				title += string(z.Text())
+			}
+		case html.EndTagToken:
+			switch z.Token().DataAtom {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				return newMetadata(title, ogTitle, description, ogDescription), nil
+			}
+		}
+	}
+}
+
+// attr returns the value of a token's attribute, or an empty string
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func newMetadata(title, ogTitle, description, ogDescription string) *Metadata {
+	if ogTitle != "" {
+		title = ogTitle
+	}
+	if ogDescription != "" {
+		description = ogDescription
+	}
+	return &Metadata{
+		Title:       truncate(clean(title), MaxTitleLength),
+		Description: truncate(clean(description), MaxDescriptionLength),
+	}
+}
+
+// clean collapses the whitespace in a string
+func clean(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncate shortens a string to at most max characters
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
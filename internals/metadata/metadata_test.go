@@ -0,0 +1,111 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"gourlshortener/internals/validation"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want Metadata
+	}{
+		{
+			"title and description",
+			`<html><head><title> A
+			Page </title><meta name="description" content="About the page"></head><body></body></html>`,
+			Metadata{Title: "A Page", Description: "About the page"},
+		},
+		{
+			"prefers Open Graph tags",
+			`<head><title>A Page</title><meta property="og:title" content="An OG Page">
+			<meta name="description" content="About"><meta property="og:description" content="About OG"></head>`,
+			Metadata{Title: "An OG Page", Description: "About OG"},
+		},
+		{
+			"stops at the body",
+			`<head></head><body><title>Not the title</title></body>`,
+			Metadata{},
+		},
+		{
+			"truncates long titles",
+			`<title>` + strings.Repeat("a", MaxTitleLength+10) + `</title>`,
+			Metadata{Title: strings.Repeat("a", MaxTitleLength-1) + "…"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v; want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><title>A Page</title></head></html>`))
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>A Large Page` + strings.Repeat(" padding", 1000) + `</title>`))
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+			w.Header().Set("Content-Type", "text/html")
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	fetcher := NewFetcher(100*time.Millisecond, 64, false)
+
+	metadata, err := fetcher.Fetch(context.Background(), ts.URL+"/page")
+	if err != nil || metadata.Title != "A Page" {
+		t.Errorf("got %+v, %v; want the page's title", metadata, err)
+	}
+
+	metadata, err = fetcher.Fetch(context.Background(), ts.URL+"/large")
+	if err != nil || !strings.HasPrefix(metadata.Title, "A Large Page") || len(metadata.Title) > 64 {
+		t.Errorf("got %+v, %v; want the start of the page's title", metadata, err)
+	}
+
+	if _, err = fetcher.Fetch(context.Background(), ts.URL+"/slow"); err == nil {
+		t.Error("expected the fetch to time out")
+	}
+	if _, err = fetcher.Fetch(context.Background(), ts.URL+"/image"); !errors.Is(err, ErrNotHTML) {
+		t.Errorf("got %v; want %v", err, ErrNotHTML)
+	}
+	if _, err = fetcher.Fetch(context.Background(), ts.URL+"/missing"); err == nil {
+		t.Error("expected an error for a missing page")
+	}
+}
+
+func TestFetcherRefusesPrivateAddresses(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>An Internal Page</title></head></html>`))
+	}))
+	defer local.Close()
+
+	fetcher := NewFetcher(time.Second, 0, true)
+	if _, err := fetcher.Fetch(context.Background(), local.URL); !errors.Is(err, validation.ErrPrivateAddress) {
+		t.Errorf("got %v; want %v", err, validation.ErrPrivateAddress)
+	}
+}
@@ -0,0 +1,289 @@
+// Package migrate applies dbmate-format database migrations, recording the
+// applied versions in the same schema_migrations table as dbmate, so that
+// databases already provisioned by dbmate can be migrated by the binary.
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrNoneApplied is returned when rolling back, if no migrations have been
+// applied
+var ErrNoneApplied = errors.New("migrate: no migrations have been applied")
+
+// ErrUnknownVersion is returned by Pending if the database has a migration
+// applied which the Migrator doesn't have, e.g., as a newer version of the
+// binary applied it
+var ErrUnknownVersion = errors.New("migrate: the database has an unknown migration applied")
+
+// filenamePattern matches migration files, capturing their version and name,
+// e.g., 20240221071121_create_urls_table.sql
+var filenamePattern = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+// Migration is a single migration file
+type Migration struct {
+	Version, Name string
+	Up, Down      string
+	// UpTransaction and DownTransaction are false if the migration's
+	// section sets transaction:false
+	UpTransaction, DownTransaction bool
+}
+
+// Status is a migration along with whether it's been applied
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// New loads the migrations in the root directory of fsys
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// Load loads and parses the migrations in the root directory of fsys,
+// ordered by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		matches := filenamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, err := parse(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", entry.Name(), err)
+		}
+		migration.Version, migration.Name = matches[1], matches[2]
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// parse splits a migration into its up and down sections, which start with
+// "-- migrate:up" and "-- migrate:down" lines, optionally followed by
+// "transaction:false"
+func parse(contents string) (Migration, error) {
+	migration := Migration{UpTransaction: true, DownTransaction: true}
+	var (
+		section  *strings.Builder
+		up, down strings.Builder
+		foundUp  bool
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		directive, options := "", ""
+		if comment, ok := strings.CutPrefix(strings.TrimSpace(line), "--"); ok {
+			directive, options, _ = strings.Cut(strings.TrimSpace(comment), " ")
+		}
+		noTransaction := strings.Contains(options, "transaction:false")
+
+		switch directive {
+		case "migrate:up":
+			section, foundUp = &up, true
+			migration.UpTransaction = !noTransaction
+			continue
+		case "migrate:down":
+			section = &down
+			migration.DownTransaction = !noTransaction
+			continue
+		}
+		if section != nil {
+			section.WriteString(line)
+			section.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return migration, err
+	}
+	if !foundUp {
+		return migration, errors.New("no -- migrate:up section")
+	}
+
+	migration.Up = strings.TrimSpace(up.String())
+	migration.Down = strings.TrimSpace(down.String())
+	return migration, nil
+}
+
+// ensureTable creates the schema_migrations table, if it doesn't exist
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS "schema_migrations" (version varchar(128) primary key)`)
+	return err
+}
+
+// applied returns the versions of the migrations which have been applied
+func (m *Migrator) applied(ctx context.Context) (map[string]bool, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions[version] = true
+	}
+	return versions, rows.Err()
+}
+
+// run runs a migration's SQL and records or removes its version, in a
+// transaction unless useTransaction is false
+func (m *Migrator) run(ctx context.Context, script string, useTransaction bool, record, version string) error {
+	if !useTransaction {
+		if script != "" {
+			if _, err := m.DB.ExecContext(ctx, script); err != nil {
+				return err
+			}
+		}
+		_, err := m.DB.ExecContext(ctx, record, version)
+		return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if script != "" {
+		if _, err = tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, record, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies every pending migration, in order, returning those applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	versions, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range m.Migrations {
+		if versions[migration.Version] {
+			continue
+		}
+		err = m.run(ctx, migration.Up, migration.UpTransaction, `INSERT INTO schema_migrations (version) VALUES (?)`, migration.Version)
+		if err != nil {
+			return applied, fmt.Errorf("migrate: applying %s_%s: %w", migration.Version, migration.Name, err)
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// Down rolls back the most recently applied migration, returning it
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	versions, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if !versions[migration.Version] {
+			continue
+		}
+		err = m.run(ctx, migration.Down, migration.DownTransaction, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: rolling back %s_%s: %w", migration.Version, migration.Name, err)
+		}
+		return &migration, nil
+	}
+	return nil, ErrNoneApplied
+}
+
+// Status lists every migration, along with whether it's been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	versions, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		statuses = append(statuses, Status{Migration: migration, Applied: versions[migration.Version]})
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations which haven't been applied, without changing
+// the database, so that it can check a database before it's used. It fails
+// with ErrNoneApplied if the database has never been migrated, and with
+// ErrUnknownVersion if it has a migration applied which m doesn't have.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	var tables int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tables)
+	if err != nil {
+		return nil, err
+	}
+	if tables == 0 {
+		return nil, ErrNoneApplied
+	}
+
+	versions, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range m.Migrations {
+		if !versions[migration.Version] {
+			pending = append(pending, migration)
+		}
+		delete(versions, migration.Version)
+	}
+	for version := range versions {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownVersion, version)
+	}
+	return pending, nil
+}
+
+// Filename returns the migration's file name
+func (m Migration) Filename() string {
+	return m.Version + "_" + m.Name + ".sql"
+}
@@ -0,0 +1,223 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gourlshortener/db"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	conn, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+var testMigrations = fstest.MapFS{
+	"20240101000000_create_things.sql": {Data: []byte(`-- migrate:up
+CREATE TABLE things (name TEXT);
+
+-- migrate:down
+DROP TABLE things;
+`)},
+	"20240102000000_add_colour.sql": {Data: []byte(`-- migrate:up transaction:false
+ALTER TABLE things ADD COLUMN colour TEXT;
+
+-- migrate:down
+ALTER TABLE things DROP COLUMN colour;
+`)},
+	"README.md": {Data: []byte("not a migration")},
+}
+
+func TestParse(t *testing.T) {
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("Incorrect number of migrations loaded. Expected %d; got %d", 2, len(migrations))
+	}
+
+	first, second := migrations[0], migrations[1]
+	if first.Name != "create_things" || first.Up != "CREATE TABLE things (name TEXT);" || first.Down != "DROP TABLE things;" {
+		t.Errorf("Incorrect migration parsed. Got: %+v", first)
+	}
+	if second.UpTransaction || !second.DownTransaction {
+		t.Errorf("Incorrect transaction options parsed. Got: %+v", second)
+	}
+
+	if _, err = Load(fstest.MapFS{"1_bad.sql": {Data: []byte("SELECT 1;")}}); err == nil {
+		t.Error("Expected an error for a migration without an up section")
+	}
+}
+
+func TestUpDownAndStatus(t *testing.T) {
+	conn := newTestDB(t)
+	m, err := New(conn, testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("Incorrect number of migrations applied. Expected %d; got %d", 2, len(applied))
+	}
+	if _, err = conn.Exec(`INSERT INTO things (name, colour) VALUES ('apple', 'red')`); err != nil {
+		t.Errorf("Migrations were not applied: %s", err)
+	}
+
+	if applied, err = m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("Expected no migrations to be applied twice. Got: %d, %v", len(applied), err)
+	}
+
+	rolledBack, err := m.Down(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack.Version != "20240102000000" {
+		t.Errorf("Incorrect migration rolled back. Got: %s", rolledBack.Filename())
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("Incorrect statuses returned. Got: %+v", statuses)
+	}
+
+	if _, err = m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Down(ctx); err != ErrNoneApplied {
+		t.Errorf("Expected %s. Got: %v", ErrNoneApplied, err)
+	}
+}
+
+func TestPendingChecksTheDatabasesVersion(t *testing.T) {
+	conn := newTestDB(t)
+	m, err := New(conn, testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err = m.Pending(ctx); !errors.Is(err, ErrNoneApplied) {
+		t.Errorf("Expected %s. Got: %v", ErrNoneApplied, err)
+	}
+
+	older := &Migrator{DB: conn, Migrations: m.Migrations[:1]}
+	if _, err = older.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil || len(pending) != 1 || pending[0].Version != "20240102000000" {
+		t.Errorf("Expected the second migration to be pending. Got: %+v, %v", pending, err)
+	}
+
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = older.Pending(ctx); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Expected %s. Got: %v", ErrUnknownVersion, err)
+	}
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	conn := newTestDB(t)
+	m, err := New(conn, fstest.MapFS{
+		"1_broken.sql": {Data: []byte("-- migrate:up\nCREATE TABLE things (name TEXT);\nINSERT INTO missing VALUES (1);\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.Up(context.Background()); err == nil {
+		t.Fatal("Expected the migration to fail")
+	}
+	statuses, _ := m.Status(context.Background())
+	if statuses[0].Applied {
+		t.Error("Expected the failed migration not to be recorded")
+	}
+	if _, err = conn.Exec(`SELECT * FROM things`); err == nil {
+		t.Error("Expected the failed migration to be rolled back")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	conn := newTestDB(t)
+	m, err := New(conn, db.Migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for range m.Migrations {
+		if _, err = m.Down(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUniqueCodeMigrationRenamesDuplicateCodes(t *testing.T) {
+	conn := newTestDB(t)
+	m, err := New(conn, db.Migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	all := m.Migrations
+	for i, migration := range all {
+		if migration.Version == "20261019120000" {
+			m.Migrations = all[:i]
+		}
+	}
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(`INSERT INTO urls (original_url, shortened_url) VALUES
+    ('https://go.dev', 'http://abc'), ('https://osnews.com', 'https://abc'), ('https://example.com', 'https://def');
+INSERT INTO link_revisions (shortened_url, revision, original_url, actor) VALUES ('https://abc', 1, 'https://osnews.com', 'system');
+INSERT INTO link_tags (shortened_url, tag) VALUES ('https://abc', 'news')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Migrations = all
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatalf("Expected duplicate codes to be renamed. Got: %s", err)
+	}
+
+	var renamed string
+	if err = conn.QueryRow(`SELECT shortened_url FROM urls WHERE original_url = 'https://osnews.com'`).Scan(&renamed); err != nil {
+		t.Fatal(err)
+	}
+	if renamed != "https://abc-2" {
+		t.Errorf("got %s; want the newer link to be renamed to https://abc-2", renamed)
+	}
+	for _, table := range []string{"link_revisions", "link_tags"} {
+		var count int
+		if err = conn.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE shortened_url = ?`, renamed).Scan(&count); err != nil || count != 1 {
+			t.Errorf("%s: expected the renamed link's rows to be renamed. Got %d (%v)", table, count, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// LinkChange is a set of changes to a shortened URL, which Change makes
+// together. Empty and nil fields are left as they are.
+type LinkChange struct {
+	OriginalURL string
+	// Settings are applied as by UpdateSettings
+	Settings                  map[string]string
+	Folder                    *string
+	Tags                      *[]string
+	Title, Description, Notes *string
+}
+
+// Change makes a set of changes to a shortened URL in a single transaction,
+// so that either all or none of them are made. A change of destination or
+// settings is recorded as one new revision attributed to the supplied actor.
+// The folder, tags, and details are normalised as by SetFolder, SetTags, and
+// SetDetails.
+func (m *ShortenerDataModel) Change(shortened string, change LinkChange, actor string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = applyChange(tx, shortened, change, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Create inserts a new shortened URL, as Insert does, and makes a set of
+// changes to it, as Change does, in a single transaction, so that the link
+// isn't created if any of the changes can't be made
+func (m *ShortenerDataModel) Create(original, shortened string, change LinkChange, actor string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = insertLink(tx, original, shortened, 0); err != nil {
+		return err
+	}
+	if err = applyChange(tx, shortened, change, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// applyChange makes a set of changes to a shortened URL in tx
+func applyChange(tx *sql.Tx, shortened string, change LinkChange, actor string) error {
+	var (
+		folder string
+		tags   []string
+		err    error
+	)
+	if change.Folder != nil {
+		if folder, err = NormaliseFolder(*change.Folder); err != nil {
+			return err
+		}
+	}
+	if change.Tags != nil {
+		if tags, err = NormaliseTags(*change.Tags); err != nil {
+			return err
+		}
+	}
+
+	var (
+		original string
+		details  LinkDetails
+	)
+	stmt := `SELECT original_url, title, description, notes FROM urls WHERE shortened_url = ?`
+	err = tx.QueryRow(stmt, shortened).Scan(&original, &details.Title, &details.Description, &details.Notes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if change.OriginalURL != "" || len(change.Settings) > 0 {
+		settings, err := currentSettings(tx, shortened)
+		if err != nil {
+			return err
+		}
+		for name, value := range change.Settings {
+			if value == "" {
+				delete(settings, name)
+				continue
+			}
+			settings[name] = value
+		}
+		if change.OriginalURL != "" {
+			original = change.OriginalURL
+			if err = updateDestination(tx, shortened, original); err != nil {
+				return err
+			}
+		}
+		if err = insertRevision(tx, shortened, original, settings, actor); err != nil {
+			return err
+		}
+	}
+
+	if change.Folder != nil {
+		if _, err = tx.Exec(`UPDATE urls SET folder = ? WHERE shortened_url = ?`, folder, shortened); err != nil {
+			return err
+		}
+	}
+	if change.Tags != nil {
+		if err = replaceTags(tx, shortened, tags); err != nil {
+			return err
+		}
+	}
+
+	if change.Title != nil || change.Description != nil || change.Notes != nil {
+		if change.Title != nil {
+			details.Title = *change.Title
+		}
+		if change.Description != nil {
+			details.Description = *change.Description
+		}
+		if change.Notes != nil {
+			details.Notes = *change.Notes
+		}
+		if details, err = details.Normalise(); err != nil {
+			return err
+		}
+		stmt := `UPDATE urls SET title = ?, description = ?, notes = ? WHERE shortened_url = ?`
+		if _, err = tx.Exec(stmt, details.Title, details.Description, details.Notes, shortened); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
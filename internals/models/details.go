@@ -0,0 +1,87 @@
+package models
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// The maximum lengths, in characters, of a link's title, description, and
+// notes
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 500
+	MaxNotesLength       = 5000
+)
+
+// LinkDetails stores the title, description, and notes of a shortened URL
+type LinkDetails struct {
+	Title, Description, Notes string
+}
+
+// Normalise trims the title, description, and notes. It returns
+// ErrInvalidDetails if any of them is too long.
+func (d LinkDetails) Normalise() (LinkDetails, error) {
+	d.Title = strings.TrimSpace(d.Title)
+	d.Description = strings.TrimSpace(d.Description)
+	d.Notes = strings.TrimSpace(d.Notes)
+	if utf8.RuneCountInString(d.Title) > MaxTitleLength ||
+		utf8.RuneCountInString(d.Description) > MaxDescriptionLength ||
+		utf8.RuneCountInString(d.Notes) > MaxNotesLength {
+		return d, ErrInvalidDetails
+	}
+	return d, nil
+}
+
+// SetDetails replaces the title, description, and notes of a shortened URL.
+// They're normalised with LinkDetails.Normalise.
+func (m *ShortenerDataModel) SetDetails(shortened string, details LinkDetails) error {
+	details, err := details.Normalise()
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE urls SET title = ?, description = ?, notes = ? WHERE shortened_url = ?`
+	result, err := m.DB.Exec(stmt, details.Title, details.Description, details.Notes, shortened)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// FillDetails sets the title and description of a shortened URL, such as
+// those fetched from its destination, but only where they're empty, so that
+// they don't replace any that were set in the meantime
+func (m *ShortenerDataModel) FillDetails(shortened, title, description string) error {
+	details, err := LinkDetails{Title: title, Description: description}.Normalise()
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE urls
+SET title = CASE WHEN title = '' THEN ? ELSE title END,
+    description = CASE WHEN description = '' THEN ? ELSE description END
+WHERE shortened_url = ?`
+	result, err := m.DB.Exec(stmt, details.Title, details.Description, shortened)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
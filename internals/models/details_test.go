@@ -0,0 +1,69 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanSetUrlDetails(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	details := LinkDetails{Title: " MDN ", Description: "424 Failed Dependency", Notes: "Used in the docs"}
+	if err := m.SetDetails("https://4C2P1PC8+", details); err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	data, _ := m.Get("https://4C2P1PC8+")
+	expected := LinkDetails{Title: "MDN", Description: "424 Failed Dependency", Notes: "Used in the docs"}
+	if data.LinkDetails != expected {
+		t.Errorf("Details were not set. Expected %+v. Got: %+v", expected, data.LinkDetails)
+	}
+
+	err := m.SetDetails("https://4C2P1PC8+", LinkDetails{Title: strings.Repeat("a", MaxTitleLength+1)})
+	if err != ErrInvalidDetails {
+		t.Errorf("Expected %s. Got: %v", ErrInvalidDetails, err)
+	}
+	if err = m.SetDetails("https://missing", LinkDetails{}); err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+}
+
+func TestFillDetailsKeepsExistingDetails(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	if err := m.SetDetails("https://4C2P1PC8+", LinkDetails{Title: "MDN"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.FillDetails("https://4C2P1PC8+", "424 Failed Dependency - HTTP | MDN", "The HTTP 424 status code")
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	data, _ := m.Get("https://4C2P1PC8+")
+	if data.Title != "MDN" || data.Description != "The HTTP 424 status code" {
+		t.Errorf("Only the empty details should be filled in. Got: %+v", data.LinkDetails)
+	}
+}
+
+func TestCanSearchUrls(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	if _, err := m.Insert("https://osnews.com", "https://6C2P1PC8+", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetDetails("https://6C2P1PC8+", LinkDetails{Notes: "Shared 100% of the time"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]int{"osnews": 1, "MOZILLA": 1, "100%": 1, "%": 1, "_": 0, "https": 2}
+	for query, want := range tests {
+		rows, err := m.List(LinkFilter{Query: query})
+		if err != nil {
+			t.Errorf("Did not expect an error to be returned. Got: %s", err)
+		}
+		if len(rows) != want {
+			t.Errorf("%q: Incorrect number of rows returned. Expected %d; got %d", query, want, len(rows))
+		}
+	}
+}
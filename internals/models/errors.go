@@ -6,4 +6,28 @@ import (
 
 // ErrNoRecord simplifies returning a specific error message when no matching
 // database model is able to be retrieved.
-var ErrNoRecord = errors.New("models: no matching record found")
\ No newline at end of file
+var ErrNoRecord = errors.New("models: no matching record found")
+
+// ErrDuplicate is returned when a record can't be stored because its original
+// URL, or its shortened URL, is already stored.
+var ErrDuplicate = errors.New("models: duplicate record")
+
+// ErrInvalidTag is returned when a tag is empty, too long, or contains
+// characters other than letters, digits, hyphens, and underscores.
+var ErrInvalidTag = errors.New("models: invalid tag")
+
+// ErrInvalidFolder is returned when a folder name is too long, or contains
+// characters other than letters, digits, spaces, and . / _ -
+var ErrInvalidFolder = errors.New("models: invalid folder")
+
+// ErrInvalidDetails is returned when a link's title, description, or notes
+// are too long.
+var ErrInvalidDetails = errors.New("models: invalid details")
+
+// ErrDuplicateCode is returned when a record can't be stored because its
+// shortened URL's code is already in use, whatever its scheme.
+var ErrDuplicateCode = errors.New("models: duplicate code")
+
+// ErrInvalidUser is returned when a user's name is empty, too long, or
+// contains characters other than lower-case letters, digits, and . _ -
+var ErrInvalidUser = errors.New("models: invalid user")
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ExportFilter restricts which links are exported. Zero times, and nil click
+// counts, don't restrict the export. CreatedTo is exclusive.
+type ExportFilter struct {
+	CreatedFrom, CreatedTo time.Time
+	MinClicks, MaxClicks   *int
+}
+
+// sqliteTimeLayout is the layout that SQLite's CURRENT_TIMESTAMP uses
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// Export retrieves the links which match the filter, oldest first, along with
+// their statistics, passing them to fn one at a time, rather than reading them
+// all into memory. If fn returns an error, the export stops and the error is
+// returned.
+func (m *ShortenerDataModel) Export(filter ExportFilter, fn func(*LinkStats) error) error {
+	var (
+		conditions []string
+		args       []any
+	)
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created >= ?")
+		args = append(args, filter.CreatedFrom.UTC().Format(sqliteTimeLayout))
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created < ?")
+		args = append(args, filter.CreatedTo.UTC().Format(sqliteTimeLayout))
+	}
+	if filter.MinClicks != nil {
+		conditions = append(conditions, "clicks >= ?")
+		args = append(args, *filter.MinClicks)
+	}
+	if filter.MaxClicks != nil {
+		conditions = append(conditions, "clicks <= ?")
+		args = append(args, *filter.MaxClicks)
+	}
+
+	stmt := `SELECT original_url, shortened_url, clicks, created, updated,
+    (SELECT COUNT(*) FROM link_revisions WHERE link_revisions.shortened_url = urls.shortened_url)
+FROM urls`
+	if len(conditions) > 0 {
+		stmt += "\nWHERE " + strings.Join(conditions, " AND ")
+	}
+	stmt += "\nORDER BY created ASC, original_url ASC"
+
+	rows, err := m.reader().Query(stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		stats := &LinkStats{}
+		err := rows.Scan(&stats.OriginalURL, &stats.ShortenedURL, &stats.Clicks, &stats.Created, &stats.Updated, &stats.Revisions)
+		if err != nil {
+			return err
+		}
+		if err = fn(stats); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
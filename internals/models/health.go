@@ -0,0 +1,138 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LinkHealth stores the outcome of the latest check of a link's destination:
+// the status code of its final response, or 0 if there wasn't one, the URL
+// which it finally redirected to, how long the check took, why the request
+// failed, if it did, and when it was checked, along with how many checks in a
+// row have failed, and whether that's enough for the link to be broken
+type LinkHealth struct {
+	ShortenedURL        string
+	StatusCode          int
+	FinalURL            string
+	Latency             time.Duration
+	Error               string
+	Checked             time.Time
+	ConsecutiveFailures int
+	Broken              bool
+}
+
+// OK reports whether the check succeeded: the destination responded, without
+// an error status
+func (h *LinkHealth) OK() bool {
+	return h.Error == "" && h.StatusCode > 0 && h.StatusCode < 400
+}
+
+// The statuses of a link's health
+const (
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+	HealthBroken  = "broken"
+)
+
+// Status summarises the link's health: broken, failing, if its latest check
+// failed, but not enough checks in a row have failed for it to be broken, or
+// ok
+func (h *LinkHealth) Status() string {
+	switch {
+	case h.Broken:
+		return HealthBroken
+	case h.ConsecutiveFailures > 0:
+		return HealthFailing
+	default:
+		return HealthOK
+	}
+}
+
+// healthColumns are the columns of the link_health table that are scanned
+// into LinkHealth by scanHealth
+const healthColumns = `shortened_url, status_code, final_url, latency_ms, error, checked_at, consecutive_failures, broken`
+
+// scanHealth scans a row of healthColumns into LinkHealth
+func scanHealth(row interface{ Scan(...any) error }) (*LinkHealth, error) {
+	health := &LinkHealth{}
+	var latency int64
+	err := row.Scan(&health.ShortenedURL, &health.StatusCode, &health.FinalURL, &latency, &health.Error,
+		&health.Checked, &health.ConsecutiveFailures, &health.Broken)
+	if err != nil {
+		return nil, err
+	}
+	health.Latency = time.Duration(latency) * time.Millisecond
+	return health, nil
+}
+
+// RecordHealth records the outcome of a check of a link's destination,
+// counting how many checks in a row have failed. The link is broken once
+// threshold checks in a row have failed.
+func (m *ShortenerDataModel) RecordHealth(health *LinkHealth, threshold int) error {
+	failed := 1
+	if health.OK() {
+		failed = 0
+	}
+
+	// A failure adds to the failures in a row, and a success resets them.
+	// The link must exist, so that a check which finishes after it's
+	// deleted doesn't leave its health behind.
+	stmt := `INSERT INTO link_health (shortened_url, status_code, final_url, latency_ms, error, checked_at, consecutive_failures, broken)
+SELECT shortened_url, ?, ?, ?, ?, ?, ?, ? >= ? FROM urls WHERE shortened_url = ?
+ON CONFLICT (shortened_url) DO UPDATE SET
+    status_code = excluded.status_code,
+    final_url = excluded.final_url,
+    latency_ms = excluded.latency_ms,
+    error = excluded.error,
+    checked_at = excluded.checked_at,
+    consecutive_failures = CASE WHEN excluded.consecutive_failures = 0 THEN 0 ELSE link_health.consecutive_failures + 1 END,
+    broken = excluded.consecutive_failures > 0 AND link_health.consecutive_failures + 1 >= ?`
+	result, err := m.DB.Exec(stmt,
+		health.StatusCode, health.FinalURL, health.Latency.Milliseconds(), health.Error, health.Checked.UTC(),
+		failed, failed, threshold, health.ShortenedURL, threshold)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// Health retrieves the outcome of the latest check of a link's destination.
+// It returns ErrNoRecord if it hasn't been checked.
+func (m *ShortenerDataModel) Health(shortened string) (*LinkHealth, error) {
+	stmt := `SELECT ` + healthColumns + ` FROM link_health WHERE shortened_url = ?`
+	health, err := scanHealth(m.reader().QueryRow(stmt, shortened))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRecord
+	}
+	return health, err
+}
+
+// AllHealth retrieves the outcome of the latest check of every link whose
+// destination has been checked, keyed by shortened URL
+func (m *ShortenerDataModel) AllHealth() (map[string]*LinkHealth, error) {
+	stmt := `SELECT ` + healthColumns + ` FROM link_health`
+	rows, err := m.reader().Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := map[string]*LinkHealth{}
+	for rows.Next() {
+		health, err := scanHealth(rows)
+		if err != nil {
+			return nil, err
+		}
+		all[health.ShortenedURL] = health
+	}
+	return all, rows.Err()
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecordHealthFlagsBrokenLinks(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	checked := time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+
+	if _, err := m.Health("https://4C2P1PC8+"); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Expected an unchecked link to have no health. Got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		health   LinkHealth
+		failures int
+		broken   bool
+	}{
+		{"success", LinkHealth{StatusCode: 200, FinalURL: "https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/424", Latency: 120 * time.Millisecond}, 0, false},
+		{"first failure", LinkHealth{StatusCode: 404}, 1, false},
+		{"second failure", LinkHealth{Error: "connection refused"}, 2, true},
+		{"third failure", LinkHealth{StatusCode: 500}, 3, true},
+		{"recovery", LinkHealth{StatusCode: 301, FinalURL: "https://developer.mozilla.org/"}, 0, false},
+	}
+	for _, test := range tests {
+		test.health.ShortenedURL = "https://4C2P1PC8+"
+		test.health.Checked = checked
+		if err := m.RecordHealth(&test.health, 2); err != nil {
+			t.Fatalf("%s: did not expect an error to be returned. Got: %s", test.name, err)
+		}
+
+		health, err := m.Health("https://4C2P1PC8+")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if health.ConsecutiveFailures != test.failures || health.Broken != test.broken {
+			t.Errorf("%s: got %d failures, broken: %t; want %d, broken: %t", test.name, health.ConsecutiveFailures, health.Broken, test.failures, test.broken)
+		}
+		if health.StatusCode != test.health.StatusCode || health.Error != test.health.Error || !health.Checked.Equal(checked) {
+			t.Errorf("%s: incorrect health recorded. Got: %+v", test.name, health)
+		}
+		checked = checked.Add(time.Hour)
+	}
+
+	all, err := m.AllHealth()
+	if err != nil || len(all) != 1 || all["https://4C2P1PC8+"] == nil {
+		t.Errorf("Expected the link's health to be listed. Got: %v, %v", all, err)
+	}
+
+	if err = m.RecordHealth(&LinkHealth{ShortenedURL: "https://missing", StatusCode: 200, Checked: checked}, 2); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Expected %s for a missing link. Got: %v", ErrNoRecord, err)
+	}
+
+	// A link's health is forgotten when its destination changes
+	if err = m.Update("https://4C2P1PC8+", "https://go.dev", SystemActor); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Health("https://4C2P1PC8+"); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Expected the previous destination's health to be forgotten. Got: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ImportLink is a link to be imported: its original and shortened URLs, the
+// number of times it was clicked, and when it was created. A zero Created
+// time means that the link is created now.
+type ImportLink struct {
+	OriginalURL, ShortenedURL string
+	Clicks                    int
+	Created                   time.Time
+	// Allocate, if it's set, allocates the link's shortened URL instead of
+	// ShortenedURL, by generating shortened URLs until available returns nil
+	// for one. available returns ErrDuplicateCode if its code is in use.
+	Allocate func(available func(shortened string) error) (string, error)
+}
+
+// Import inserts the supplied links in a single transaction, recording each
+// one's first revision as made by actor. It returns, for each link, nil if it
+// was inserted, or ErrDuplicate if its original URL, or the code of the
+// shortened URL it was given, was already stored, including earlier in the
+// same import. Links whose shortened URL is allocated get another one if its
+// code is in use. If dryRun is true, nothing is stored, and no shortened URLs
+// are allocated, but the results are the same as if they had been.
+func (m *ShortenerDataModel) Import(links []*ImportLink, actor string, dryRun bool) ([]error, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]error, len(links))
+	originals, codes := map[string]bool{}, map[string]bool{}
+	// available returns ErrDuplicateCode if the shortened URL's code is in
+	// use, including earlier in the import
+	available := func(shortened string) error {
+		code := Code(shortened)
+		if codes[code] {
+			return ErrDuplicateCode
+		}
+		if exists, err := codeExists(tx, code); err != nil || exists {
+			if err == nil {
+				err = ErrDuplicateCode
+			}
+			return err
+		}
+		return nil
+	}
+
+	for i, link := range links {
+		exists, err := originalExists(tx, link.OriginalURL)
+		if err != nil {
+			return nil, err
+		}
+		if exists || originals[link.OriginalURL] {
+			results[i] = ErrDuplicate
+			continue
+		}
+
+		switch {
+		case link.Allocate == nil:
+			if err = available(link.ShortenedURL); errors.Is(err, ErrDuplicateCode) {
+				results[i] = ErrDuplicate
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		case dryRun:
+			// Shortened URLs aren't allocated on dry runs, so that codes
+			// aren't used up
+			originals[link.OriginalURL] = true
+			continue
+		default:
+			if link.ShortenedURL, err = link.Allocate(available); err != nil {
+				return nil, err
+			}
+		}
+		originals[link.OriginalURL], codes[Code(link.ShortenedURL)] = true, true
+		if dryRun {
+			continue
+		}
+
+		var created any
+		if !link.Created.IsZero() {
+			created = link.Created.UTC().Format(sqliteTimeLayout)
+		}
+		stmt := `INSERT INTO urls (original_url, shortened_url, clicks, created, updated)
+VALUES (?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), COALESCE(?, CURRENT_TIMESTAMP))`
+		if _, err = tx.Exec(stmt, link.OriginalURL, link.ShortenedURL, link.Clicks, created, created); err != nil {
+			return nil, err
+		}
+		if err = insertRevision(tx, link.ShortenedURL, link.OriginalURL, nil, actor); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return results, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// originalExists reports whether an original URL is already stored
+func originalExists(tx *sql.Tx, original string) (bool, error) {
+	return rowExists(tx, `SELECT 1 FROM urls WHERE original_url = ? LIMIT 1`, original)
+}
+
+// codeExists reports whether a shortened URL with the supplied code, with
+// either scheme, is already stored
+func codeExists(tx *sql.Tx, code string) (bool, error) {
+	return rowExists(tx, `SELECT 1 FROM urls WHERE shortened_url IN (?, ?) LIMIT 1`, "https://"+code, "http://"+code)
+}
+
+// rowExists reports whether the query returns a row
+func rowExists(tx *sql.Tx, query string, args ...any) (bool, error) {
+	var found int
+	err := tx.QueryRow(query, args...).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
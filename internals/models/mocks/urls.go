@@ -1,46 +1,367 @@
 package mocks
 
 import (
-	"errors"
 	"gourlshortener/internals/models"
+	"strings"
+	"time"
 )
 
 var mockDataModel = &models.ShortenerData{
 	OriginalURL:  "https://osnews.com",
 	ShortenedURL: "http://shorten3d",
 	Clicks:       2120,
+	Folder:       "reading",
+	Tags:         []string{"news", "tech"},
+	LinkDetails: models.LinkDetails{
+		Title:       "OSnews",
+		Description: "Exploring the future of computing",
+	},
+}
+
+var mockRevision = &models.LinkRevision{
+	Revision:     1,
+	ShortenedURL: "http://shorten3d",
+	OriginalURL:  "https://osnews.com",
+	Settings:     map[string]string{},
+	Actor:        models.SystemActor,
+	Created:      time.Date(2024, time.February, 21, 7, 11, 21, 0, time.UTC),
 }
 
 // ShortenerDataModel implements a mock model for testing shortner data
+//
+// LinkSettings, if set, are the mock record's settings. Filled, if set,
+// receives the details passed to FillDetails. LinkHealth, if set, is the mock
+// record's health, and Checked, if set, receives the health passed to
+// RecordHealth.
 type ShortenerDataModel struct {
+	LinkSettings map[string]string
+	Filled       chan models.LinkDetails
+	LinkHealth   *models.LinkHealth
+	Checked      chan *models.LinkHealth
 }
 
-// Insert mocks the creation of a new shortener data record
+// Insert mocks the creation of a new shortener data record. The mock
+// record's code is already in use.
 func (m *ShortenerDataModel) Insert(original string, shortened string, clicks int) (int, error) {
+	if models.Code(shortened) == models.Code(mockDataModel.ShortenedURL) {
+		return 0, models.ErrDuplicateCode
+	}
 	return 1, nil
 }
 
+// Create mocks the creation of a new shortener data record along with a set
+// of changes to it. The mock record's code is already in use.
+func (m *ShortenerDataModel) Create(original, shortened string, change models.LinkChange, actor string) error {
+	if _, err := m.Insert(original, shortened, 0); err != nil {
+		return err
+	}
+	if change.Tags != nil {
+		if _, err := models.NormaliseTags(*change.Tags); err != nil {
+			return err
+		}
+	}
+	if change.Folder != nil {
+		if _, err := models.NormaliseFolder(*change.Folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Get mocks the retrieval of a new shortener data record
 func (m *ShortenerDataModel) Get(shortened string) (*models.ShortenerData, error) {
 	switch shortened {
 	case "http://shorten3d":
 		return mockDataModel, nil
 	default:
-		return nil, errors.New("models: no matching record found")
+		return nil, models.ErrNoRecord
 	}
 }
 
+// GetByCode mocks the retrieval of a shortener data record by its code
+func (m *ShortenerDataModel) GetByCode(code string) (*models.ShortenerData, error) {
+	return m.Get("http://" + code)
+}
+
 // IncrementClicks mocks incrementing the click cound for a shortener data record
 func (m *ShortenerDataModel) IncrementClicks(shortened string) error {
 	switch shortened {
 	case "http://shorten3d":
 		return nil
 	default:
-		return errors.New("models: no matching record found")
+		return models.ErrNoRecord
 	}
 }
 
+// AddClicks mocks adding buffered clicks to shortener data records
+func (m *ShortenerDataModel) AddClicks(clicks map[string]int) error {
+	for shortened := range clicks {
+		if shortened != "http://shorten3d" {
+			return models.ErrNoRecord
+		}
+	}
+	return nil
+}
+
 // Latest mocks incrementing retrieving all shortener data records
 func (m *ShortenerDataModel) Latest() ([]*models.ShortenerData, error) {
 	return []*models.ShortenerData{mockDataModel}, nil
 }
+
+// List mocks retrieving the shortener data records which match a filter. The
+// mock record is retrieved unless the filter excludes it.
+func (m *ShortenerDataModel) List(filter models.LinkFilter) ([]*models.ShortenerData, error) {
+	if filter.Folder != "" && filter.Folder != mockDataModel.Folder {
+		return []*models.ShortenerData{}, nil
+	}
+	if query := strings.ToLower(filter.Query); query != "" {
+		found := false
+		for _, field := range []string{mockDataModel.OriginalURL, mockDataModel.ShortenedURL, mockDataModel.Title, mockDataModel.Description, mockDataModel.Notes} {
+			found = found || strings.Contains(strings.ToLower(field), query)
+		}
+		if !found {
+			return []*models.ShortenerData{}, nil
+		}
+	}
+	if filter.Tag == "" {
+		return []*models.ShortenerData{mockDataModel}, nil
+	}
+	for _, tag := range mockDataModel.Tags {
+		if tag == filter.Tag {
+			return []*models.ShortenerData{mockDataModel}, nil
+		}
+	}
+	return []*models.ShortenerData{}, nil
+}
+
+// Update mocks changing the destination of a shortener data record
+func (m *ShortenerDataModel) Update(shortened, original, actor string) error {
+	switch shortened {
+	case "http://shorten3d":
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+// Settings mocks retrieving the settings of a shortener data record
+func (m *ShortenerDataModel) Settings(shortened string) (map[string]string, error) {
+	if shortened != "http://shorten3d" {
+		return nil, models.ErrNoRecord
+	}
+	settings := map[string]string{}
+	for name, value := range m.LinkSettings {
+		settings[name] = value
+	}
+	return settings, nil
+}
+
+// UpdateSettings mocks changing the settings of a shortener data record
+func (m *ShortenerDataModel) UpdateSettings(shortened string, changes map[string]string, actor string) error {
+	if shortened != "http://shorten3d" {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// Revisions mocks retrieving the revisions of a shortener data record
+func (m *ShortenerDataModel) Revisions(shortened string) ([]*models.LinkRevision, error) {
+	switch shortened {
+	case "http://shorten3d":
+		return []*models.LinkRevision{mockRevision}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+// Revert mocks reverting a shortener data record to an earlier revision
+func (m *ShortenerDataModel) Revert(shortened string, revision int, actor string) error {
+	if shortened != "http://shorten3d" || revision != mockRevision.Revision {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// Change mocks making a set of changes to a shortener data record
+func (m *ShortenerDataModel) Change(shortened string, change models.LinkChange, actor string) error {
+	if change.Tags != nil {
+		if _, err := models.NormaliseTags(*change.Tags); err != nil {
+			return err
+		}
+	}
+	if change.Folder != nil {
+		if _, err := models.NormaliseFolder(*change.Folder); err != nil {
+			return err
+		}
+	}
+	if shortened != "http://shorten3d" {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// Stats mocks retrieving the statistics of a shortener data record
+func (m *ShortenerDataModel) Stats(shortened string) (*models.LinkStats, error) {
+	switch shortened {
+	case "http://shorten3d":
+		return &models.LinkStats{
+			OriginalURL:  mockDataModel.OriginalURL,
+			ShortenedURL: mockDataModel.ShortenedURL,
+			Clicks:       mockDataModel.Clicks,
+			Revisions:    1,
+			Created:      mockRevision.Created,
+			Updated:      mockRevision.Created,
+		}, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+// Delete mocks deleting a shortener data record
+func (m *ShortenerDataModel) Delete(shortened string) error {
+	switch shortened {
+	case "http://shorten3d":
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+// Deleted mocks reporting whether a link was deleted. deleted1 was deleted.
+func (m *ShortenerDataModel) Deleted(code string) (bool, error) {
+	return code == "deleted1", nil
+}
+
+// SetTags mocks changing the tags of a shortener data record
+func (m *ShortenerDataModel) SetTags(shortened string, tags []string) error {
+	if _, err := models.NormaliseTags(tags); err != nil {
+		return err
+	}
+	if shortened != "http://shorten3d" {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// SetFolder mocks moving a shortener data record into a folder
+func (m *ShortenerDataModel) SetFolder(shortened, folder string) error {
+	if _, err := models.NormaliseFolder(folder); err != nil {
+		return err
+	}
+	if shortened != "http://shorten3d" {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// Tags mocks retrieving the tags in use, which are the mock record's tags
+func (m *ShortenerDataModel) Tags() ([]*models.TagStats, error) {
+	tags := []*models.TagStats{}
+	for _, tag := range mockDataModel.Tags {
+		tags = append(tags, &models.TagStats{Tag: tag, Links: 1, Clicks: mockDataModel.Clicks})
+	}
+	return tags, nil
+}
+
+// Folders mocks retrieving the folders in use, which is the mock record's folder
+func (m *ShortenerDataModel) Folders() ([]string, error) {
+	return []string{mockDataModel.Folder}, nil
+}
+
+// SetDetails mocks changing the title, description, and notes of a shortener
+// data record
+func (m *ShortenerDataModel) SetDetails(shortened string, details models.LinkDetails) error {
+	if _, err := details.Normalise(); err != nil {
+		return err
+	}
+	if shortened != "http://shorten3d" {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// FillDetails mocks filling in the empty title and description of a shortener
+// data record. Any shortened URL can be filled in.
+func (m *ShortenerDataModel) FillDetails(shortened, title, description string) error {
+	if m.Filled != nil {
+		m.Filled <- models.LinkDetails{Title: title, Description: description}
+	}
+	return nil
+}
+
+// Import mocks importing shortener data records. Links to the mock record's
+// original or shortened URL are duplicates, and the mock record's code isn't
+// available to links whose shortened URL is allocated.
+func (m *ShortenerDataModel) Import(links []*models.ImportLink, actor string, dryRun bool) ([]error, error) {
+	available := func(shortened string) error {
+		if models.Code(shortened) == models.Code(mockDataModel.ShortenedURL) {
+			return models.ErrDuplicateCode
+		}
+		return nil
+	}
+
+	results := make([]error, len(links))
+	for i, link := range links {
+		switch {
+		case link.OriginalURL == mockDataModel.OriginalURL:
+			results[i] = models.ErrDuplicate
+		case link.Allocate == nil:
+			if available(link.ShortenedURL) != nil {
+				results[i] = models.ErrDuplicate
+			}
+		case !dryRun:
+			shortened, err := link.Allocate(available)
+			if err != nil {
+				return nil, err
+			}
+			link.ShortenedURL = shortened
+		}
+	}
+	return results, nil
+}
+
+// Export mocks exporting shortener data records. The mock record is exported
+// unless the filter excludes it by its number of clicks.
+func (m *ShortenerDataModel) Export(filter models.ExportFilter, fn func(*models.LinkStats) error) error {
+	if filter.MinClicks != nil && mockDataModel.Clicks < *filter.MinClicks {
+		return nil
+	}
+	if filter.MaxClicks != nil && mockDataModel.Clicks > *filter.MaxClicks {
+		return nil
+	}
+	stats, err := m.Stats(mockDataModel.ShortenedURL)
+	if err != nil {
+		return err
+	}
+	return fn(stats)
+}
+
+// RecordHealth mocks recording the health of a shortener data record's
+// destination
+func (m *ShortenerDataModel) RecordHealth(health *models.LinkHealth, threshold int) error {
+	if health.ShortenedURL != mockDataModel.ShortenedURL {
+		return models.ErrNoRecord
+	}
+	if m.Checked != nil {
+		m.Checked <- health
+	}
+	return nil
+}
+
+// Health mocks retrieving the health of a shortener data record's
+// destination
+func (m *ShortenerDataModel) Health(shortened string) (*models.LinkHealth, error) {
+	if shortened != mockDataModel.ShortenedURL || m.LinkHealth == nil {
+		return nil, models.ErrNoRecord
+	}
+	return m.LinkHealth, nil
+}
+
+// AllHealth mocks retrieving the health of every shortener data record's
+// destination
+func (m *ShortenerDataModel) AllHealth() (map[string]*models.LinkHealth, error) {
+	if m.LinkHealth == nil {
+		return map[string]*models.LinkHealth{}, nil
+	}
+	return map[string]*models.LinkHealth{mockDataModel.ShortenedURL: m.LinkHealth}, nil
+}
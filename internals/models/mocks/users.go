@@ -0,0 +1,81 @@
+package mocks
+
+import (
+	"gourlshortener/internals/models"
+	"time"
+)
+
+// MockAPIKey is the mock user's API key, which authenticates as mockKey
+const MockAPIKey = "mock-api-key"
+
+var mockKey = &models.APIKey{
+	ID:      1,
+	User:    "ops",
+	Name:    "deploys",
+	Created: time.Date(2026, time.October, 19, 14, 0, 0, 0, time.UTC),
+}
+
+// UserModel implements a mock model for testing users and their API keys.
+// It has one user, ops, with one API key, MockAPIKey.
+type UserModel struct{}
+
+// CreateUser mocks adding a user. The mock user already exists.
+func (m *UserModel) CreateUser(name string) error {
+	if name == mockKey.User {
+		return models.ErrDuplicate
+	}
+	return nil
+}
+
+// Users mocks retrieving every user
+func (m *UserModel) Users() ([]*models.User, error) {
+	return []*models.User{{Name: mockKey.User, Keys: 1, Created: mockKey.Created}}, nil
+}
+
+// DeleteUser mocks deleting a user
+func (m *UserModel) DeleteUser(name string) error {
+	if name != mockKey.User {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// CreateKey mocks creating an API key for the mock user
+func (m *UserModel) CreateKey(user, name string) (*models.APIKey, string, error) {
+	if user != mockKey.User {
+		return nil, "", models.ErrNoRecord
+	}
+	return &models.APIKey{ID: 2, User: user, Name: name, Created: mockKey.Created}, "another-mock-api-key", nil
+}
+
+// Key mocks retrieving an API key by its ID
+func (m *UserModel) Key(id int) (*models.APIKey, error) {
+	if id != mockKey.ID {
+		return nil, models.ErrNoRecord
+	}
+	return mockKey, nil
+}
+
+// Keys mocks retrieving the API keys of a user, or of every user
+func (m *UserModel) Keys(user string) ([]*models.APIKey, error) {
+	if user != "" && user != mockKey.User {
+		return []*models.APIKey{}, nil
+	}
+	return []*models.APIKey{mockKey}, nil
+}
+
+// RevokeKey mocks revoking an API key
+func (m *UserModel) RevokeKey(id int) error {
+	if id != mockKey.ID {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// Authenticate mocks retrieving the API key which matches key
+func (m *UserModel) Authenticate(key string) (*models.APIKey, error) {
+	if key != MockAPIKey {
+		return nil, models.ErrNoRecord
+	}
+	return mockKey, nil
+}
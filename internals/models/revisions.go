@@ -0,0 +1,240 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// SystemActor identifies changes that weren't made by a user or API key, such
+// as the initial revision recorded when a link is first created.
+const SystemActor = "system"
+
+// SettingAlwaysPreview is the name of the setting which, if "true", shows a
+// link's preview page instead of redirecting straight to its destination
+const SettingAlwaysPreview = "always_preview"
+
+// The names of the settings which override the title, description, and image
+// of a link's social card, which is shown to chat apps' and social networks'
+// crawlers
+const (
+	SettingOGTitle       = "og_title"
+	SettingOGDescription = "og_description"
+	SettingOGImage       = "og_image"
+)
+
+// LinkRevision stores a snapshot of a shortened URL's destination and
+// settings, along with who changed it and when
+type LinkRevision struct {
+	Revision                  int
+	ShortenedURL, OriginalURL string
+	Settings                  map[string]string
+	Actor                     string
+	Created                   time.Time
+}
+
+// Update changes the destination of a shortened URL, recording the change as
+// a new revision attributed to the supplied actor
+func (m *ShortenerDataModel) Update(shortened, original, actor string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	settings, err := currentSettings(tx, shortened)
+	if err != nil {
+		return err
+	}
+
+	if err = updateDestination(tx, shortened, original); err != nil {
+		return err
+	}
+
+	if err = insertRevision(tx, shortened, original, settings, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Settings retrieves the current settings of a shortened URL, which are those
+// recorded in its latest revision
+func (m *ShortenerDataModel) Settings(shortened string) (map[string]string, error) {
+	row := m.queryRow(func(s *statements) *sql.Stmt { return s.settings }, settingsStmt, shortened)
+	return scanSettings(row)
+}
+
+// UpdateSettings changes the settings of a shortened URL, recording the change
+// as a new revision attributed to the supplied actor. Settings which aren't in
+// changes are kept, and settings set to an empty string are removed.
+func (m *ShortenerDataModel) UpdateSettings(shortened string, changes map[string]string, actor string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var original string
+	err = tx.QueryRow(`SELECT original_url FROM urls WHERE shortened_url = ?`, shortened).Scan(&original)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	settings, err := currentSettings(tx, shortened)
+	if err != nil {
+		return err
+	}
+	for name, value := range changes {
+		if value == "" {
+			delete(settings, name)
+			continue
+		}
+		settings[name] = value
+	}
+
+	if err = insertRevision(tx, shortened, original, settings, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Revisions retrieves all of the revisions of a shortened URL, newest first
+func (m *ShortenerDataModel) Revisions(shortened string) ([]*LinkRevision, error) {
+	stmt := `SELECT revision, shortened_url, original_url, settings, actor, created
+FROM link_revisions
+WHERE shortened_url = ?
+ORDER BY revision DESC`
+	rows, err := m.reader().Query(stmt, shortened)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*LinkRevision{}
+	for rows.Next() {
+		revision := &LinkRevision{}
+		var settings string
+		err := rows.Scan(&revision.Revision, &revision.ShortenedURL, &revision.OriginalURL, &settings, &revision.Actor, &revision.Created)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(settings), &revision.Settings); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, ErrNoRecord
+	}
+	return revisions, nil
+}
+
+// Revert restores a shortened URL's destination and settings to those of an
+// earlier revision. The revert is itself recorded as a new revision, so that
+// it can be undone too.
+func (m *ShortenerDataModel) Revert(shortened string, revision int, actor string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT original_url, settings FROM link_revisions WHERE shortened_url = ? AND revision = ?`
+	var original, encoded string
+	err = tx.QueryRow(stmt, shortened, revision).Scan(&original, &encoded)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	settings := map[string]string{}
+	if err = json.Unmarshal([]byte(encoded), &settings); err != nil {
+		return err
+	}
+
+	if err = updateDestination(tx, shortened, original); err != nil {
+		return err
+	}
+
+	if err = insertRevision(tx, shortened, original, settings, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateDestination sets the original URL of a shortened URL. The updated
+// column is set explicitly, as the update trigger can't find the row once its
+// original URL has changed.
+func updateDestination(tx *sql.Tx, shortened, original string) error {
+	stmt := `UPDATE urls SET original_url = ?, updated = DATETIME('NOW') WHERE shortened_url = ?`
+	result, err := tx.Exec(stmt, original, shortened)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// currentSettings retrieves the settings recorded in a shortened URL's latest
+// revision. If the link has no revisions, an empty set of settings is returned.
+func currentSettings(tx *sql.Tx, shortened string) (map[string]string, error) {
+	return scanSettings(tx.QueryRow(settingsStmt, shortened))
+}
+
+// scanSettings scans the settings of a shortened URL's latest revision, which
+// are empty if it has none
+func scanSettings(row *sql.Row) (map[string]string, error) {
+	settings := map[string]string{}
+	var encoded string
+	err := row.Scan(&encoded)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return settings, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal([]byte(encoded), &settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// insertRevision records the next revision of a shortened URL
+func insertRevision(tx *sql.Tx, shortened, original string, settings map[string]string, actor string) error {
+	if settings == nil {
+		settings = map[string]string{}
+	}
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO link_revisions (shortened_url, revision, original_url, settings, actor)
+SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ? FROM link_revisions WHERE shortened_url = ?`
+	_, err = tx.Exec(stmt, shortened, original, string(encoded), actor, shortened)
+
+	return err
+}
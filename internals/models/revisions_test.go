@@ -0,0 +1,186 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCanUpdateUrlDestination(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	err := m.Update("https://4C2P1PC8+", "https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/410", "ops (API key 1)")
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	data, _ := m.Get("https://4C2P1PC8+")
+	if data.OriginalURL != "https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/410" {
+		t.Errorf("Destination was not updated. Got: %s", data.OriginalURL)
+	}
+
+	revisions, err := m.Revisions("https://4C2P1PC8+")
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("Incorrect number of revisions returned. Expected %d; got %d", 2, len(revisions))
+	}
+	if revisions[0].Revision != 2 || revisions[0].Actor != "ops (API key 1)" {
+		t.Errorf("Incorrect latest revision returned. Got: %+v", revisions[0])
+	}
+}
+
+func TestCannotUpdateMissingUrl(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	err := m.Update("https://missing", "https://osnews.com", SystemActor)
+	if err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+}
+
+func TestCanRevertUrlToEarlierRevision(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	original := "https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/424"
+	if err := m.Update("https://4C2P1PC8+", "https://osnews.com", SystemActor); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.Revert("https://4C2P1PC8+", 1, "anonymous@127.0.0.1")
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	data, _ := m.Get("https://4C2P1PC8+")
+	if data.OriginalURL != original {
+		t.Errorf("Destination was not reverted. Expected %s. Got: %s", original, data.OriginalURL)
+	}
+
+	revisions, _ := m.Revisions("https://4C2P1PC8+")
+	if len(revisions) != 3 || revisions[0].OriginalURL != original {
+		t.Errorf("The revert was not recorded as a new revision. Got: %+v", revisions)
+	}
+
+	if err = m.Revert("https://4C2P1PC8+", 10, SystemActor); err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+}
+
+func TestInsertRecordsFirstRevision(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	_, err := m.Insert("https://osnews.com", "https://6C2P1PC8+", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err := m.Revisions("https://6C2P1PC8+")
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if len(revisions) != 1 || revisions[0].Revision != 1 || revisions[0].Actor != SystemActor {
+		t.Errorf("Incorrect revisions returned. Got: %+v", revisions)
+	}
+}
+
+func TestCanUpdateUrlSettings(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	err := m.UpdateSettings("https://4C2P1PC8+", map[string]string{SettingAlwaysPreview: "true"}, SystemActor)
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	settings, err := m.Settings("https://4C2P1PC8+")
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if settings[SettingAlwaysPreview] != "true" {
+		t.Errorf("Setting was not updated. Got: %+v", settings)
+	}
+
+	err = m.UpdateSettings("https://4C2P1PC8+", map[string]string{SettingAlwaysPreview: ""}, SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, _ = m.Settings("https://4C2P1PC8+")
+	if _, ok := settings[SettingAlwaysPreview]; ok {
+		t.Errorf("Setting was not removed. Got: %+v", settings)
+	}
+
+	revisions, _ := m.Revisions("https://4C2P1PC8+")
+	if len(revisions) != 3 {
+		t.Errorf("Settings changes were not recorded as new revisions. Got: %+v", revisions)
+	}
+
+	if err = m.UpdateSettings("https://missing", nil, SystemActor); err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+}
+
+func TestChangeMakesEveryChangeOrNone(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	folder, tags, title := "reading", []string{"news"}, "OSnews"
+	change := LinkChange{
+		OriginalURL: "https://www.osnews.com",
+		Settings:    map[string]string{SettingAlwaysPreview: "true"},
+		Folder:      &folder,
+		Tags:        &tags,
+		Title:       &title,
+	}
+	if err := m.Change("https://4C2P1PC8+", change, "ops (API key 1)"); err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	data, _ := m.Get("https://4C2P1PC8+")
+	if data.OriginalURL != "https://www.osnews.com" || data.Folder != "reading" || len(data.Tags) != 1 || data.Title != "OSnews" {
+		t.Errorf("Link was not changed. Got: %+v", data)
+	}
+	revisions, _ := m.Revisions("https://4C2P1PC8+")
+	if len(revisions) != 2 || revisions[0].Settings[SettingAlwaysPreview] != "true" {
+		t.Errorf("Expected one revision with the new destination and settings. Got: %+v", revisions)
+	}
+
+	notes := strings.Repeat("a", MaxNotesLength+1)
+	change = LinkChange{OriginalURL: "https://go.dev", Notes: &notes}
+	if err := m.Change("https://4C2P1PC8+", change, "ops (API key 1)"); err != ErrInvalidDetails {
+		t.Errorf("Expected %s. Got: %v", ErrInvalidDetails, err)
+	}
+	data, _ = m.Get("https://4C2P1PC8+")
+	if data.OriginalURL != "https://www.osnews.com" {
+		t.Errorf("Expected the destination not to change when the notes were invalid. Got: %s", data.OriginalURL)
+	}
+	if err := m.Change("https://missing", change, SystemActor); err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+}
+
+func TestCreateInsertsTheLinkOnlyIfEveryChangeIsMade(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	folder, tags, title := "reading", []string{"go"}, "Go"
+	change := LinkChange{Folder: &folder, Tags: &tags, Title: &title}
+	if err := m.Create("https://go.dev", "https://g0dev", change, SystemActor); err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	data, err := m.Get("https://g0dev")
+	if err != nil || data.Folder != "reading" || len(data.Tags) != 1 || data.Title != "Go" {
+		t.Errorf("Link was not created with its changes. Got: %+v, %v", data, err)
+	}
+	revisions, _ := m.Revisions("https://g0dev")
+	if len(revisions) != 1 || revisions[0].Actor != SystemActor {
+		t.Errorf("Expected the link's first revision. Got: %+v", revisions)
+	}
+
+	tags = []string{"not a tag!"}
+	if err = m.Create("https://pkg.go.dev", "https://pkgdev", change, SystemActor); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("Expected %s. Got: %v", ErrInvalidTag, err)
+	}
+	if _, err = m.Get("https://pkgdev"); err != ErrNoRecord {
+		t.Errorf("Expected the link not to be created when its tags were invalid. Got: %v", err)
+	}
+}
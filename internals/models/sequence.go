@@ -0,0 +1,38 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// CodeSequence issues the sequential IDs which are obfuscated into codes by
+// the sequential code generator
+type CodeSequence struct {
+	DB *sql.DB
+}
+
+// Next returns the next ID in the sequence. IDs are never reused, even if the
+// link which used one is deleted.
+func (s *CodeSequence) Next() (uint64, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO code_sequence DEFAULT VALUES`)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec(`DELETE FROM code_sequence WHERE id < ?`, id); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return uint64(id), nil
+}
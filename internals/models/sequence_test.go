@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestInsertRejectsDuplicateCodes(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+
+	_, err := m.Insert("https://osnews.com", "http://4C2P1PC8+", 0)
+	if err != ErrDuplicateCode {
+		t.Errorf("Expected %s for a code in use with another scheme. Got: %v", ErrDuplicateCode, err)
+	}
+
+	_, err = m.Insert("https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/424", "https://6C2P1PC8", 0)
+	if err != ErrDuplicate {
+		t.Errorf("Expected %s for an original URL in use. Got: %v", ErrDuplicate, err)
+	}
+}
+
+func TestCodeSequenceIsSequential(t *testing.T) {
+	db := newTestDB(t)
+	s := CodeSequence{db}
+	for want := uint64(1); want <= 3; want++ {
+		id, err := s.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want {
+			t.Errorf("Expected ID %d. Got: %d", want, id)
+		}
+	}
+
+	var rows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM code_sequence`).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Errorf("Only the latest ID should be kept. Got %d rows", rows)
+	}
+}
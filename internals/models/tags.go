@@ -0,0 +1,202 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxTags is the maximum number of tags that a link can have
+const MaxTags = 20
+
+// MaxFolderLength is the maximum length of a folder name, in characters
+const MaxFolderLength = 64
+
+var validTag = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}][\p{Ll}\p{Lo}\p{N}_-]{0,31}$`)
+
+var validFolder = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{M}\p{N} ./_-]*$`)
+
+// TagStats stores a tag, the number of links with the tag, and the total
+// number of times that those links were clicked
+type TagStats struct {
+	Tag           string
+	Links, Clicks int
+}
+
+// NormaliseTags trims and lower-cases tags, removing empty and duplicate
+// tags, and sorts them. It returns ErrInvalidTag if any tag is invalid, or if
+// there are more than MaxTags.
+func NormaliseTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalised := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !validTag.MatchString(tag) {
+			return nil, ErrInvalidTag
+		}
+		seen[tag] = true
+		normalised = append(normalised, tag)
+	}
+	if len(normalised) > MaxTags {
+		return nil, ErrInvalidTag
+	}
+	sort.Strings(normalised)
+
+	return normalised, nil
+}
+
+// ParseTags splits a comma-separated list of tags, and normalises them
+func ParseTags(tags string) ([]string, error) {
+	return NormaliseTags(strings.Split(tags, ","))
+}
+
+// NormaliseFolder trims a folder name. It returns ErrInvalidFolder if the
+// name is longer than MaxFolderLength, or contains characters other than
+// letters, digits, spaces, and . / _ -
+func NormaliseFolder(folder string) (string, error) {
+	folder = strings.TrimSpace(folder)
+	if folder == "" {
+		return "", nil
+	}
+	if utf8.RuneCountInString(folder) > MaxFolderLength || !validFolder.MatchString(folder) {
+		return "", ErrInvalidFolder
+	}
+	return folder, nil
+}
+
+// splitTags splits the comma-separated tags retrieved with linkColumns
+func splitTags(tags string) []string {
+	if tags == "" {
+		return []string{}
+	}
+	split := strings.Split(tags, ",")
+	sort.Strings(split)
+	return split
+}
+
+// SetTags replaces the tags of a shortened URL. The tags are normalised with
+// NormaliseTags.
+func (m *ShortenerDataModel) SetTags(shortened string, tags []string) error {
+	tags, err := NormaliseTags(tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(`SELECT 1 FROM urls WHERE shortened_url = ?`, shortened).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if err = replaceTags(tx, shortened, tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceTags replaces the tags of a shortened URL with tags, which must
+// already be normalised
+func replaceTags(tx *sql.Tx, shortened string, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM link_tags WHERE shortened_url = ?`, shortened); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err := tx.Exec(`INSERT INTO link_tags (shortened_url, tag) VALUES (?, ?)`, shortened, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetFolder moves a shortened URL into a folder, or out of any folder if the
+// folder is empty. The folder is normalised with NormaliseFolder.
+func (m *ShortenerDataModel) SetFolder(shortened, folder string) error {
+	folder, err := NormaliseFolder(folder)
+	if err != nil {
+		return err
+	}
+
+	result, err := m.DB.Exec(`UPDATE urls SET folder = ? WHERE shortened_url = ?`, folder, shortened)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Tags retrieves every tag in use, along with the number of links with the
+// tag and their total clicks, ordered by tag
+func (m *ShortenerDataModel) Tags() ([]*TagStats, error) {
+	stmt := `SELECT link_tags.tag, COUNT(*), COALESCE(SUM(urls.clicks), 0)
+FROM link_tags
+JOIN urls ON urls.shortened_url = link_tags.shortened_url
+GROUP BY link_tags.tag
+ORDER BY link_tags.tag ASC`
+	rows, err := m.reader().Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*TagStats{}
+	for rows.Next() {
+		tag := &TagStats{}
+		if err := rows.Scan(&tag.Tag, &tag.Links, &tag.Clicks); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// Folders retrieves every folder in use, ordered by name
+func (m *ShortenerDataModel) Folders() ([]string, error) {
+	rows, err := m.reader().Query(`SELECT DISTINCT folder FROM urls WHERE folder != '' ORDER BY folder ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []string{}
+	for rows.Next() {
+		var folder string
+		if err := rows.Scan(&folder); err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormaliseTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{"trims, lower-cases and sorts", []string{" Tech", "news "}, []string{"news", "tech"}, false},
+		{"removes empty and duplicate tags", []string{"news", "", "NEWS"}, []string{"news"}, false},
+		{"allows hyphens and underscores", []string{"web-dev", "go_lang"}, []string{"go_lang", "web-dev"}, false},
+		{"rejects spaces", []string{"web dev"}, nil, true},
+		{"rejects commas", []string{"a,b"}, nil, true},
+		{"rejects long tags", []string{"abcdefghijklmnopqrstuvwxyz0123456789"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormaliseTags(tt.tags)
+			if tt.wantErr {
+				if err != ErrInvalidTag {
+					t.Errorf("Expected %s. Got: %v", ErrInvalidTag, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v. Got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCanTagUrlsAndFilterByTag(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	if _, err := m.Insert("https://osnews.com", "https://6C2P1PC8+", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.SetTags("https://4C2P1PC8+", []string{"MDN", "http"}); err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if err := m.SetTags("https://6C2P1PC8+", []string{"news", "http"}); err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	data, _ := m.Get("https://4C2P1PC8+")
+	if !reflect.DeepEqual(data.Tags, []string{"http", "mdn"}) {
+		t.Errorf("Tags were not set. Got: %v", data.Tags)
+	}
+
+	rows, err := m.List(LinkFilter{Tag: "news"})
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if len(rows) != 1 || rows[0].ShortenedURL != "https://6C2P1PC8+" {
+		t.Errorf("Incorrect URLs returned for the tag. Got: %+v", rows)
+	}
+
+	tags, err := m.Tags()
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+	expected := []*TagStats{
+		{Tag: "http", Links: 2, Clicks: 10},
+		{Tag: "mdn", Links: 1, Clicks: 0},
+		{Tag: "news", Links: 1, Clicks: 10},
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Incorrect tag totals returned. Expected %+v. Got: %+v", expected, tags)
+	}
+
+	if err = m.Delete("https://6C2P1PC8+"); err != nil {
+		t.Fatal(err)
+	}
+	tags, _ = m.Tags()
+	if len(tags) != 2 {
+		t.Errorf("The deleted URL's tags were not removed. Got: %+v", tags)
+	}
+
+	if err = m.SetTags("https://missing", []string{"news"}); err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+}
+
+func TestCanMoveUrlIntoFolder(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	if err := m.SetFolder("https://4C2P1PC8+", " Reference "); err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	rows, err := m.List(LinkFilter{Folder: "Reference"})
+	if err != nil {
+		t.Errorf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if len(rows) != 1 || rows[0].Folder != "Reference" {
+		t.Errorf("Incorrect URLs returned for the folder. Got: %+v", rows)
+	}
+
+	folders, _ := m.Folders()
+	if !reflect.DeepEqual(folders, []string{"Reference"}) {
+		t.Errorf("Incorrect folders returned. Got: %v", folders)
+	}
+
+	for _, folder := range []string{"bad\nfolder", `<script>alert("folder")</script>`, `"quoted"`, "/leading"} {
+		if err = m.SetFolder("https://4C2P1PC8+", folder); err != ErrInvalidFolder {
+			t.Errorf("%q: expected %s. Got: %v", folder, ErrInvalidFolder, err)
+		}
+	}
+	if err = m.SetFolder("https://missing", ""); err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+}
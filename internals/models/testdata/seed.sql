@@ -0,0 +1,14 @@
+INSERT INTO urls (original_url, shortened_url, clicks)
+VALUES (
+        'https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/424',
+        'https://4C2P1PC8+',
+        0
+    );
+
+INSERT INTO link_revisions (shortened_url, revision, original_url, actor)
+VALUES (
+        'https://4C2P1PC8+',
+        1,
+        'https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/424',
+        'system'
+    );
@@ -1 +0,0 @@
-DROP TABLE urls;
\ No newline at end of file
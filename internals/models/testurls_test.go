@@ -1,40 +1,49 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"gourlshortener/db"
+	"gourlshortener/internals/migrate"
 	"os"
+	"path/filepath"
 	"testing"
 
 	_ "modernc.org/sqlite"
 )
 
-func newTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("sqlite", "./testdata/testdb.sqlite")
+// newTestDB creates a temporary database, migrated with the embedded
+// migrations and loaded with the data in testdata/seed.sql
+func newTestDB(t testing.TB) *sql.DB {
+	conn, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "testdb.sqlite"))
 	if err != nil {
 		t.Fatal(err)
 	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	seedTestDB(t, conn)
+	return conn
+}
 
-	script, err := os.ReadFile("./testdata/setup.sql")
+// seedTestDB migrates the database with the embedded migrations, and loads
+// the data in testdata/seed.sql into it
+func seedTestDB(t testing.TB, conn *sql.DB) {
+	migrator, err := migrate.New(conn, db.Migrations)
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = db.Exec(string(script))
-	if err != nil {
+	if _, err = migrator.Up(context.Background()); err != nil {
 		t.Fatal(err)
 	}
 
-	t.Cleanup(func() {
-        script, err := os.ReadFile("./testdata/teardown.sql")
-        if err != nil {
-            t.Fatal(err)
-        }
-        _, err = db.Exec(string(script))
-        if err != nil {
-            t.Fatal(err)
-        }
-
-        db.Close()
-    })
-
-    return db
+	script, err := os.ReadFile("./testdata/seed.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(string(script))
+	if err != nil {
+		t.Fatal(err)
+	}
 }
@@ -3,69 +3,370 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
 )
 
-// ShortenerDataInterface provides an interface for objects that interact with shortener data.
-//
-// Specifically, it provides methods for retrieving one, retrieving all,
-// incrementing a click count, and adding one.
+// ShortenerDataInterface provides an interface for objects that interact with
+// shortener data: links, their revisions, and their health.
 type ShortenerDataInterface interface {
+	LinkDataInterface
+	RevisionDataInterface
+	HealthDataInterface
+}
+
+// LinkDataInterface retrieves, adds, organises, and deletes links, and
+// imports and exports many at once
+type LinkDataInterface interface {
 	Get(shortened string) (*ShortenerData, error)
+	GetByCode(code string) (*ShortenerData, error)
 	IncrementClicks(shortened string) error
+	AddClicks(clicks map[string]int) error
 	Insert(original string, shortened string, clicks int) (int, error)
+	Create(original, shortened string, change LinkChange, actor string) error
 	Latest() ([]*ShortenerData, error)
+	List(filter LinkFilter) ([]*ShortenerData, error)
+	Settings(shortened string) (map[string]string, error)
+	Stats(shortened string) (*LinkStats, error)
+	Delete(shortened string) error
+	Deleted(code string) (bool, error)
+	SetTags(shortened string, tags []string) error
+	SetFolder(shortened, folder string) error
+	Tags() ([]*TagStats, error)
+	Folders() ([]string, error)
+	SetDetails(shortened string, details LinkDetails) error
+	FillDetails(shortened, title, description string) error
+	Import(links []*ImportLink, actor string, dryRun bool) ([]error, error)
+	Export(filter ExportFilter, fn func(*LinkStats) error) error
+}
+
+// RevisionDataInterface changes links' destinations and settings, recording
+// each change as a revision, and retrieves and reverts to those revisions
+type RevisionDataInterface interface {
+	Update(shortened, original, actor string) error
+	UpdateSettings(shortened string, changes map[string]string, actor string) error
+	Change(shortened string, change LinkChange, actor string) error
+	Revisions(shortened string) ([]*LinkRevision, error)
+	Revert(shortened string, revision int, actor string) error
 }
 
-// ShortenerData stores an original URL, shortened URL, and the number of times
-// the shortened URL was clicked
+// HealthDataInterface records and retrieves the health of links'
+// destinations
+type HealthDataInterface interface {
+	RecordHealth(health *LinkHealth, threshold int) error
+	Health(shortened string) (*LinkHealth, error)
+	AllHealth() (map[string]*LinkHealth, error)
+}
+
+// ShortenerData stores an original URL, shortened URL, the number of times
+// the shortened URL was clicked, the folder and tags that it's organised by,
+// and its title, description, and notes
 type ShortenerData struct {
 	OriginalURL, ShortenedURL string
 	Clicks                    int
+	Folder                    string
+	Tags                      []string
+	LinkDetails
+}
+
+// likeEscaper escapes the wildcards in a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// linkColumns are the columns of the urls table that are scanned into
+// ShortenerData by scanLink, along with the link's comma-separated tags
+const linkColumns = `original_url, shortened_url, clicks, folder, title, description, notes,
+    (SELECT GROUP_CONCAT(tag, ',') FROM link_tags WHERE link_tags.shortened_url = urls.shortened_url)`
+
+// scanLink scans a row of linkColumns into ShortenerData
+func scanLink(row interface{ Scan(...any) error }) (*ShortenerData, error) {
+	data := &ShortenerData{}
+	var tags sql.NullString
+	err := row.Scan(&data.OriginalURL, &data.ShortenedURL, &data.Clicks, &data.Folder,
+		&data.Title, &data.Description, &data.Notes, &tags)
+	if err != nil {
+		return nil, err
+	}
+	data.Tags = splitTags(tags.String)
+
+	return data, nil
+}
+
+// Code returns the code of a shortened URL, which is the shortened URL
+// without its scheme
+func Code(shortened string) string {
+	if _, code, found := strings.Cut(shortened, "://"); found {
+		return code
+	}
+	return shortened
+}
+
+// LinkStats stores the statistics of a shortened URL: the number of times it
+// was clicked, the number of revisions of its destination, and when it was
+// created and last updated
+type LinkStats struct {
+	OriginalURL, ShortenedURL string
+	Clicks, Revisions         int
+	Created, Updated          time.Time
+}
+
+// LinkFilter filters the links retrieved by List. Empty fields don't filter.
+//
+// Query matches links whose original or shortened URL, title, description,
+// or notes contain it, ignoring case.
+type LinkFilter struct {
+	Tag, Folder, Query string
 }
 
 // ShortenerDataModel manages database interaction for the URL shortener data
+//
+// Writes are run on DB, and reads on Reader, if it's set, so that a single
+// writer connection can be shared with a pool of readers. Models created by
+// NewShortenerDataModel prepare the statements run on every redirect once,
+// rather than each time they're run.
 type ShortenerDataModel struct {
-	DB *sql.DB
+	DB, Reader *sql.DB
+	statements *statements
+}
+
+// statements are the prepared statements run on every redirect
+type statements struct {
+	get, getByCode, settings, incrementClicks *sql.Stmt
 }
 
-// Insert inserts a new record into the urls table
+// The statements run on every redirect
+const (
+	getStmt             = `SELECT ` + linkColumns + ` FROM urls WHERE shortened_url = ?`
+	getByCodeStmt       = `SELECT ` + linkColumns + ` FROM urls WHERE shortened_url IN (?, ?) LIMIT 1`
+	settingsStmt        = `SELECT settings FROM link_revisions WHERE shortened_url = ? ORDER BY revision DESC LIMIT 1`
+	incrementClicksStmt = `UPDATE urls SET clicks = clicks + 1 WHERE shortened_url = ?`
+)
+
+// NewShortenerDataModel creates a model which writes to db, and reads from
+// reader, preparing the statements run on every redirect. The reader can be
+// nil, to read from db.
+func NewShortenerDataModel(db, reader *sql.DB) (*ShortenerDataModel, error) {
+	m := &ShortenerDataModel{DB: db, Reader: reader}
+	prepared := &statements{}
+	for _, stmt := range []struct {
+		db    *sql.DB
+		query string
+		stmt  **sql.Stmt
+	}{
+		{m.reader(), getStmt, &prepared.get},
+		{m.reader(), getByCodeStmt, &prepared.getByCode},
+		{m.reader(), settingsStmt, &prepared.settings},
+		{m.DB, incrementClicksStmt, &prepared.incrementClicks},
+	} {
+		var err error
+		if *stmt.stmt, err = stmt.db.Prepare(stmt.query); err != nil {
+			m.statements = prepared
+			m.Close()
+			return nil, err
+		}
+	}
+	m.statements = prepared
+
+	return m, nil
+}
+
+// Close closes the model's prepared statements, if it has any. It doesn't
+// close the database.
+func (m *ShortenerDataModel) Close() error {
+	if m.statements == nil {
+		return nil
+	}
+	var firstErr error
+	for _, stmt := range []*sql.Stmt{m.statements.get, m.statements.getByCode, m.statements.settings, m.statements.incrementClicks} {
+		if stmt == nil {
+			continue
+		}
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	m.statements = nil
+	return firstErr
+}
+
+// reader returns the database which reads are run on
+func (m *ShortenerDataModel) reader() *sql.DB {
+	if m.Reader == nil {
+		return m.DB
+	}
+	return m.Reader
+}
+
+// queryRow runs a read query which returns a single row, with its prepared
+// statement, if the model has one
+func (m *ShortenerDataModel) queryRow(prepared func(*statements) *sql.Stmt, query string, args ...any) *sql.Row {
+	if m.statements != nil {
+		return prepared(m.statements).QueryRow(args...)
+	}
+	return m.reader().QueryRow(query, args...)
+}
+
+// Insert inserts a new record into the urls table, and records it as the
+// shortened URL's first revision. It returns ErrDuplicateCode if the shortened
+// URL's code is in use, and ErrDuplicate if the original URL is.
 func (m *ShortenerDataModel) Insert(original string, shortened string, clicks int) (int, error) {
-	stmt := `INSERT INTO urls  (original_url, shortened_url, clicks) VALUES(?, ?, ?)`
-	result, err := m.DB.Exec(stmt, original, shortened, clicks)
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
+
+	rowsAffected, err := insertLink(tx, original, shortened, clicks)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
+
+// insertLink inserts a new record into the urls table in tx, and records it
+// as the shortened URL's first revision
+func insertLink(tx *sql.Tx, original, shortened string, clicks int) (int, error) {
+	stmt := `INSERT INTO urls  (original_url, shortened_url, clicks) VALUES(?, ?, ?)`
+	result, err := tx.Exec(stmt, original, shortened, clicks)
+	if err != nil {
+		return 0, uniqueError(err)
+	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return 0, err
 	}
 
+	if err = insertRevision(tx, shortened, original, nil, SystemActor); err != nil {
+		return 0, err
+	}
+
 	return int(rowsAffected), nil
 }
 
+// uniqueError converts a unique constraint violation on the urls table into
+// ErrDuplicateCode or ErrDuplicate, depending on the column which is
+// duplicated, and returns all other errors as they are
+func uniqueError(err error) error {
+	message := err.Error()
+	switch {
+	case !strings.Contains(message, "UNIQUE constraint failed"):
+		return err
+	case strings.Contains(message, "uniq_urls_code"):
+		return ErrDuplicateCode
+	case strings.Contains(message, "urls.original_url"):
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
+
 // Get retrieves a record from the urls table identifying that record by the shortened URL
 func (m *ShortenerDataModel) Get(shortened string) (*ShortenerData, error) {
-	stmt := `SELECT original_url, shortened_url, clicks FROM urls WHERE shortened_url = ?`
-	row := m.DB.QueryRow(stmt, shortened)
-	data := &ShortenerData{}
-	err := row.Scan(&data.OriginalURL, &data.ShortenedURL, &data.Clicks)
+	row := m.queryRow(func(s *statements) *sql.Stmt { return s.get }, getStmt, shortened)
+	data, err := scanLink(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			var ErrNoRecord = errors.New("models: no matching record found")
 			return nil, ErrNoRecord
-		} 
-	
+		}
+
 		return nil, err
 	}
 
 	return data, nil
 }
 
+// GetByCode retrieves a record from the urls table identifying that record by
+// the code of its shortened URL, whichever scheme the shortened URL has
+func (m *ShortenerDataModel) GetByCode(code string) (*ShortenerData, error) {
+	row := m.queryRow(func(s *statements) *sql.Stmt { return s.getByCode }, getByCodeStmt, "https://"+code, "http://"+code)
+	data, err := scanLink(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Stats retrieves the statistics of a record in the urls table identifying
+// that record by the shortened URL
+func (m *ShortenerDataModel) Stats(shortened string) (*LinkStats, error) {
+	stmt := `SELECT original_url, shortened_url, clicks, created, updated,
+    (SELECT COUNT(*) FROM link_revisions WHERE link_revisions.shortened_url = urls.shortened_url)
+FROM urls
+WHERE shortened_url = ?`
+	row := m.reader().QueryRow(stmt, shortened)
+	stats := &LinkStats{}
+	err := row.Scan(&stats.OriginalURL, &stats.ShortenedURL, &stats.Clicks, &stats.Created, &stats.Updated, &stats.Revisions)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Delete deletes a record from the urls table identifying that record by the
+// shortened URL, along with its revisions, tags, and health. Its code is
+// remembered, so that it can be reported as deleted.
+func (m *ShortenerDataModel) Delete(shortened string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM urls WHERE shortened_url = ?`, shortened)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	// The link's tags and health are deleted by triggers
+	if _, err = tx.Exec(`DELETE FROM link_revisions WHERE shortened_url = ?`, shortened); err != nil {
+		return err
+	}
+	stmt := `INSERT INTO deleted_links (code) VALUES (?)
+ON CONFLICT (code) DO UPDATE SET deleted = CURRENT_TIMESTAMP`
+	if _, err = tx.Exec(stmt, Code(shortened)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Deleted reports whether a link with the supplied code was deleted
+func (m *ShortenerDataModel) Deleted(code string) (bool, error) {
+	var deleted bool
+	err := m.reader().QueryRow(`SELECT EXISTS (SELECT 1 FROM deleted_links WHERE code = ?)`, code).Scan(&deleted)
+	return deleted, err
+}
+
 // IncrementClicks increments the number of clicks for a shortened URL by one
 func (m *ShortenerDataModel) IncrementClicks(shortened string) error {
-	stmt := `UPDATE urls SET clicks = clicks + 1 WHERE shortened_url = ?`
-	_, err := m.DB.Exec(stmt, shortened)
+	var err error
+	if m.statements != nil {
+		_, err = m.statements.incrementClicks.Exec(shortened)
+	} else {
+		_, err = m.DB.Exec(incrementClicksStmt, shortened)
+	}
 	if err != nil {
 		return err
 	}
@@ -73,10 +374,56 @@ func (m *ShortenerDataModel) IncrementClicks(shortened string) error {
 	return nil
 }
 
+// AddClicks adds clicks, keyed by shortened URL, to their links' click counts
+// in one transaction, e.g., to record clicks which were buffered while the
+// database couldn't be written to
+func (m *ShortenerDataModel) AddClicks(clicks map[string]int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE urls SET clicks = clicks + ? WHERE shortened_url = ?`
+	for shortened, count := range clicks {
+		if _, err = tx.Exec(stmt, count, shortened); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 // Latest retrieves all of the records from the urls table in the database
 func (m *ShortenerDataModel) Latest() ([]*ShortenerData, error) {
-	stmt := `SELECT original_url, shortened_url, clicks FROM urls ORDER BY created DESC, original_url ASC`
-	rows, err := m.DB.Query(stmt)
+	return m.List(LinkFilter{})
+}
+
+// List retrieves the records from the urls table which match the filter,
+// newest first
+func (m *ShortenerDataModel) List(filter LinkFilter) ([]*ShortenerData, error) {
+	stmt := `SELECT ` + linkColumns + ` FROM urls`
+	var where []string
+	var args []any
+	if filter.Tag != "" {
+		where = append(where, `shortened_url IN (SELECT shortened_url FROM link_tags WHERE tag = ?)`)
+		args = append(args, strings.ToLower(strings.TrimSpace(filter.Tag)))
+	}
+	if filter.Folder != "" {
+		where = append(where, `folder = ?`)
+		args = append(args, strings.TrimSpace(filter.Folder))
+	}
+	if query := strings.TrimSpace(filter.Query); query != "" {
+		where = append(where, `(original_url LIKE ? ESCAPE '\' OR shortened_url LIKE ? ESCAPE '\'
+    OR title LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\' OR notes LIKE ? ESCAPE '\')`)
+		pattern := "%" + likeEscaper.Replace(query) + "%"
+		args = append(args, pattern, pattern, pattern, pattern, pattern)
+	}
+	if len(where) > 0 {
+		stmt += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	stmt += ` ORDER BY created DESC, original_url ASC`
+
+	rows, err := m.reader().Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -84,8 +431,7 @@ func (m *ShortenerDataModel) Latest() ([]*ShortenerData, error) {
 
 	urls := []*ShortenerData{}
 	for rows.Next() {
-		url := &ShortenerData{}
-		err := rows.Scan(&url.OriginalURL, &url.ShortenedURL, &url.Clicks)
+		url, err := scanLink(rows)
 		if err != nil {
 			return nil, err
 		}
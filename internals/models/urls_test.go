@@ -1,19 +1,28 @@
 package models
 
 import (
+	"database/sql"
+	"errors"
+	"gourlshortener/internals/database"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestUrlExists(t *testing.T) {
 	db := newTestDB(t)
-	m := ShortenerDataModel{db}
+	m := ShortenerDataModel{DB: db}
 	expected := ShortenerData{
 		OriginalURL:  "https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/424",
 		ShortenedURL: "https://4C2P1PC8+",
 		Clicks:       0,
+		Tags:         []string{},
 	}
 	data, err := m.Get("https://4C2P1PC8+")
-	if *data != expected {
+	if !reflect.DeepEqual(*data, expected) {
 		t.Errorf("Expected %+v. Got: %+v", expected, data)
 	}
 	if err != nil {
@@ -23,7 +32,7 @@ func TestUrlExists(t *testing.T) {
 
 func TestCanInsertUrls(t *testing.T) {
 	db := newTestDB(t)
-	m := ShortenerDataModel{db}
+	m := ShortenerDataModel{DB: db}
 	testData := ShortenerData{
 		OriginalURL:  "https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/404",
 		ShortenedURL: "https://6C2P1PC8+",
@@ -45,11 +54,12 @@ func TestCanInsertUrls(t *testing.T) {
 
 func TestCanRetrieveAllUrls(t *testing.T) {
 	db := newTestDB(t)
-	m := ShortenerDataModel{db}
+	m := ShortenerDataModel{DB: db}
 	testData := ShortenerData{
 		OriginalURL:  "https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/424",
 		ShortenedURL: "https://4C2P1PC8+",
 		Clicks:       0,
+		Tags:         []string{},
 	}
 	rows, err := m.Latest()
 	if err != nil {
@@ -58,14 +68,14 @@ func TestCanRetrieveAllUrls(t *testing.T) {
 	if len(rows) != 1 {
 		t.Errorf("Incorrect number of rows returned. Expected %d; got %d", 1, len(rows))
 	}
-	if *rows[0] != testData {
+	if !reflect.DeepEqual(*rows[0], testData) {
 		t.Errorf("Incorrect URL data returned. Expected %+v, got %+v", testData, *rows[0])
 	}
 }
 
 func TestCanIncrementUrlClicks(t *testing.T) {
 	db := newTestDB(t)
-	m := ShortenerDataModel{db}
+	m := ShortenerDataModel{DB: db}
 	testData := ShortenerData{
 		OriginalURL:  "https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/424",
 		ShortenedURL: "https://4C2P1PC8+",
@@ -80,3 +90,315 @@ func TestCanIncrementUrlClicks(t *testing.T) {
 		t.Errorf("Incorrect number of URL clicks returned. Expected %d. Got: %d", 1, data.Clicks)
 	}
 }
+
+func TestCanAddBufferedClicks(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	if err := m.AddClicks(map[string]int{"https://4C2P1PC8+": 5, "https://missing": 2}); err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	data, _ := m.Get("https://4C2P1PC8+")
+	if data.Clicks != 5 {
+		t.Errorf("Incorrect number of URL clicks returned. Expected %d. Got: %d", 5, data.Clicks)
+	}
+}
+
+func TestCanGetUrlByCode(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	data, err := m.GetByCode("4C2P1PC8+")
+	if err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if data.ShortenedURL != "https://4C2P1PC8+" {
+		t.Errorf("Incorrect URL returned. Got: %s", data.ShortenedURL)
+	}
+
+	if _, err = m.GetByCode("missing"); err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+}
+
+func TestCanGetUrlStats(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	stats, err := m.Stats("https://4C2P1PC8+")
+	if err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if stats.Revisions != 1 {
+		t.Errorf("Incorrect number of revisions returned. Expected %d; got %d", 1, stats.Revisions)
+	}
+	if stats.Created.IsZero() {
+		t.Errorf("Expected the created date to be set")
+	}
+}
+
+func TestCanDeleteUrl(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	if err := m.Delete("https://4C2P1PC8+"); err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if _, err := m.Get("https://4C2P1PC8+"); err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+	if err := m.Delete("https://4C2P1PC8+"); err != ErrNoRecord {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+	if _, err := m.Revisions("https://4C2P1PC8+"); err != ErrNoRecord {
+		t.Errorf("Expected the revisions to be deleted. Got: %v", err)
+	}
+	if deleted, err := m.Deleted("4C2P1PC8+"); err != nil || !deleted {
+		t.Errorf("Expected the code to be remembered as deleted. Got: %t (%v)", deleted, err)
+	}
+	if deleted, err := m.Deleted("5C2P1PC8+"); err != nil || deleted {
+		t.Errorf("Expected the code not to be deleted. Got: %t (%v)", deleted, err)
+	}
+}
+
+func TestCanImportUrls(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	links := []*ImportLink{
+		{OriginalURL: "https://osnews.com", ShortenedURL: "https://osn", Clicks: 12, Created: time.Date(2024, 2, 21, 0, 0, 0, 0, time.UTC)},
+		{OriginalURL: "https://osnews.com", ShortenedURL: "https://other"},
+		{OriginalURL: "https://go.dev", ShortenedURL: "http://4C2P1PC8+"},
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		results, err := m.Import(links, "cli:test", dryRun)
+		if err != nil {
+			t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+		}
+		if results[0] != nil || results[1] != ErrDuplicate || results[2] != ErrDuplicate {
+			t.Errorf("Incorrect results returned (dry run: %t). Got: %v", dryRun, results)
+		}
+
+		_, err = m.Get("https://osn")
+		if dryRun && err != ErrNoRecord {
+			t.Errorf("Expected nothing to be stored in a dry run. Got: %v", err)
+		}
+	}
+
+	stats, err := m.Stats("https://osn")
+	if err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if stats.Clicks != 12 || stats.Revisions != 1 || stats.Created.Year() != 2024 {
+		t.Errorf("Incorrect link imported. Got: %+v", stats)
+	}
+}
+
+func TestImportRetriesAllocatedCodesWhichAreInUse(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	var tried []string
+	allocate := func(available func(shortened string) error) (string, error) {
+		for _, shortened := range []string{"https://4C2P1PC8+", "https://osn", "https://fresh"} {
+			tried = append(tried, shortened)
+			if err := available(shortened); err != ErrDuplicateCode {
+				return shortened, err
+			}
+		}
+		return "", ErrDuplicateCode
+	}
+	links := []*ImportLink{
+		{OriginalURL: "https://osnews.com", ShortenedURL: "https://osn"},
+		{OriginalURL: "https://go.dev", Allocate: allocate},
+	}
+
+	results, err := m.Import(links, "cli:test", true)
+	if err != nil || results[0] != nil || results[1] != nil {
+		t.Fatalf("Incorrect results returned. Got: %v (%v)", results, err)
+	}
+	if len(tried) != 0 {
+		t.Errorf("Expected no codes to be allocated in a dry run. Got: %v", tried)
+	}
+
+	results, err = m.Import(links, "cli:test", false)
+	if err != nil || results[0] != nil || results[1] != nil {
+		t.Fatalf("Incorrect results returned. Got: %v (%v)", results, err)
+	}
+	if links[1].ShortenedURL != "https://fresh" || len(tried) != 3 {
+		t.Errorf("Expected the codes in use to be retried. Got: %s after %v", links[1].ShortenedURL, tried)
+	}
+	if _, err = m.Get("https://fresh"); err != nil {
+		t.Errorf("Expected the link to be stored. Got: %v", err)
+	}
+}
+
+func TestCanExportUrls(t *testing.T) {
+	db := newTestDB(t)
+	m := ShortenerDataModel{DB: db}
+	_, err := m.Import([]*ImportLink{
+		{OriginalURL: "https://osnews.com", ShortenedURL: "https://osn", Clicks: 12, Created: time.Date(2024, 2, 21, 0, 0, 0, 0, time.UTC)},
+		{OriginalURL: "https://go.dev", ShortenedURL: "https://go", Clicks: 3, Created: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}, SystemActor, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	minClicks := 1
+	tests := []struct {
+		name   string
+		filter ExportFilter
+		want   []string
+	}{
+		{"everything", ExportFilter{}, []string{"https://osn", "https://go", "https://4C2P1PC8+"}},
+		{"created range", ExportFilter{CreatedFrom: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), CreatedTo: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}, []string{"https://osn"}},
+		{"clicks", ExportFilter{MinClicks: &minClicks}, []string{"https://osn", "https://go"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := m.Export(tt.filter, func(stats *LinkStats) error {
+			got = append(got, stats.ShortenedURL)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: Did not expect an error to be returned. Got: %s", tt.name, err)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: Incorrect links exported. Expected %v; got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// newTunedTestDB creates a temporary database, like newTestDB, opened as a
+// writer connection and a pool of readers
+func newTunedTestDB(t testing.TB) *database.DB {
+	db, err := database.Open(filepath.Join(t.TempDir(), "testdb.sqlite"), database.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	seedTestDB(t, db.Writer)
+	return db
+}
+
+func TestPreparedModelReadsFromReaders(t *testing.T) {
+	db := newTunedTestDB(t)
+	m, err := NewShortenerDataModel(db.Writer, db.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err = m.IncrementClicks("https://4C2P1PC8+"); err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if err = m.UpdateSettings("https://4C2P1PC8+", map[string]string{SettingAlwaysPreview: "true"}, SystemActor); err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	data, err := m.GetByCode("4C2P1PC8+")
+	if err != nil || data.Clicks != 1 {
+		t.Errorf("Expected the click to be read back. Got: %+v, %v", data, err)
+	}
+	settings, err := m.Settings("https://4C2P1PC8+")
+	if err != nil || settings[SettingAlwaysPreview] != "true" {
+		t.Errorf("Expected the settings to be read back. Got: %v, %v", settings, err)
+	}
+	if _, err = m.Get("https://missing"); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Expected ErrNoRecord. Got: %v", err)
+	}
+
+	// Writes can't be run on the readers
+	m.DB = db.Reader
+	if _, err = m.Insert("https://osnews.com", "https://osn", 0); err == nil {
+		t.Error("Expected writing to a reader to fail")
+	}
+
+	// Looking up deleted codes, as every missing link does, doesn't touch the
+	// writer
+	closed, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "closed.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	m.DB = closed
+	if deleted, err := m.Deleted("missing1"); err != nil || deleted {
+		t.Errorf("Expected the code not to have been deleted. Got: %t, %v", deleted, err)
+	}
+}
+
+// redirect runs the statements which following a link runs
+func redirect(m *ShortenerDataModel, code string) error {
+	data, err := m.GetByCode(code)
+	if err != nil {
+		return err
+	}
+	if _, err = m.Settings(data.ShortenedURL); err != nil {
+		return err
+	}
+	return m.IncrementClicks(data.ShortenedURL)
+}
+
+// BenchmarkLookup looks up a link and its settings, as every redirect does
+// before counting the click, with and without the prepared statements. The
+// SQLite driver still compiles prepared statements each time they're run, so
+// preparing them mostly saves database/sql's work of finding a connection.
+func BenchmarkLookup(b *testing.B) {
+	db := newTunedTestDB(b)
+	prepared, err := NewShortenerDataModel(db.Writer, db.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer prepared.Close()
+
+	for _, bm := range []struct {
+		name string
+		m    *ShortenerDataModel
+	}{
+		{"unprepared", &ShortenerDataModel{DB: db.Writer, Reader: db.Reader}},
+		{"prepared", prepared},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				data, err := bm.m.GetByCode("4C2P1PC8+")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err = bm.m.Settings(data.ShortenedURL); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkConcurrentRedirects follows a link from many goroutines at once, as
+// concurrent clicks do, with a default database/sql pool, and with a writer
+// connection, a pool of readers, and prepared statements. The clicks which
+// fail, e.g., with SQLITE_BUSY, are reported as errors/op.
+func BenchmarkConcurrentRedirects(b *testing.B) {
+	b.Run("default", func(b *testing.B) {
+		benchmarkConcurrentRedirects(b, &ShortenerDataModel{DB: newTestDB(b)})
+	})
+	b.Run("tuned", func(b *testing.B) {
+		db := newTunedTestDB(b)
+		m, err := NewShortenerDataModel(db.Writer, db.Reader)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer m.Close()
+		benchmarkConcurrentRedirects(b, m)
+	})
+}
+
+func benchmarkConcurrentRedirects(b *testing.B, m *ShortenerDataModel) {
+	var failed atomic.Int64
+	b.SetParallelism(4)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := redirect(m, "4C2P1PC8+"); err != nil {
+				failed.Add(1)
+			}
+		}
+	})
+	b.ReportMetric(float64(failed.Load())/float64(b.N), "errors/op")
+}
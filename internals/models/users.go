@@ -0,0 +1,241 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// UserDataInterface provides an interface for objects that manage the users
+// who can change links, and the API keys that they authenticate with.
+type UserDataInterface interface {
+	CreateUser(name string) error
+	Users() ([]*User, error)
+	DeleteUser(name string) error
+	CreateKey(user, name string) (*APIKey, string, error)
+	Key(id int) (*APIKey, error)
+	Keys(user string) ([]*APIKey, error)
+	RevokeKey(id int) error
+	Authenticate(key string) (*APIKey, error)
+}
+
+// User stores a user who can change links, and how many API keys they have
+type User struct {
+	Name    string
+	Keys    int
+	Created time.Time
+}
+
+// APIKey stores an API key's owner and name, but not the key itself, which is
+// only shown when it's created
+type APIKey struct {
+	ID         int
+	User, Name string
+	Created    time.Time
+}
+
+// Actor identifies the key in links' revision history, without revealing any
+// of the key itself
+func (k *APIKey) Actor() string {
+	return fmt.Sprintf("%s (API key %d)", k.User, k.ID)
+}
+
+var validUser = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+
+// UserModel manages users and their API keys. Reads, such as authenticating
+// each request's key, are run on Reader, if it's set, so that they don't
+// wait for writes to the DB.
+type UserModel struct {
+	DB, Reader *sql.DB
+}
+
+// reader returns the database which reads are run on
+func (m *UserModel) reader() *sql.DB {
+	if m.Reader == nil {
+		return m.DB
+	}
+	return m.Reader
+}
+
+// hashKey returns the hash of an API key, which is what's stored
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateUser adds a user. It returns ErrInvalidUser if the name isn't
+// lower-case letters, digits, and . _ -, and ErrDuplicate if the user exists.
+func (m *UserModel) CreateUser(name string) error {
+	if !validUser.MatchString(name) {
+		return ErrInvalidUser
+	}
+	_, err := m.DB.Exec(`INSERT INTO users (name) VALUES (?)`, name)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// Users retrieves every user, in order of name
+func (m *UserModel) Users() ([]*User, error) {
+	stmt := `SELECT name, created, (SELECT COUNT(*) FROM api_keys WHERE user_name = users.name)
+FROM users ORDER BY name`
+	rows, err := m.reader().Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user := &User{}
+		if err = rows.Scan(&user.Name, &user.Created, &user.Keys); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// DeleteUser deletes a user, along with their API keys
+func (m *UserModel) DeleteUser(name string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM api_keys WHERE user_name = ?`, name); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM users WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return tx.Commit()
+}
+
+// CreateKey creates an API key for a user, returning its details and the key
+// itself, which can't be retrieved again. It returns ErrNoRecord if the user
+// doesn't exist.
+func (m *UserModel) CreateKey(user, name string) (*APIKey, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	key := base64.RawURLEncoding.EncodeToString(secret)
+
+	stmt := `INSERT INTO api_keys (user_name, name, key_hash)
+SELECT name, ?, ? FROM users WHERE name = ?`
+	result, err := m.DB.Exec(stmt, strings.TrimSpace(name), hashKey(key), user)
+	if err != nil {
+		return nil, "", err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, "", err
+	}
+	if rowsAffected == 0 {
+		return nil, "", ErrNoRecord
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The key is read back from the DB, which it was just written to
+	created, err := m.key(m.DB, `id = ?`, id)
+	if err != nil {
+		return nil, "", err
+	}
+	return created, key, nil
+}
+
+// keyColumns are the columns of the api_keys table that are scanned into
+// APIKey by scanKey
+const keyColumns = `id, user_name, name, created`
+
+// scanKey scans a row of keyColumns into APIKey
+func scanKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	key := &APIKey{}
+	if err := row.Scan(&key.ID, &key.User, &key.Name, &key.Created); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// key retrieves the API key which matches the condition from db
+func (m *UserModel) key(db *sql.DB, condition string, args ...any) (*APIKey, error) {
+	key, err := scanKey(db.QueryRow(`SELECT `+keyColumns+` FROM api_keys WHERE `+condition, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoRecord
+	}
+	return key, err
+}
+
+// Key retrieves an API key by its ID. It returns ErrNoRecord if it doesn't
+// exist, e.g., because it was revoked.
+func (m *UserModel) Key(id int) (*APIKey, error) {
+	return m.key(m.reader(), `id = ?`, id)
+}
+
+// Keys retrieves the API keys of a user, or of every user if user is empty,
+// oldest first
+func (m *UserModel) Keys(user string) ([]*APIKey, error) {
+	stmt := `SELECT ` + keyColumns + ` FROM api_keys WHERE ? = '' OR user_name = ? ORDER BY id`
+	rows, err := m.reader().Query(stmt, user, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeKey deletes an API key, so that it can no longer be used
+func (m *UserModel) RevokeKey(id int) error {
+	result, err := m.DB.Exec(`DELETE FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// Authenticate retrieves the API key which matches key. It returns
+// ErrNoRecord if no key matches.
+func (m *UserModel) Authenticate(key string) (*APIKey, error) {
+	if key == "" {
+		return nil, ErrNoRecord
+	}
+	return m.key(m.reader(), `key_hash = ?`, hashKey(key))
+}
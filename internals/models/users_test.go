@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestUsersAndTheirKeys(t *testing.T) {
+	m := UserModel{DB: newTestDB(t)}
+
+	if err := m.CreateUser("ops"); err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if err := m.CreateUser("ops"); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected %s. Got: %v", ErrDuplicate, err)
+	}
+	if err := m.CreateUser("Not A User"); !errors.Is(err, ErrInvalidUser) {
+		t.Errorf("Expected %s. Got: %v", ErrInvalidUser, err)
+	}
+
+	created, secret, err := m.CreateKey("ops", "deploys")
+	if err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	if created.User != "ops" || created.Name != "deploys" || len(secret) < 32 {
+		t.Errorf("Incorrect key created. Got: %+v (%d characters)", created, len(secret))
+	}
+	if _, _, err = m.CreateKey("missing", ""); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+
+	authenticated, err := m.Authenticate(secret)
+	if err != nil || authenticated.ID != created.ID {
+		t.Errorf("Expected the key to authenticate. Got: %+v (%v)", authenticated, err)
+	}
+	if authenticated != nil && authenticated.Actor() != "ops (API key 1)" {
+		t.Errorf("Incorrect actor. Got: %s", authenticated.Actor())
+	}
+	for _, key := range []string{"", "not-a-key", secret[:8]} {
+		if _, err = m.Authenticate(key); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("%q: expected %s. Got: %v", key, ErrNoRecord, err)
+		}
+	}
+
+	users, err := m.Users()
+	if err != nil || len(users) != 1 || users[0].Keys != 1 {
+		t.Errorf("Incorrect users returned. Got: %+v (%v)", users, err)
+	}
+
+	if err = m.RevokeKey(created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Key(created.ID); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Expected a revoked key to be deleted. Got: %v", err)
+	}
+	if _, err = m.Authenticate(secret); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Expected a revoked key not to authenticate. Got: %v", err)
+	}
+
+	if _, secret, err = m.CreateKey("ops", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.DeleteUser("ops"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Authenticate(secret); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Expected a deleted user's key not to authenticate. Got: %v", err)
+	}
+	if keys, _ := m.Keys(""); len(keys) != 0 {
+		t.Errorf("Expected the deleted user's keys to be deleted. Got: %+v", keys)
+	}
+	if err = m.DeleteUser("ops"); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("Expected %s. Got: %v", ErrNoRecord, err)
+	}
+}
+
+func TestUserModelReadsFromReaders(t *testing.T) {
+	db := newTunedTestDB(t)
+	m := UserModel{DB: db.Writer, Reader: db.Reader}
+
+	if err := m.CreateUser("ops"); err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+	created, secret, err := m.CreateKey("ops", "deploys")
+	if err != nil {
+		t.Fatalf("Did not expect an error to be returned. Got: %s", err)
+	}
+
+	// Reads don't touch the writer, so they work once it's closed
+	closed, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "closed.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	m.DB = closed
+	if key, err := m.Authenticate(secret); err != nil || key.ID != created.ID {
+		t.Errorf("Expected the key to be authenticated. Got: %+v, %v", key, err)
+	}
+	if key, err := m.Key(created.ID); err != nil || key.User != "ops" {
+		t.Errorf("Expected the key to be read back. Got: %+v, %v", key, err)
+	}
+	if err = m.CreateUser("dev"); err == nil {
+		t.Error("Expected writes to go to the closed writer, and fail")
+	}
+}
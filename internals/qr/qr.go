@@ -0,0 +1,175 @@
+// Package qr renders QR codes as PNG or SVG images, locally, with a
+// configurable size, error correction level, and margin.
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// The supported image formats
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// The limits of the options
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+// ErrFormat is returned when an image format isn't supported
+var ErrFormat = errors.New("qr: unsupported format, which must be png or svg")
+
+// levels maps the names of the error correction levels to the levels. Higher
+// levels can recover from more damage, at the cost of denser codes.
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options configures a QR code image. Size is the width and height of PNG
+// images in pixels, and of SVG images in user units. Level is the error
+// correction level: L, M, Q, or H. Margin is the width of the quiet zone
+// around the code, in modules.
+type Options struct {
+	Format string
+	Size   int
+	Level  string
+	Margin int
+}
+
+// DefaultOptions returns the default options: a 256 pixel PNG image, with
+// medium error correction, and the standard margin of 4 modules
+func DefaultOptions() Options {
+	return Options{Format: FormatPNG, Size: 256, Level: "M", Margin: 4}
+}
+
+// ContentType returns the content type of an image format
+func ContentType(format string) string {
+	if format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Validate checks that the options are supported
+func (o Options) Validate() error {
+	switch {
+	case o.Format != FormatPNG && o.Format != FormatSVG:
+		return ErrFormat
+	case o.Size < MinSize || o.Size > MaxSize:
+		return fmt.Errorf("qr: size must be between %d and %d", MinSize, MaxSize)
+	case o.Margin < 0 || o.Margin > MaxMargin:
+		return fmt.Errorf("qr: margin must be between 0 and %d", MaxMargin)
+	}
+	if _, ok := levels[strings.ToUpper(o.Level)]; !ok {
+		return errors.New("qr: level must be L, M, Q, or H")
+	}
+	return nil
+}
+
+// Encode renders content as a QR code image
+func Encode(content string, options Options) ([]byte, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.New(content, levels[strings.ToUpper(options.Level)])
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	modules := withMargin(code.Bitmap(), options.Margin)
+
+	if options.Format == FormatSVG {
+		return renderSVG(modules, options.Size), nil
+	}
+	return renderPNG(modules, options.Size)
+}
+
+// withMargin surrounds a QR code's modules with a margin of light modules
+func withMargin(bitmap [][]bool, margin int) [][]bool {
+	n := len(bitmap) + 2*margin
+	modules := make([][]bool, n)
+	for y := range modules {
+		modules[y] = make([]bool, n)
+		if y >= margin && y < n-margin {
+			copy(modules[y][margin:], bitmap[y-margin])
+		}
+	}
+	return modules
+}
+
+// renderPNG renders modules as a size by size PNG image. Each module is a
+// whole number of pixels, so that the code stays sharp, and the code is
+// centred in any pixels left over.
+func renderPNG(modules [][]bool, size int) ([]byte, error) {
+	n := len(modules)
+	scale := size / n
+	if scale < 1 {
+		scale, size = 1, n
+	}
+	offset := (size - scale*n) / 2
+
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(offset+x*scale+dx, offset+y*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG renders modules as an SVG image, drawing each horizontal run of
+// dark modules as a single rectangle
+func renderSVG(modules [][]bool, size int) []byte {
+	n := len(modules)
+	var path strings.Builder
+	for y, row := range modules {
+		for x := 0; x < n; x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < n && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="%d" height="%d" fill="#fff"/>
+<path fill="#000" d="%s"/>
+</svg>
+`, size, size, n, n, n, n, path.String())
+	return buf.Bytes()
+}
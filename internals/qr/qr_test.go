@@ -0,0 +1,62 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestEncodePNG(t *testing.T) {
+	options := DefaultOptions()
+	options.Size = 300
+	data, err := Encode("https://go.example/shorten3d", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 300 || bounds.Dy() != 300 {
+		t.Errorf("Incorrect image size. Expected 300x300; got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xffff {
+		t.Error("Expected the margin to be white")
+	}
+}
+
+func TestEncodeSVG(t *testing.T) {
+	options := Options{Format: FormatSVG, Size: 128, Level: "h", Margin: 0}
+	data, err := Encode("https://go.example/shorten3d", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg := string(data)
+	if !strings.Contains(svg, `width="128" height="128"`) || !strings.Contains(svg, `<path fill="#000" d="M0 0h7v1h-7z`) {
+		t.Errorf("Incorrect SVG rendered. Got: %s", svg)
+	}
+}
+
+func TestMarginWidensTheCode(t *testing.T) {
+	bitmap := [][]bool{{true}}
+	modules := withMargin(bitmap, 2)
+	if len(modules) != 5 || !modules[2][2] || modules[0][0] {
+		t.Errorf("Incorrect margin added. Got: %v", modules)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, options := range []Options{
+		{Format: "gif", Size: 256, Level: "M"},
+		{Format: FormatPNG, Size: 10, Level: "M"},
+		{Format: FormatPNG, Size: 256, Level: "X"},
+		{Format: FormatPNG, Size: 256, Level: "M", Margin: 100},
+	} {
+		if err := options.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", options)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR ranges of the
+// proxies whose forwarding headers can be trusted
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("ratelimit: %q is not an IP address or CIDR range", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: %q is not an IP address or CIDR range", proxy)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// trusted reports whether ip belongs to one of the trusted proxies
+func trusted(ip net.IP, proxies []*net.IPNet) bool {
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromTrustedProxy reports whether a request was made by one of the trusted
+// proxies, so that its forwarding headers can be trusted
+func FromTrustedProxy(r *http.Request, proxies []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+	return remote != nil && trusted(remote, proxies)
+}
+
+// ClientIP returns the IP address of the client making a request. If the
+// request came through one of the trusted proxies, the client's address is
+// taken from the X-Forwarded-For header, ignoring addresses added by trusted
+// proxies, or failing that, from the X-Real-IP header.
+func ClientIP(r *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !FromTrustedProxy(r, proxies) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+		if !trusted(ip, proxies) {
+			return ip.String()
+		}
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	return host
+}
+
+// apiKeyContextKey is the context key of the ID of the API key which
+// authenticated a request
+type apiKeyContextKey struct{}
+
+// WithAPIKey returns a copy of r which is identified as coming from the API
+// key with the supplied ID. It must only be called once the key has been
+// verified.
+func WithAPIKey(r *http.Request, id int) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, id))
+}
+
+// ClientKey returns a key function which identifies clients by their API key,
+// if the request was authenticated with one, or by their IP address
+// otherwise. The X-API-Key header itself isn't trusted, so that clients can't
+// get a fresh budget by making keys up.
+func ClientKey(proxies []*net.IPNet) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if id, ok := r.Context().Value(apiKeyContextKey{}).(int); ok {
+			return "key:" + strconv.Itoa(id)
+		}
+		return "ip:" + ClientIP(r, proxies)
+	}
+}
@@ -0,0 +1,184 @@
+// Package ratelimit limits how often clients can make requests, using the
+// token bucket algorithm.
+//
+// Each client has a bucket which holds up to Burst tokens, and which refills
+// at Rate tokens per second. Every request takes a token from the bucket, and
+// is rejected if the bucket is empty. Buckets are held in a Store, so that
+// they can be shared between instances of the application.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit describes how many requests a client can make
+type Limit struct {
+	// Rate is the number of tokens added to a bucket per second
+	Rate float64
+	// Burst is the maximum number of tokens that a bucket can hold
+	Burst int
+}
+
+// ParseLimit parses a limit in the form "<requests>/<duration>", such as
+// "30/1m" or "5/1s". The burst is the number of requests.
+func ParseLimit(s string) (Limit, error) {
+	requests, period, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found {
+		return Limit{}, fmt.Errorf("ratelimit: %q is not in the form <requests>/<duration>", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: %q is not a positive number of requests", requests)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: %q is not a positive duration", period)
+	}
+
+	return Limit{Rate: float64(n) / d.Seconds(), Burst: n}, nil
+}
+
+// Store holds the token buckets of every client
+type Store interface {
+	// Take removes a token from the bucket identified by key, refilling it
+	// according to limit first. It reports whether a token was available
+	// and, if not, how long it will be until one is.
+	Take(key string, limit Limit, now time.Time) (allowed bool, retryAfter time.Duration)
+}
+
+// bucket is a single client's token bucket, and the limit it refills at
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// MemoryStore is a Store which holds buckets in memory. Buckets which have
+// refilled completely are removed periodically, so that it doesn't grow
+// without bound.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+// sweepInterval is how often idle buckets are removed from a MemoryStore
+const sweepInterval = time.Minute
+
+// Take implements Store
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	b.last = now
+	b.limit = limit
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := (1 - b.tokens) / limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// sweep removes buckets which will have refilled completely by now, at their
+// own limits. It must be called with the lock held.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// Limiter is middleware which rejects requests from clients which have used
+// up their budget
+type Limiter struct {
+	// Name distinguishes the limiter's buckets from those of other limiters
+	// using the same store
+	Name  string
+	Limit Limit
+	Store Store
+	// Key identifies the client making a request
+	Key func(r *http.Request) string
+
+	now func() time.Time
+}
+
+// NewLimiter creates a Limiter which identifies clients with the supplied key
+// function and holds their buckets in the supplied store
+func NewLimiter(name string, limit Limit, store Store, key func(r *http.Request) string) *Limiter {
+	return &Limiter{
+		Name:  name,
+		Limit: limit,
+		Store: store,
+		Key:   key,
+		now:   time.Now,
+	}
+}
+
+// Middleware wraps next, responding with 429 Too Many Requests, and a
+// Retry-After header, to clients which have used up their budget. It can be
+// used as an alice.Constructor.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return l.RejectWith(nil)(next)
+}
+
+// RejectWith returns middleware like Middleware, which responds to clients
+// that have used up their budget with rejected, after setting the
+// Retry-After header. rejected must set the 429 status itself. If it's nil,
+// the response is plain text.
+func (l *Limiter) RejectWith(rejected http.HandlerFunc) func(http.Handler) http.Handler {
+	if rejected == nil {
+		rejected = func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now
+			if l.now != nil {
+				now = l.now
+			}
+
+			allowed, retryAfter := l.Store.Take(l.Name+":"+l.Key(r), l.Limit, now())
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				rejected(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("30/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit.Burst != 30 || limit.Rate != 0.5 {
+		t.Errorf("Incorrect limit returned. Got: %+v", limit)
+	}
+
+	for _, invalid := range []string{"", "30", "0/1m", "thirty/1m", "30/forever", "30/-1s"} {
+		if _, err := ParseLimit(invalid); err == nil {
+			t.Errorf("%q: expected an error to be returned", invalid)
+		}
+	}
+}
+
+func TestMemoryStoreRefillsBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Date(2024, time.February, 21, 7, 11, 21, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := store.Take("client", limit, now); !allowed {
+			t.Fatalf("Request %d should have been allowed", i+1)
+		}
+	}
+
+	allowed, retryAfter := store.Take("client", limit, now)
+	if allowed {
+		t.Error("Request should have been rejected once the bucket was empty")
+	}
+	if retryAfter != time.Second {
+		t.Errorf("got retry after %s; want %s", retryAfter, time.Second)
+	}
+
+	if allowed, _ := store.Take("another-client", limit, now); !allowed {
+		t.Error("Clients should not share a bucket")
+	}
+
+	if allowed, _ := store.Take("client", limit, now.Add(time.Second)); !allowed {
+		t.Error("Request should have been allowed once the bucket refilled")
+	}
+}
+
+func TestMemoryStoreSweepsBucketsAtTheirOwnLimit(t *testing.T) {
+	store := NewMemoryStore()
+	slow := Limit{Rate: 0.001, Burst: 1}
+	now := time.Date(2024, time.February, 21, 7, 11, 21, 0, time.UTC)
+
+	if allowed, _ := store.Take("slow:client", slow, now); !allowed {
+		t.Fatal("The first request should have been allowed")
+	}
+	// Sweeping at the fast limit would remove the slow bucket before it has
+	// refilled, giving the client a fresh budget
+	store.Take("fast:client", Limit{Rate: 1, Burst: 1}, now.Add(2*time.Minute))
+	if allowed, _ := store.Take("slow:client", slow, now.Add(2*time.Minute)); allowed {
+		t.Error("Request should have been rejected until the slow bucket refilled")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, remoteAddr, forwardedFor, realIP, expected string
+	}{
+		{"direct client", "203.0.113.5:4000", "", "", "203.0.113.5"},
+		{"untrusted proxy headers are ignored", "203.0.113.5:4000", "198.51.100.7", "198.51.100.8", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:4000", "198.51.100.7", "", "198.51.100.7"},
+		{"spoofed forwarded for", "10.0.0.2:4000", "1.2.3.4, 198.51.100.7, 10.0.0.3", "", "198.51.100.7"},
+		{"real ip header", "192.168.1.1:4000", "", "198.51.100.8", "198.51.100.8"},
+		{"no forwarding headers", "10.0.0.2:4000", "", "", "10.0.0.2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			if test.realIP != "" {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+			if ip := ClientIP(r, proxies); ip != test.expected {
+				t.Errorf("got %s; want %s", ip, test.expected)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRejectsRequestsOverBudget(t *testing.T) {
+	limiter := NewLimiter("create", Limit{Rate: 0.1, Burst: 1}, NewMemoryStore(), ClientKey(nil))
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func(apiKey string, authenticated bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if apiKey != "" {
+			r.Header.Set("X-API-Key", apiKey)
+		}
+		if authenticated {
+			r = WithAPIKey(r, 1)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	if rr := request("", false); rr.Code != http.StatusNoContent {
+		t.Errorf("got %d; want %d", rr.Code, http.StatusNoContent)
+	}
+
+	rr := request("", false)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("got %d; want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "10" {
+		t.Errorf("got Retry-After '%s'; want '%s'", retryAfter, "10")
+	}
+
+	if rr := request("a-made-up-key", false); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Requests with an unverified API key should share the address's budget. Got %d; want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if rr := request("an-api-key", true); rr.Code != http.StatusNoContent {
+		t.Errorf("Requests with a verified API key should have their own budget. Got %d; want %d", rr.Code, http.StatusNoContent)
+	}
+}
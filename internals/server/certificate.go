@@ -0,0 +1,140 @@
+// Package server provides the pieces needed to serve the application over
+// HTTPS without a proxy in front of it: a TLS certificate which is reloaded
+// when it's renewed, and a plain HTTP handler which redirects to HTTPS.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// CertificateReloader holds a TLS certificate loaded from a certificate and
+// key file. The certificate can be reloaded on demand, on a signal, or when
+// either file changes, so that renewed certificates are picked up without a
+// restart. It's safe for concurrent use.
+type CertificateReloader struct {
+	certFile, keyFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// NewCertificateReloader loads the certificate in the supplied files
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// currentModTimes returns when the certificate and key files were last modified
+func (r *CertificateReloader) currentModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// Reload reloads the certificate from its files. If the files can't be
+// loaded, the existing certificate is kept.
+func (r *CertificateReloader) Reload() error {
+	modTimes, err := r.currentModTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTimes = modTimes
+
+	return nil
+}
+
+// GetCertificate returns the current certificate. It's intended to be used as
+// tls.Config.GetCertificate.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a TLS configuration which serves the current certificate
+func (r *CertificateReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// changed reports whether the certificate or key file has changed since the
+// certificate was last loaded
+func (r *CertificateReloader) changed() bool {
+	modTimes, err := r.currentModTimes()
+	if err != nil {
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return modTimes != r.modTimes
+}
+
+// Watch checks the certificate and key files for changes at the supplied
+// interval, reloading the certificate when they change, until the context is
+// cancelled. Errors reloading the certificate are passed to onError.
+func (r *CertificateReloader) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// ReloadOnSignal reloads the certificate whenever the process receives one of
+// the supplied signals, such as SIGHUP, until the context is cancelled.
+// Errors reloading the certificate are passed to onError.
+func (r *CertificateReloader) ReloadOnSignal(ctx context.Context, onError func(error), signals ...os.Signal) {
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+
+	go func() {
+		defer signal.Stop(received)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-received:
+				if err := r.Reload(); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
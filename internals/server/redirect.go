@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net"
+	"net/http"
+)
+
+// RedirectHandler returns a handler which permanently redirects every request
+// to the same URL over HTTPS. httpsPort is the port that the HTTPS listener
+// is on, which is left out of the redirect if it's the default, 443.
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
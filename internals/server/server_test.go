@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCertificate generates a self-signed certificate for
+// localhost, with the supplied serial number, and writes it and its key to
+// the supplied files
+func writeSelfSignedCertificate(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedSerial returns the serial number of the certificate served by the
+// supplied TLS configuration
+func servedSerial(t *testing.T, config *tls.Config) int64 {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	rs, err := client.Get("https://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	return rs.TLS.PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestCertificateReloaderServesReloadedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSignedCertificate(t, certFile, keyFile, 1)
+
+	certs, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := servedSerial(t, certs.TLSConfig()); serial != 1 {
+		t.Errorf("got serial %d; want %d", serial, 1)
+	}
+
+	writeSelfSignedCertificate(t, certFile, keyFile, 2)
+	if err = certs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if serial := servedSerial(t, certs.TLSConfig()); serial != 2 {
+		t.Errorf("got serial %d; want %d", serial, 2)
+	}
+}
+
+func TestCertificateReloaderKeepsCertificateIfReloadFails(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSignedCertificate(t, certFile, keyFile, 1)
+
+	certs, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = certs.Reload(); err == nil {
+		t.Error("Expected an error to be returned for an invalid key")
+	}
+	if serial := servedSerial(t, certs.TLSConfig()); serial != 1 {
+		t.Errorf("got serial %d; want %d", serial, 1)
+	}
+}
+
+func TestCertificateReloaderWatchesFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSignedCertificate(t, certFile, keyFile, 1)
+
+	certs, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go certs.Watch(ctx, 10*time.Millisecond, func(err error) {
+		t.Error(err)
+	})
+
+	// Make sure that the modification time changes, even on file systems
+	// with a coarse timestamp resolution
+	writeSelfSignedCertificate(t, certFile, keyFile, 2)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		cert, _ := certs.GetCertificate(nil)
+		if parsed, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && parsed.SerialNumber.Int64() == 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("The certificate was not reloaded after its files changed")
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name, httpsPort, target, expected string
+	}{
+		{"default port", "443", "http://short.example/open?url=x", "https://short.example/open?url=x"},
+		{"custom port", "8443", "http://short.example:8080/", "https://short.example:8443/"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			RedirectHandler(test.httpsPort).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+			if rr.Code != http.StatusPermanentRedirect {
+				t.Errorf("got %d; want %d", rr.Code, http.StatusPermanentRedirect)
+			}
+			if location := rr.Header().Get("Location"); location != test.expected {
+				t.Errorf("got '%s'; want '%s'", location, test.expected)
+			}
+		})
+	}
+}
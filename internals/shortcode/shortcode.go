@@ -0,0 +1,272 @@
+// Package shortcode generates the codes of shortened URLs, e.g., the
+// "4C2P1PC8" of https://4C2P1PC8. Every code is URL-safe, so it can be used in
+// paths and query strings without being escaped.
+package shortcode
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The alphabets which codes are drawn from
+const (
+	// Base62 is the digits and the upper and lower case ASCII letters
+	Base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// Unambiguous is Base62 without the characters which are easily confused
+	// with each other when read or typed: 0, O, o, 1, I, l, and L
+	Unambiguous = "23456789ABCDEFGHJKMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz"
+)
+
+// DefaultLength is the default (minimum) length of generated codes
+const DefaultLength = 7
+
+// MaxLength is the length that codes won't grow beyond
+const MaxLength = 32
+
+// validCode matches codes which are URL-safe, and at most MaxLength
+// characters long
+var validCode = regexp.MustCompile(fmt.Sprintf(`^[A-Za-z0-9_-]{1,%d}$`, MaxLength))
+
+// reserved are the first segments of the application's own routes, e.g.,
+// /login and /api/links, which a link with the same code could never be
+// reached at
+var reserved = map[string]bool{
+	"api":      true,
+	"language": true,
+	"links":    true,
+	"login":    true,
+	"logout":   true,
+	"open":     true,
+	"static":   true,
+}
+
+// Reserved reports whether code is the name of one of the application's own
+// routes. Case is ignored, as the router redirects /Login to /login.
+func Reserved(code string) bool {
+	return reserved[strings.ToLower(code)]
+}
+
+// Valid reports whether code can be used as a shortened URL's code, e.g., as
+// an alias. Codes may only contain letters, digits, '_', and '-', so that
+// they never need escaping, and can't be reserved.
+func Valid(code string) bool {
+	return validCode.MatchString(code) && !Reserved(code)
+}
+
+// ErrCollision is returned by an Allocator's insert function when a code is
+// already in use
+var ErrCollision = errors.New("shortcode: code is already in use")
+
+// ErrExhausted is returned when an Allocator can't find an unused code
+var ErrExhausted = errors.New("shortcode: could not find an unused code")
+
+// CodeGenerator generates the codes of shortened URLs
+type CodeGenerator interface {
+	// Generate returns a new code which is at least length characters long
+	Generate(length int) (string, error)
+}
+
+// Random generates codes of random characters from its alphabet
+type Random struct {
+	Alphabet string
+}
+
+// NewRandom creates a Random generator which draws from alphabet
+func NewRandom(alphabet string) *Random {
+	return &Random{Alphabet: alphabet}
+}
+
+// Generate implements CodeGenerator
+func (g *Random) Generate(length int) (string, error) {
+	max := big.NewInt(int64(len(g.Alphabet)))
+	var code strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(g.Alphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// Counter returns sequential IDs, starting at 1, which are never reused
+type Counter interface {
+	Next() (uint64, error)
+}
+
+// multiplier is coprime with 62, so multiplying by it modulo any power of 62
+// permutes the codes of that length
+var multiplier = big.NewInt(2654435761)
+
+// Sequential generates codes from sequential IDs, which are obfuscated into
+// base62, so that consecutive links don't have consecutive codes. The codes
+// are unique for as long as the counter's IDs are, and Salt changes which
+// code each ID is given. Codes grow beyond the requested length once the IDs
+// outgrow it.
+type Sequential struct {
+	Counter Counter
+	Salt    uint64
+}
+
+// NewSequential creates a Sequential generator which draws IDs from counter
+func NewSequential(counter Counter, salt uint64) *Sequential {
+	return &Sequential{Counter: counter, Salt: salt}
+}
+
+// Generate implements CodeGenerator
+func (g *Sequential) Generate(length int) (string, error) {
+	id, err := g.Counter.Next()
+	if err != nil {
+		return "", err
+	}
+	return obfuscate(id, g.Salt, length), nil
+}
+
+// obfuscate maps id to a base62 code of at least length characters. For each
+// length, the mapping is a permutation of the codes of that length.
+func obfuscate(id, salt uint64, length int) string {
+	if length < 1 {
+		length = 1
+	}
+	base := big.NewInt(int64(len(Base62)))
+	n := new(big.Int).SetUint64(id)
+	keyspace := new(big.Int).Exp(base, big.NewInt(int64(length)), nil)
+	for n.Cmp(keyspace) >= 0 {
+		keyspace.Mul(keyspace, base)
+		length++
+	}
+
+	n.Mul(n, multiplier)
+	n.Add(n, new(big.Int).SetUint64(salt))
+	n.Mod(n, keyspace)
+
+	code := make([]byte, length)
+	digit := new(big.Int)
+	for i := length - 1; i >= 0; i-- {
+		n.DivMod(n, base, digit)
+		code[i] = Base62[digit.Int64()]
+	}
+	return string(code)
+}
+
+// New creates the named generator: "random" (random base62), "unambiguous"
+// (random, without easily confused characters), or "sequential" (obfuscated
+// sequential IDs, drawn from counter)
+func New(name string, counter Counter, salt uint64) (CodeGenerator, error) {
+	switch name {
+	case "", "random":
+		return NewRandom(Base62), nil
+	case "unambiguous":
+		return NewRandom(Unambiguous), nil
+	case "sequential":
+		if counter == nil {
+			return nil, errors.New("shortcode: the sequential generator needs a counter")
+		}
+		return NewSequential(counter, salt), nil
+	default:
+		return nil, fmt.Errorf("shortcode: unknown generator %q", name)
+	}
+}
+
+// Allocator finds unused codes, retrying when a generated code is already in
+// use. As the keyspace fills, collisions become more likely, so after
+// CollisionsPerLength collisions in a row the length of the codes which it
+// generates grows by one character, for every later code too.
+type Allocator struct {
+	Generator CodeGenerator
+	// CollisionsPerLength is the number of collisions in a row which grow
+	// the length of codes
+	CollisionsPerLength int
+	// MaxAttempts is the number of codes which are tried before giving up
+	MaxAttempts int
+
+	mu     sync.Mutex
+	length int
+}
+
+// NewAllocator creates an Allocator which generates codes of at least length
+// characters with generator
+func NewAllocator(generator CodeGenerator, length int) *Allocator {
+	if length < 1 {
+		length = DefaultLength
+	}
+	return &Allocator{
+		Generator:           generator,
+		CollisionsPerLength: 3,
+		MaxAttempts:         12,
+		length:              length,
+	}
+}
+
+// Length returns the length of the codes which the Allocator generates
+func (a *Allocator) Length() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.length < 1 {
+		a.length = DefaultLength
+	}
+	return a.length
+}
+
+// grow increases the length of the codes which the Allocator generates, unless
+// another allocation has already grown it beyond from
+func (a *Allocator) grow(from int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.length == from && a.length < MaxLength {
+		a.length++
+	}
+}
+
+// Generate returns a new code, without checking whether it's in use
+func (a *Allocator) Generate() (string, error) {
+	return a.Generator.Generate(a.Length())
+}
+
+// Allocate generates codes and passes them to insert, until insert stores one
+// without returning ErrCollision, and returns that code. Reserved codes count
+// as collisions, without being passed to insert. Any other error from insert
+// is returned as it is.
+func (a *Allocator) Allocate(insert func(code string) error) (string, error) {
+	maxAttempts, collisionsPerLength := a.MaxAttempts, a.CollisionsPerLength
+	if maxAttempts < 1 {
+		maxAttempts = 12
+	}
+	if collisionsPerLength < 1 {
+		collisionsPerLength = 3
+	}
+
+	collisions := 0
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		length := a.Length()
+		code, err := a.Generator.Generate(length)
+		if err != nil {
+			return "", err
+		}
+
+		if Reserved(code) {
+			err = ErrCollision
+		} else {
+			err = insert(code)
+		}
+		if err == nil {
+			return code, nil
+		}
+		if !errors.Is(err, ErrCollision) {
+			return "", err
+		}
+
+		collisions++
+		if collisions%collisionsPerLength == 0 {
+			a.grow(length)
+		}
+	}
+
+	return "", ErrExhausted
+}
@@ -0,0 +1,162 @@
+package shortcode
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// counter is an in-memory Counter
+type counter struct {
+	next uint64
+}
+
+func (c *counter) Next() (uint64, error) {
+	c.next++
+	return c.next, nil
+}
+
+func TestRandomCodesAreUrlSafe(t *testing.T) {
+	for _, alphabet := range []string{Base62, Unambiguous} {
+		generator := NewRandom(alphabet)
+		used := map[rune]bool{}
+		for i := 0; i < 1000; i++ {
+			code, err := generator.Generate(9)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(code) != 9 || url.PathEscape(code) != code || url.QueryEscape(code) != code {
+				t.Fatalf("got %q; want 9 URL-safe characters", code)
+			}
+			for _, char := range code {
+				if !strings.ContainsRune(alphabet, char) {
+					t.Fatalf("got %q, which isn't in the alphabet %q", code, alphabet)
+				}
+				used[char] = true
+			}
+		}
+		if len(used) != len(alphabet) {
+			t.Errorf("got codes drawn from %d characters; want all %d characters of %q", len(used), len(alphabet), alphabet)
+		}
+	}
+
+	if strings.ContainsAny(Unambiguous, "0Oo1IlL") {
+		t.Errorf("the unambiguous alphabet contains ambiguous characters")
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, code := range []string{"docs", "4C2P1PC8", "go_dev-2024", strings.Repeat("a", MaxLength)} {
+		if !Valid(code) {
+			t.Errorf("%q: expected the code to be valid", code)
+		}
+	}
+	for _, code := range []string{"", "a+b", "not valid!", "a/b", "ünï", strings.Repeat("a", MaxLength+1), "login", "API", "Static"} {
+		if Valid(code) {
+			t.Errorf("%q: expected the code to be invalid", code)
+		}
+	}
+}
+
+func TestSequentialCodesAreUnique(t *testing.T) {
+	generator := NewSequential(&counter{}, 42)
+	seen := map[string]bool{}
+	for i := 0; i < 10000; i++ {
+		code, err := generator.Generate(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 3 {
+			t.Fatalf("got %q; want 3 characters", code)
+		}
+		if seen[code] {
+			t.Fatalf("got %q twice", code)
+		}
+		seen[code] = true
+	}
+
+	first, _ := NewSequential(&counter{}, 42).Generate(3)
+	second, _ := NewSequential(&counter{next: 1}, 42).Generate(3)
+	if first[:2] == second[:2] {
+		t.Errorf("got consecutive codes %q and %q; want them obfuscated", first, second)
+	}
+}
+
+func TestSequentialCodesGrowWithTheIds(t *testing.T) {
+	code := obfuscate(62*62, 0, 2)
+	if len(code) != 3 {
+		t.Errorf("got %q; want 3 characters once the IDs outgrow 2", code)
+	}
+}
+
+func TestAllocatorRetriesAndGrowsOnCollisions(t *testing.T) {
+	allocator := NewAllocator(NewRandom(Base62), 4)
+	attempts := 0
+	code, err := allocator.Allocate(func(code string) error {
+		attempts++
+		if attempts <= 3 {
+			return ErrCollision
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 4 || len(code) != 5 {
+		t.Errorf("got %q after %d attempts; want 5 characters after 4 attempts", code, attempts)
+	}
+	if allocator.Length() != 5 {
+		t.Errorf("got length %d; want later codes to stay at 5", allocator.Length())
+	}
+
+	_, err = allocator.Allocate(func(code string) error { return ErrCollision })
+	if !errors.Is(err, ErrExhausted) {
+		t.Errorf("got %v; want %v", err, ErrExhausted)
+	}
+
+	failure := errors.New("database is locked")
+	if _, err = allocator.Allocate(func(code string) error { return failure }); err != failure {
+		t.Errorf("got %v; want %v", err, failure)
+	}
+}
+
+// fixedGenerator generates its codes in order
+type fixedGenerator struct {
+	codes []string
+}
+
+func (g *fixedGenerator) Generate(length int) (string, error) {
+	code := g.codes[0]
+	g.codes = g.codes[1:]
+	return code, nil
+}
+
+func TestAllocatorSkipsReservedCodes(t *testing.T) {
+	allocator := NewAllocator(&fixedGenerator{codes: []string{"language", "LINKS", "docs"}}, 4)
+	var inserted []string
+	code, err := allocator.Allocate(func(code string) error {
+		inserted = append(inserted, code)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "docs" || len(inserted) != 1 {
+		t.Errorf("got %q, after inserting %v; want only docs to be inserted", code, inserted)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, name := range []string{"", "random", "unambiguous", "sequential"} {
+		if _, err := New(name, &counter{}, 0); err != nil {
+			t.Errorf("%q: did not expect an error. Got: %s", name, err)
+		}
+	}
+	if _, err := New("sequential", nil, 0); err == nil {
+		t.Error("expected an error for a sequential generator without a counter")
+	}
+	if _, err := New("uuid", nil, 0); err == nil {
+		t.Error("expected an error for an unknown generator")
+	}
+}
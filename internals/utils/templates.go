@@ -6,8 +6,9 @@ import (
 	"golang.org/x/text/number"
 )
 
-// FormatClicks formats the click count with a thousands separator
-func FormatClicks(clicks int) string {
-	p := message.NewPrinter(language.English)
+// FormatClicks formats the click count with the thousands separator of the
+// supplied language, e.g., 1,234 in English, and 1.234 in German
+func FormatClicks(tag language.Tag, clicks int) string {
+	p := message.NewPrinter(tag)
 	return p.Sprintf("%v", number.Decimal(clicks))
-}
\ No newline at end of file
+}
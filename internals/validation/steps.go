@@ -0,0 +1,217 @@
+package validation
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// SchemeStep rejects URLs whose scheme isn't in the allow-list
+type SchemeStep struct {
+	Allowed []string
+}
+
+// Validate implements Step
+func (s SchemeStep) Validate(ctx context.Context, u *url.URL) error {
+	u.Scheme = strings.ToLower(u.Scheme)
+	for _, scheme := range s.Allowed {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return nil
+		}
+	}
+
+	return NewError(ErrScheme, "URLs starting with %s:// can't be shortened. Please use one of: %s.", u.Scheme, strings.Join(s.Allowed, ", "))
+}
+
+// MaxLengthStep rejects URLs longer than Max characters
+type MaxLengthStep struct {
+	Max int
+}
+
+// Validate implements Step
+func (s MaxLengthStep) Validate(ctx context.Context, u *url.URL) error {
+	if len(u.String()) > s.Max {
+		return NewError(ErrTooLong, "The URL is too long. It can be at most %d characters.", s.Max)
+	}
+	return nil
+}
+
+// IDNStep normalises internationalised domain names to their lower-case,
+// punycode (ASCII) form, rejecting host names which aren't valid
+type IDNStep struct{}
+
+// Validate implements Step
+func (s IDNStep) Validate(ctx context.Context, u *url.URL) error {
+	hostname := u.Hostname()
+	if net.ParseIP(hostname) != nil {
+		return nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return NewError(ErrSyntax, "%s isn't a valid host name.", hostname)
+	}
+
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(ascii, port)
+	} else {
+		u.Host = ascii
+	}
+	return nil
+}
+
+// HostStep rejects URLs whose host is in the deny-list or, if the allow-list
+// isn't empty, isn't in the allow-list. Entries match the host itself and all
+// of its subdomains.
+type HostStep struct {
+	Allowed, Denied []string
+}
+
+// matchesHost reports whether host is domain, or one of domain's subdomains
+func matchesHost(host, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "."))
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+// Validate implements Step
+func (s HostStep) Validate(ctx context.Context, u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range s.Denied {
+		if matchesHost(host, domain) {
+			return NewError(ErrHost, "URLs pointing to %s can't be shortened.", host)
+		}
+	}
+
+	if len(s.Allowed) == 0 {
+		return nil
+	}
+	for _, domain := range s.Allowed {
+		if matchesHost(host, domain) {
+			return nil
+		}
+	}
+
+	return NewError(ErrHost, "URLs pointing to %s can't be shortened. Only URLs pointing to %s can be.", host, strings.Join(s.Allowed, ", "))
+}
+
+// PrivateAddressStep rejects URLs which point to localhost, or to private,
+// loopback, link-local, or unspecified IP addresses
+type PrivateAddressStep struct {
+	// Resolve resolves host names to check the addresses that they point to.
+	// If resolution fails, the URL is not rejected.
+	Resolve bool
+}
+
+// isPrivateIP reports whether ip isn't publicly routable
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// RefusePrivateAddresses is a net.Dialer Control function which refuses
+// connections to the addresses that PrivateAddressStep rejects. It checks the
+// address being connected to, so clients which use it can't be sent to a
+// private address by a redirect, or by a host name which resolves to one.
+func RefusePrivateAddresses(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+		return NewError(ErrPrivateAddress, "Connections to %s are refused, as it's a private or local address.", host)
+	}
+	return nil
+}
+
+// Validate implements Step
+func (s PrivateAddressStep) Validate(ctx context.Context, u *url.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	rejected := NewError(ErrPrivateAddress, "URLs pointing to %s can't be shortened, as it's a private or local address.", host)
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return rejected
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if isPrivateIP(ip) {
+			return rejected
+		}
+		return nil
+	}
+
+	if !s.Resolve {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if isPrivateIP(addr.IP) {
+			return rejected
+		}
+	}
+
+	return nil
+}
+
+// ReachabilityStep rejects URLs which don't respond successfully within the
+// client's timeout. It tries a HEAD request first, falling back to GET for
+// servers which don't support HEAD. The response's status isn't reported, so
+// that the step can't be used to learn about other servers.
+type ReachabilityStep struct {
+	Client *http.Client
+}
+
+// NewReachabilityStep creates a ReachabilityStep whose requests time out
+// after the supplied duration. If blockPrivate is set, requests to private or
+// local addresses are refused, including when a URL redirects to one.
+func NewReachabilityStep(timeout time.Duration, blockPrivate bool) ReachabilityStep {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if blockPrivate {
+		// The proxy would be dialed instead of the URL's host, so it's not
+		// used
+		dialer := &net.Dialer{Timeout: timeout, Control: RefusePrivateAddresses}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+
+	return ReachabilityStep{
+		Client: &http.Client{Timeout: timeout, Transport: transport},
+	}
+}
+
+// Validate implements Step
+func (s ReachabilityStep) Validate(ctx context.Context, u *url.URL) error {
+	status, err := s.probe(ctx, http.MethodHead, u)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = s.probe(ctx, http.MethodGet, u)
+	}
+
+	if err != nil || status >= http.StatusBadRequest {
+		return NewError(ErrUnreachable, "The URL was not reachable.")
+	}
+
+	return nil
+}
+
+func (s ReachabilityStep) probe(ctx context.Context, method string, u *url.URL) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	rs, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	rs.Body.Close()
+
+	return rs.StatusCode, nil
+}
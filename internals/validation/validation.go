@@ -0,0 +1,159 @@
+// Package validation checks and normalises URLs submitted for shortening.
+//
+// Validation is a pipeline of steps, each of which can reject a URL with a
+// specific error message, or normalise it before it's passed to the next step.
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSyntax is returned when a URL can't be parsed as an absolute URL
+	ErrSyntax = errors.New("validation: malformed url")
+	// ErrScheme is returned when a URL's scheme isn't allowed
+	ErrScheme = errors.New("validation: scheme not allowed")
+	// ErrTooLong is returned when a URL is longer than the maximum length
+	ErrTooLong = errors.New("validation: url too long")
+	// ErrHost is returned when a URL's host is denied, or isn't allowed
+	ErrHost = errors.New("validation: host not allowed")
+	// ErrPrivateAddress is returned when a URL points to a private or local address
+	ErrPrivateAddress = errors.New("validation: private address")
+	// ErrUnreachable is returned when a URL couldn't be reached
+	ErrUnreachable = errors.New("validation: url not reachable")
+)
+
+// Error describes why a URL failed validation
+//
+// Err is one of the package's sentinel errors, so that callers can use
+// errors.Is to find out which kind of check failed, and Message is a
+// human-readable explanation, suitable for showing to the person who
+// submitted the URL. Message is Format, formatted with Args, so that it can
+// be translated by formatting a translation of Format instead.
+type Error struct {
+	Err     error
+	Message string
+	Format  string
+	Args    []interface{}
+}
+
+// NewError returns an *Error whose message is format, formatted with args
+func NewError(err error, format string, args ...interface{}) *Error {
+	return &Error{
+		Err:     err,
+		Message: fmt.Sprintf(format, args...),
+		Format:  format,
+		Args:    args,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Step is a single check in a Pipeline
+//
+// A step rejects a URL by returning an *Error. It can also normalise the URL
+// by modifying it in place.
+type Step interface {
+	Validate(ctx context.Context, u *url.URL) error
+}
+
+// Pipeline validates URLs by running them through each of its steps in turn
+type Pipeline struct {
+	steps []Step
+}
+
+// NewPipeline creates a Pipeline which runs the supplied steps in order
+func NewPipeline(steps ...Step) *Pipeline {
+	return &Pipeline{steps: steps}
+}
+
+// Validate checks the supplied URL against every step in the pipeline. It
+// returns the normalised URL if every step passed, or the first step's error.
+func (p *Pipeline) Validate(ctx context.Context, rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", NewError(ErrSyntax, "Please provide a URL to shorten.")
+	}
+
+	u, err := url.ParseRequestURI(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", NewError(ErrSyntax, "That doesn't look like a valid URL.")
+	}
+
+	for _, step := range p.steps {
+		if err := step.Validate(ctx, u); err != nil {
+			return "", err
+		}
+	}
+
+	return u.String(), nil
+}
+
+// Config configures the steps of a Pipeline created by New
+type Config struct {
+	// AllowedSchemes lists the schemes which URLs may use
+	AllowedSchemes []string
+	// MaxLength is the maximum length of a URL, or 0 for no limit
+	MaxLength int
+	// AllowedHosts, if not empty, lists the only hosts (and their subdomains)
+	// which URLs may point to
+	AllowedHosts []string
+	// DeniedHosts lists hosts (and their subdomains) which URLs may not point to
+	DeniedHosts []string
+	// BlockPrivateAddresses rejects URLs which point to localhost, or to
+	// private, loopback, or link-local IP addresses
+	BlockPrivateAddresses bool
+	// ResolveHosts resolves host names when checking for private addresses.
+	// Resolution failures are ignored, so that this is safe to enable in
+	// air-gapped deployments.
+	ResolveHosts bool
+	// CheckReachability makes a request to every URL, rejecting those which
+	// can't be reached within ReachabilityTimeout
+	CheckReachability   bool
+	ReachabilityTimeout time.Duration
+}
+
+// DefaultConfig returns the default validation configuration, which works
+// without network access.
+func DefaultConfig() Config {
+	return Config{
+		AllowedSchemes:        []string{"http", "https"},
+		MaxLength:             2048,
+		BlockPrivateAddresses: true,
+		ReachabilityTimeout:   5 * time.Second,
+	}
+}
+
+// New creates a Pipeline from the supplied configuration. The steps run in
+// order of cost, so that the reachability probe, if enabled, runs last.
+func New(cfg Config) *Pipeline {
+	steps := []Step{
+		SchemeStep{Allowed: cfg.AllowedSchemes},
+	}
+	if cfg.MaxLength > 0 {
+		steps = append(steps, MaxLengthStep{Max: cfg.MaxLength})
+	}
+	steps = append(steps, IDNStep{})
+	if len(cfg.AllowedHosts) > 0 || len(cfg.DeniedHosts) > 0 {
+		steps = append(steps, HostStep{Allowed: cfg.AllowedHosts, Denied: cfg.DeniedHosts})
+	}
+	if cfg.BlockPrivateAddresses {
+		steps = append(steps, PrivateAddressStep{Resolve: cfg.ResolveHosts})
+	}
+	if cfg.CheckReachability {
+		steps = append(steps, NewReachabilityStep(cfg.ReachabilityTimeout, cfg.BlockPrivateAddresses))
+	}
+
+	return NewPipeline(steps...)
+}
@@ -0,0 +1,122 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipelineValidatesUrls(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxLength = 64
+	cfg.DeniedHosts = []string{"example.org"}
+	p := New(cfg)
+
+	tests := []struct {
+		name, input, expected string
+		err                   error
+	}{
+		{"valid url", "https://osnews.com/story/1", "https://osnews.com/story/1", nil},
+		{"surrounding whitespace", "  https://osnews.com  ", "https://osnews.com", nil},
+		{"upper-case scheme", "HTTPS://osnews.com", "https://osnews.com", nil},
+		{"internationalised domain", "https://bücher.example/", "https://xn--bcher-kva.example/", nil},
+		{"empty url", "", "", ErrSyntax},
+		{"relative url", "/story/1", "", ErrSyntax},
+		{"disallowed scheme", "ftp://osnews.com", "", ErrScheme},
+		{"javascript scheme", "javascript:alert(1)", "", ErrSyntax},
+		{"too long", "https://osnews.com/" + strings.Repeat("a", 64), "", ErrTooLong},
+		{"denied host", "https://example.org", "", ErrHost},
+		{"denied subdomain", "https://www.example.org", "", ErrHost},
+		{"localhost", "http://localhost:8000", "", ErrPrivateAddress},
+		{"loopback address", "http://127.0.0.1", "", ErrPrivateAddress},
+		{"private address", "http://192.168.1.1/admin", "", ErrPrivateAddress},
+		{"link-local ipv6 address", "http://[fe80::1]/", "", ErrPrivateAddress},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalised, err := p.Validate(context.Background(), test.input)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v; want %v", err, test.err)
+			}
+			if normalised != test.expected {
+				t.Errorf("got '%s'; want '%s'", normalised, test.expected)
+			}
+
+			var validationErr *Error
+			if err != nil && (!errors.As(err, &validationErr) || validationErr.Message == "") {
+				t.Errorf("Expected a validation error with a message. Got: %v", err)
+			}
+		})
+	}
+}
+
+func TestHostStepOnlyAllowsAllowedHosts(t *testing.T) {
+	step := HostStep{Allowed: []string{"osnews.com"}}
+
+	for input, allowed := range map[string]bool{
+		"https://osnews.com":      true,
+		"https://www.osnews.com":  true,
+		"https://notosnews.com":   false,
+		"https://osnews.com.evil": false,
+	} {
+		u, _ := url.Parse(input)
+		err := step.Validate(context.Background(), u)
+		if (err == nil) != allowed {
+			t.Errorf("%s: got error %v; want allowed = %t", input, err, allowed)
+		}
+	}
+}
+
+func TestReachabilityStep(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/head-not-allowed":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	step := NewReachabilityStep(100*time.Millisecond, false)
+	for path, reachable := range map[string]bool{
+		"/":                 true,
+		"/head-not-allowed": true,
+		"/missing":          false,
+		"/slow":             false,
+	} {
+		u, _ := url.Parse(ts.URL + path)
+		err := step.Validate(context.Background(), u)
+		if reachable && err != nil {
+			t.Errorf("%s: did not expect an error to be returned. Got: %s", path, err)
+		}
+		if !reachable && !errors.Is(err, ErrUnreachable) {
+			t.Errorf("%s: got error %v; want %v", path, err, ErrUnreachable)
+		}
+		if err != nil && err.Error() != "The URL was not reachable." {
+			t.Errorf("%s: got error %q; want one which doesn't describe the response", path, err)
+		}
+	}
+}
+
+func TestReachabilityStepRefusesPrivateAddresses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	// Every connection is checked as it's dialed, including those made to
+	// follow redirects
+	step := NewReachabilityStep(time.Second, true)
+	u, _ := url.Parse(ts.URL)
+	if err := step.Validate(context.Background(), u); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("got error %v; want %v", err, ErrUnreachable)
+	}
+}
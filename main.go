@@ -1,59 +1,380 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	migrations "gourlshortener/db"
 	"gourlshortener/internals/application"
+	"gourlshortener/internals/backup"
+	"gourlshortener/internals/blocklist"
+	"gourlshortener/internals/cli"
+	"gourlshortener/internals/config"
+	"gourlshortener/internals/database"
+	"gourlshortener/internals/metadata"
+	"gourlshortener/internals/migrate"
+	"gourlshortener/internals/models"
+	"gourlshortener/internals/ratelimit"
+	"gourlshortener/internals/server"
+	"gourlshortener/internals/shortcode"
+	"gourlshortener/internals/validation"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
-	_ "modernc.org/sqlite"
 )
 
-func main() {
-	env, ok := os.LookupEnv("ENVIRONMENT")
-	if ok && strings.ToLower(env) == "development" {
-		err := godotenv.Load()
+// rateLimiter creates a rate limiter from the supplied limit. It returns nil
+// if the limit is "off".
+func rateLimiter(name, value string, store ratelimit.Store, key func(*http.Request) string) (*ratelimit.Limiter, error) {
+	if strings.ToLower(value) == "off" {
+		return nil, nil
+	}
+
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		return nil, err
+	}
+	return ratelimit.NewLimiter(name, limit, store, key), nil
+}
+
+// loadEnv loads the .env file into the environment, if there is one, without
+// overriding variables which are already set
+func loadEnv() error {
+	if _, err := os.Stat(".env"); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return godotenv.Load()
+}
+
+// openDB opens the configured database, creating its directory if needed, and
+// checks that it's reachable
+func openDB(cfg config.Database) (*database.DB, error) {
+	opts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	dbFile := cfg.File()
+	if err := os.MkdirAll(filepath.Dir(dbFile), 0o755); err != nil {
+		return nil, err
+	}
+	return database.Open(dbFile, opts)
+}
+
+// restoreBackup returns a function which restores a backup over the
+// configured database, checking it against the embedded migrations
+func restoreBackup(cfg config.Database) func(context.Context, string) (*backup.Restored, error) {
+	return func(ctx context.Context, file string) (*backup.Restored, error) {
+		loaded, err := migrate.Load(migrations.Migrations)
 		if err != nil {
-			log.Fatal("Error loading .env file")
+			return nil, err
 		}
+		return backup.Restore(ctx, file, cfg.File(), loaded)
+	}
+}
+
+// overrideDir reports whether dir is set and exists. Earlier versions read the
+// templates and static assets from disk, so deployments may still set a
+// directory which is no longer there, e.g., the image's /opt/templates, and
+// the embedded files are used instead.
+func overrideDir(name, dir string, errorLog *log.Logger) bool {
+	if dir == "" {
+		return false
+	}
+	if _, err := os.Stat(dir); err != nil {
+		errorLog.Printf("Using the embedded files, as %s is set to %s, which can't be read: %s", name, dir, err)
+		return false
 	}
+	return true
+}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8000"
+// newApp creates the application from the configuration
+func newApp(db *database.DB, urls *models.ShortenerDataModel, backups *backup.Manager, cfg *config.Config, infoLog, errorLog *log.Logger) application.App {
+	options := []application.Option{
+		application.WithURLs(urls),
+		application.WithUsers(&models.UserModel{DB: db.Writer, Reader: db.Reader}),
+		application.WithBackups(backups),
+		application.WithAdminToken(cfg.Server.AdminToken),
+		application.WithMaintenance(cfg.Maintenance.Mode()),
+		application.WithLinkChecker(cfg.Health.Checker(cfg.URLs.BlockPrivateAddresses), cfg.Health.BrokenAfter),
+		application.WithValidator(validation.New(cfg.URLs.Validation())),
+		application.WithSecurityHeaders(cfg.Headers.SecurityHeaders()),
+		application.WithBaseURL(cfg.Server.BaseURL),
+		application.WithSite(cfg.Site.Branding()),
+		application.WithLocalizer(cfg.Locale.Localizer()),
 	}
 
-	dbFile := strings.TrimPrefix(os.Getenv("DATABASE_URL"), "sqlite:")
-	authKey := os.Getenv("AUTHENTICATION_KEY")
-	templateBaseDir := os.Getenv("TEMPLATE_BASEDIR")
-	staticDir := os.Getenv("STATIC_DIR")
+	// The embedded templates and static assets can be overridden from disk,
+	// e.g., to develop them without rebuilding the binary, and a theme can
+	// override individual files
+	if overrideDir("TEMPLATE_BASEDIR", cfg.Server.TemplateDir, errorLog) {
+		options = append(options, application.WithTemplates(os.DirFS(cfg.Server.TemplateDir)))
+	}
+	if overrideDir("STATIC_DIR", cfg.Server.StaticDir, errorLog) {
+		options = append(options, application.WithStaticFiles(os.DirFS(cfg.Server.StaticDir)))
+	}
+	if cfg.Site.ThemeDir != "" {
+		options = append(options, application.WithTheme(os.DirFS(cfg.Site.ThemeDir)))
+	}
 
-	db, err := sql.Open("sqlite", dbFile)
+	generator, err := shortcode.New(cfg.Codes.Generator, &models.CodeSequence{DB: db.Writer}, cfg.Codes.Salt)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err = db.Ping(); err != nil {
+	options = append(options, application.WithCodeAllocator(shortcode.NewAllocator(generator, cfg.Codes.Length)))
+
+	if cfg.Metadata.Fetch {
+		options = append(options, application.WithMetadataFetcher(metadata.NewFetcher(cfg.Metadata.Timeout, cfg.Metadata.MaxBytes, cfg.URLs.BlockPrivateAddresses)))
+	}
+
+	if files := cfg.Blocklist.Files; len(files) > 0 {
+		blocked, err := blocklist.Load(files...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go blocked.Watch(context.Background(), cfg.Blocklist.ReloadInterval, func(err error) {
+			errorLog.Printf("Could not reload the blocklist: %s", err)
+		})
+		infoLog.Printf("Loaded %d blocklist rules from %s", blocked.Len(), strings.Join(files, ", "))
+		options = append(options, application.WithBlocklist(blocked))
+	}
+
+	proxies, err := ratelimit.ParseTrustedProxies(cfg.RateLimits.TrustedProxies)
+	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	store := ratelimit.NewMemoryStore()
+	createLimiter, err := rateLimiter("create", cfg.RateLimits.Create, store, ratelimit.ClientKey(proxies))
+	if err != nil {
+		log.Fatal(err)
+	}
+	redirectLimiter, err := rateLimiter("redirect", cfg.RateLimits.Redirect, store, ratelimit.ClientKey(proxies))
+	if err != nil {
+		log.Fatal(err)
+	}
+	options = append(options, application.WithRateLimiters(createLimiter, redirectLimiter), application.WithTrustedProxies(proxies))
 
-	app := application.NewApp(db, authKey, templateBaseDir, staticDir)
-	addr := flag.String("addr", ":"+port, "HTTP network address")
+	return application.NewApp(db.Writer, cfg.Server.AuthenticationKey, options...)
+}
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+// shutdownTimeout is how long requests in flight are given to finish when
+// the server is stopped
+const shutdownTimeout = 10 * time.Second
 
+// serve runs the web server until it fails, or until it's interrupted or
+// terminated, when it shuts down gracefully
+func serve(app application.App, cfg *config.Config, infoLog, errorLog *log.Logger) {
+	addr := cfg.Server.ListenAddr()
 	srv := &http.Server{
-		Addr:     *addr,
+		Addr:     addr,
 		ErrorLog: errorLog,
 		Handler:  app.Routes(),
 	}
 
-	infoLog.Printf("Starting server on %s", *addr)
-	err = srv.ListenAndServe()
-	errorLog.Fatal(err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	servers := []*http.Server{srv}
+	listen := srv.ListenAndServe
+	if cfg.TLS.CertFile == "" {
+		infoLog.Printf("Starting server on %s", addr)
+	} else {
+		certs, err := server.NewCertificateReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		onReloadError := func(err error) {
+			errorLog.Printf("Could not reload the TLS certificate: %s", err)
+		}
+		certs.ReloadOnSignal(ctx, onReloadError, syscall.SIGHUP)
+		go certs.Watch(ctx, cfg.TLS.ReloadInterval, onReloadError)
+		srv.TLSConfig = certs.TLSConfig()
+
+		if cfg.TLS.HTTPRedirectPort != 0 {
+			redirectSrv := &http.Server{
+				Addr:     ":" + strconv.Itoa(cfg.TLS.HTTPRedirectPort),
+				ErrorLog: errorLog,
+				Handler:  server.RedirectHandler(cfg.Server.ListenPort()),
+			}
+			servers = append(servers, redirectSrv)
+			go func() {
+				infoLog.Printf("Starting HTTP to HTTPS redirect server on %s", redirectSrv.Addr)
+				if err := redirectSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+					errorLog.Fatal(err)
+				}
+			}()
+		}
+
+		infoLog.Printf("Starting HTTPS server on %s", addr)
+		listen = func() error { return srv.ListenAndServeTLS("", "") }
+	}
+
+	failed := make(chan error, 1)
+	go func() { failed <- listen() }()
+	select {
+	case err := <-failed:
+		errorLog.Fatal(err)
+	case <-ctx.Done():
+	}
+	// A second signal stops the server straight away
+	stop()
+
+	// Requests in flight are given time to finish, and the clicks buffered
+	// in maintenance mode are then recorded, before the database is closed
+	infoLog.Print("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			errorLog.Printf("Could not shut down the server on %s cleanly: %s", s.Addr, err)
+		}
+	}
+	if err := app.FlushClicks(); err != nil {
+		errorLog.Printf("Could not record the clicks buffered in maintenance mode: %s", err)
+	}
+}
+
+// cliActor identifies the user running an admin command, in links' revision
+// history
+func cliActor() string {
+	if user := os.Getenv("USER"); user != "" {
+		return "cli:" + user
+	}
+	return "cli"
+}
+
+func main() {
+	if err := loadEnv(); err != nil {
+		log.Fatalf("Error loading .env file: %s", err)
+	}
+
+	cfg, args, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(cli.Usage)
+		fmt.Println("\nFlags:")
+		config.PrintFlags(os.Stdout)
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	if command == "help" || command == "config" {
+		os.Exit(cli.Run(context.Background(), cli.Env{Config: cfg, Stdout: os.Stdout, Stderr: os.Stderr}, command, args))
+	}
+
+	if err = cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	// A backup is restored over the database file, so the database isn't
+	// opened for it
+	if command == "restore" {
+		os.Exit(cli.Run(context.Background(), cli.Env{
+			Restore: restoreBackup(cfg.Database),
+			Stdout:  os.Stdout,
+			Stderr:  os.Stderr,
+		}, command, args))
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	migrator, err := migrate.New(db.Writer, migrations.Migrations)
+	if err != nil {
+		log.Fatal(err)
+	}
+	backups := cfg.Backup.Manager(cfg.Database)
+
+	if command == "serve" {
+		if len(args) > 0 {
+			log.Fatalf("serve takes no arguments; put flags before the command")
+		}
+		if cfg.Database.AutoMigrate {
+			applied, err := migrator.Up(context.Background())
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, migration := range applied {
+				infoLog.Printf("Applied database migration %s", migration.Filename())
+			}
+		}
+
+		// The statements run on every redirect are prepared once the
+		// tables that they use exist
+		urls, err := models.NewShortenerDataModel(db.Writer, db.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer urls.Close()
+		if cfg.Backup.Interval > 0 {
+			go backups.Schedule(context.Background(), cfg.Backup.Interval, func(b *backup.Backup, err error) {
+				if err != nil {
+					errorLog.Printf("Could not back up the database: %s", err)
+					return
+				}
+				infoLog.Printf("Backed up the database to %s", b.Path)
+			})
+			infoLog.Printf("Backing up the database to %s every %s", backups.Dir, cfg.Backup.Interval)
+		}
+		app := newApp(db, urls, backups, cfg, infoLog, errorLog)
+		if app.InMaintenance() {
+			infoLog.Print("Starting in maintenance mode; links can't be created or changed")
+		}
+		app.ToggleMaintenanceOnSignal(context.Background(), func(on bool, err error) {
+			switch {
+			case err != nil:
+				errorLog.Printf("Could not turn maintenance mode off: %s", err)
+			case on:
+				infoLog.Print("Turned maintenance mode on")
+			default:
+				infoLog.Print("Turned maintenance mode off")
+			}
+		}, maintenanceSignals...)
+		if cfg.Health.Interval > 0 {
+			go app.MonitorLinks(context.Background(), cfg.Health.Interval, func(err error) {
+				errorLog.Printf("Could not check the links' destinations: %s", err)
+			})
+			infoLog.Printf("Checking the links' destinations every %s", cfg.Health.Interval)
+		}
+		serve(app, cfg, infoLog, errorLog)
+		return
+	}
+
+	// Admin commands run too few statements to be worth preparing, and the
+	// tables might not exist yet
+	urls := &models.ShortenerDataModel{DB: db.Writer, Reader: db.Reader}
+	app := newApp(db, urls, backups, cfg, infoLog, errorLog)
+	status := cli.Run(context.Background(), cli.Env{
+		URLs:     urls,
+		Users:    &models.UserModel{DB: db.Writer, Reader: db.Reader},
+		Create:   app.CreateLink,
+		Validate: app.ValidateURL,
+		Import:   app.ImportLinks,
+		Actor:    cliActor(),
+		Migrator: migrator,
+		Config:   cfg,
+		Backups:  backups,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+	}, command, args)
+	db.Close()
+	os.Exit(status)
 }
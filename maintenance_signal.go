@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// maintenanceSignals are the signals which turn maintenance mode on and off
+var maintenanceSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,8 @@
+package main
+
+import "os"
+
+// maintenanceSignals are the signals which turn maintenance mode on and off.
+// Windows doesn't have SIGUSR1, so maintenance mode can only be turned on and
+// off through the admin API there.
+var maintenanceSignals = []os.Signal{}
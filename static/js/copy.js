@@ -0,0 +1,19 @@
+// Copies the value of a button's data-copy attribute to the clipboard when
+// it's clicked, briefly confirming that it was copied.
+document.addEventListener("DOMContentLoaded", function () {
+  document.querySelectorAll("button[data-copy]").forEach(function (button) {
+    if (!navigator.clipboard) {
+      button.hidden = true;
+      return;
+    }
+    var label = button.textContent;
+    button.addEventListener("click", function () {
+      navigator.clipboard.writeText(button.dataset.copy).then(function () {
+        button.textContent = "Copied!";
+        setTimeout(function () {
+          button.textContent = label;
+        }, 2000);
+      });
+    });
+  });
+});
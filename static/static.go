@@ -0,0 +1,10 @@
+// Package static embeds the application's static assets, so that the binary
+// can serve them without the static directory.
+package static
+
+import "embed"
+
+// FS holds the static assets, such as css/styles.css, at its root
+//
+//go:embed css js
+var FS embed.FS
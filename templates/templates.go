@@ -0,0 +1,10 @@
+// Package templates embeds the application's HTML templates, so that the
+// binary can render them without the templates directory.
+package templates
+
+import "embed"
+
+// FS holds the templates, at its root
+//
+//go:embed *.html partials/*.html
+var FS embed.FS